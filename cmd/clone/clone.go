@@ -26,10 +26,11 @@ import (
 	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/github"
 	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/state"
 )
 
 var (
-	gh github.GitHub = github.NewRealGitHub()
+	gh github.GitHub = github.NewGitHub()
 	g  git.Git       = git.NewRealGit()
 )
 
@@ -130,9 +131,9 @@ func run(c *cobra.Command, _ []string) {
 		}
 		createBranchActivity.EndWithSuccess()
 
+		var defaultBranch string
 		if fork {
 			pullFromUpstreamActivity := logger.StartActivity("Pulling latest changes from %s", repo.FullRepoName)
-			var defaultBranch string
 			defaultBranch, err = gh.GetDefaultBranchName(pullFromUpstreamActivity.Writer(), repoDirPath, repo.FullRepoName)
 			if err != nil {
 				pullFromUpstreamActivity.EndWithFailure(err)
@@ -149,6 +150,13 @@ func run(c *cobra.Command, _ []string) {
 			pullFromUpstreamActivity.EndWithSuccess()
 		}
 
+		if err := dir.State.Update(repo.FullRepoName, func(r *state.RepoState) {
+			r.Fork = fork
+			r.DefaultBranch = defaultBranch
+		}); err != nil {
+			logger.Warnf("Unable to record the state of %s: %v", repo.FullRepoName, err)
+		}
+
 		doneCount++
 	}
 
@@ -25,6 +25,7 @@ import (
 	"github.com/skyscanner/turbolift/internal/colors"
 	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/state"
 )
 
 var g git.Git = git.NewRealGit()
@@ -97,9 +98,22 @@ func run(c *cobra.Command, _ []string) {
 		if err != nil {
 			commitActivity.EndWithFailure(err)
 			errorCount++
-		} else {
-			commitActivity.EndWithSuccess()
-			doneCount++
+			continue
+		}
+
+		doneCount++
+		// the commit has been made, so only its record in the state file is lost if it cannot be read back
+		sha, err := g.GetHeadSHA(commitActivity.Writer(), repoDirPath)
+		if err != nil {
+			commitActivity.EndWithWarningf("Committed, but unable to record the commit: %v", err)
+			continue
+		}
+		commitActivity.EndWithSuccess()
+
+		if err := dir.State.Update(repo.FullRepoName, func(r *state.RepoState) {
+			r.LastCommitSHA = sha
+		}); err != nil {
+			logger.Warnf("Unable to record the state of %s: %v", repo.FullRepoName, err)
 		}
 	}
 
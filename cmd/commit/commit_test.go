@@ -19,6 +19,7 @@ import (
 	"bytes"
 	"errors"
 	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/state"
 	"github.com/skyscanner/turbolift/internal/testsupport"
 	"github.com/stretchr/testify/assert"
 	"io"
@@ -39,11 +40,48 @@ func TestItCommitsAllWithChanges(t *testing.T) {
 	fakeGit.AssertCalledWith(t, [][]string{
 		{"isRepoChanged", "work/org/repo1"},
 		{"commit", "work/org/repo1", "some test message"},
+		{"getHeadSHA", "work/org/repo1"},
 		{"isRepoChanged", "work/org/repo2"},
 		{"commit", "work/org/repo2", "some test message"},
+		{"getHeadSHA", "work/org/repo2"},
 	})
 }
 
+func TestItRecordsTheCommitInTheCampaignState(t *testing.T) {
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, err := runCommand("some test message", []string{}...)
+	assert.NoError(t, err)
+
+	campaignState, err := state.Load(state.DefaultFilename, testsupport.Pwd())
+	assert.NoError(t, err)
+	assert.Equal(t, git.FakeSHA, campaignState.Get("org/repo1").LastCommitSHA)
+}
+
+func TestItCountsTheCommitWhenItCannotBeRecorded(t *testing.T) {
+	fakeGit := git.NewFakeGit(func(output io.Writer, call []string) (bool, error) {
+		if call[0] == "getHeadSHA" {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	})
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand("some test message", []string{}...)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Committed, but unable to record the commit: synthetic error")
+	assert.Contains(t, out, "1 OK, 0 skipped")
+
+	campaignState, err := state.Load(state.DefaultFilename, testsupport.Pwd())
+	assert.NoError(t, err)
+	assert.Empty(t, campaignState.Get("org/repo1").LastCommitSHA)
+}
+
 func TestItSkipsReposWithoutChanges(t *testing.T) {
 	fakeGit := git.NewFakeGit(func(output io.Writer, call []string) (bool, error) {
 		if call[0] == "isRepoChanged" && call[1] == "work/org/repo1" {
@@ -65,6 +103,7 @@ func TestItSkipsReposWithoutChanges(t *testing.T) {
 		{"isRepoChanged", "work/org/repo1"},
 		{"isRepoChanged", "work/org/repo2"},
 		{"commit", "work/org/repo2", "some test message"},
+		{"getHeadSHA", "work/org/repo2"},
 	})
 }
 
@@ -89,6 +128,7 @@ func TestItSkipsReposWhichErrorOnStatusChekc(t *testing.T) {
 		{"isRepoChanged", "work/org/repo1"},
 		{"isRepoChanged", "work/org/repo2"},
 		{"commit", "work/org/repo2", "some test message"},
+		{"getHeadSHA", "work/org/repo2"},
 	})
 }
 
@@ -109,6 +149,7 @@ func TestItSkipsMissingRepos(t *testing.T) {
 	fakeGit.AssertCalledWith(t, [][]string{
 		{"isRepoChanged", "work/org/repo2"},
 		{"commit", "work/org/repo2", "some test message"},
+		{"getHeadSHA", "work/org/repo2"},
 	})
 }
 
@@ -16,6 +16,7 @@
 package create_prs
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path"
@@ -31,10 +32,12 @@ import (
 	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/github"
 	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/state"
+	"github.com/skyscanner/turbolift/internal/tracking"
 )
 
 var (
-	gh github.GitHub = github.NewRealGitHub()
+	gh github.GitHub = github.NewGitHub()
 	g  git.Git       = git.NewRealGit()
 	p  prompt.Prompt = prompt.NewRealPrompt()
 )
@@ -44,6 +47,9 @@ var (
 	repoFile          string
 	prDescriptionFile string
 	sleep             time.Duration
+	trackingIssue     string
+	autoMerge         bool
+	mergeStrategy     string
 )
 
 func NewCreatePRsCmd() *cobra.Command {
@@ -57,12 +63,23 @@ func NewCreatePRsCmd() *cobra.Command {
 	cmd.Flags().BoolVar(&isDraft, "draft", false, "Creates the Pull Request as Draft PR")
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
 	cmd.Flags().StringVar(&prDescriptionFile, "description", "README.md", "A file containing the title and description for the PRs.")
+	cmd.Flags().BoolVar(&autoMerge, "auto-merge", false, "Enable auto-merge on each PR, so that it is merged once its branch protection requirements are met")
+	cmd.Flags().StringVar(&mergeStrategy, "strategy", github.MergeStrategyMerge, "How to merge PRs with --auto-merge: merge, squash or rebase")
+	cmd.Flags().StringVar(&trackingIssue, "tracking-issue", "", "Keep a checklist of the campaign's PRs in a tracking issue. Give a repo, [host/]owner/repo, to create the issue in, or an existing issue as [host/]owner/repo#number.")
 
 	return cmd
 }
 
 func run(c *cobra.Command, _ []string) {
 	logger := logging.NewLogger(c)
+	if autoMerge && !github.MergeStrategies[mergeStrategy] {
+		logger.Errorf("Error while parsing the flags: unknown merge strategy %s: use merge, squash or rebase", mergeStrategy)
+		return
+	}
+	if autoMerge && isDraft {
+		logger.Errorf("Error while parsing the flags: --auto-merge cannot be combined with --draft, as draft PRs are not merged")
+		return
+	}
 
 	readCampaignActivity := logger.StartActivity("Reading campaign data (%s, %s)", repoFile, prDescriptionFile)
 	options := campaign.NewCampaignOptions()
@@ -82,9 +99,27 @@ func run(c *cobra.Command, _ []string) {
 		}
 	}
 
+	if trackingIssue != "" {
+		trackingIssueActivity := logger.StartActivity("Opening tracking issue in %s", trackingIssue)
+		issue, created, err := tracking.Open(trackingIssueActivity.Writer(), gh, dir, trackingIssue)
+		if err != nil {
+			trackingIssueActivity.EndWithFailure(err)
+			return
+		}
+		if created {
+			trackingIssueActivity.Logf("Created tracking issue %s", issue.Url)
+		} else {
+			trackingIssueActivity.Logf("Using tracking issue %s", issue.Url)
+		}
+		trackingIssueActivity.EndWithSuccessAndEmitLogs()
+	}
+
 	doneCount := 0
 	skippedCount := 0
 	errorCount := 0
+	// repos that do not allow auto-merge are listed apart, as their PRs were still created
+	var autoMergeNotAllowed []*github.AutoMergeNotAllowedError
+	var autoMergeFailed []string
 	for i, repo := range dir.Repos {
 		if i > 0 && sleep > 0 {
 			logger.Successf("Sleeping for %s", sleep)
@@ -101,13 +136,28 @@ func run(c *cobra.Command, _ []string) {
 			continue
 		}
 
+		// skip if a PR has already been raised, e.g. by a previous run that was interrupted
+		if repoState := dir.State.Get(repo.FullRepoName); repoState.HasPR() {
+			pushActivity.EndWithWarningf("PR already raised: %s", repoState.PrUrl)
+			skippedCount++
+			continue
+		}
+
 		err := g.Push(pushActivity.Writer(), repoDirPath, "origin", dir.Name)
 		if err != nil {
 			pushActivity.EndWithFailure(err)
 			errorCount++
 			continue
 		}
-		pushActivity.EndWithSuccess()
+		// the branch has been pushed, so the PR is still raised if the pushed commit cannot be recorded
+		if pushedSHA, err := g.GetHeadSHA(pushActivity.Writer(), repoDirPath); err != nil {
+			pushActivity.EndWithWarningf("Pushed, but unable to record the pushed commit: %v", err)
+		} else {
+			pushActivity.EndWithSuccess()
+			updateState(dir, repo, logger, func(r *state.RepoState) {
+				r.PushedSHA = pushedSHA
+			})
+		}
 
 		var createPrActivity *logging.Activity
 		if isDraft {
@@ -116,14 +166,27 @@ func run(c *cobra.Command, _ []string) {
 			createPrActivity = logger.StartActivity("Creating PR in %s", repo.FullRepoName)
 		}
 
+		prTitle, prBody, err := dir.RenderPrDescriptionFor(createPrActivity.Writer(), g, repo)
+		if err != nil {
+			createPrActivity.EndWithFailure(err)
+			errorCount++
+			continue
+		}
+
 		pullRequest := github.PullRequest{
-			Title:        dir.PrTitle,
-			Body:         dir.PrBody,
-			UpstreamRepo: repo.FullRepoName,
-			IsDraft:      isDraft,
+			Title:         prTitle,
+			Body:          prBody,
+			UpstreamRepo:  repo.FullRepoName,
+			IsDraft:       isDraft,
+			Labels:        dir.PrOptions.Labels,
+			Reviewers:     dir.PrOptions.Reviewers,
+			TeamReviewers: dir.PrOptions.TeamReviewers,
+			Assignees:     dir.PrOptions.Assignees,
+			Milestone:     dir.PrOptions.Milestone,
+			Base:          dir.PrOptions.Base,
 		}
 
-		didCreate, err := gh.CreatePullRequest(createPrActivity.Writer(), repoDirPath, pullRequest)
+		didCreate, prUrl, err := gh.CreatePullRequest(createPrActivity.Writer(), repoDirPath, pullRequest)
 
 		if err != nil {
 			createPrActivity.EndWithFailure(err)
@@ -133,7 +196,54 @@ func run(c *cobra.Command, _ []string) {
 			skippedCount++
 		} else {
 			createPrActivity.EndWithSuccess()
+			updateState(dir, repo, logger, func(r *state.RepoState) {
+				r.PrUrl = prUrl
+				if number, ok := github.PrNumberFromUrl(prUrl); ok {
+					r.PrNumber = number
+				}
+				r.PrState = "OPEN"
+				r.AppliedLabels = pullRequest.Labels
+				r.AppliedReviewers = pullRequest.AllReviewers()
+				r.AppliedAssignees = pullRequest.Assignees
+			})
 			doneCount++
+
+			if autoMerge {
+				// the PR has been raised, so failing to enable auto-merge only leaves it to be merged by other means
+				if notAllowed, ok := enableAutoMerge(logger, repo, prUrl); !ok {
+					autoMergeFailed = append(autoMergeFailed, repo.FullRepoName)
+				} else if notAllowed != nil {
+					autoMergeNotAllowed = append(autoMergeNotAllowed, notAllowed)
+				}
+			}
+		}
+	}
+
+	if len(autoMergeNotAllowed) > 0 {
+		logger.Println()
+		logger.Println("Auto-merge is not allowed in these repos, so their PRs will need merging by other means:")
+		for _, notAllowed := range autoMergeNotAllowed {
+			logger.Printf("  %s: %s", notAllowed.Repo, notAllowed.Reason)
+		}
+		logger.Println()
+	}
+
+	if len(autoMergeFailed) > 0 {
+		logger.Println()
+		logger.Println("Auto-merge could not be enabled in these repos. Use update-prs --enable-auto-merge to try again:")
+		for _, repo := range autoMergeFailed {
+			logger.Printf("  %s", repo)
+		}
+		logger.Println()
+	}
+
+	if issue := dir.State.GetTrackingIssue(); issue != nil {
+		syncActivity := logger.StartActivity("Updating tracking issue %s", issue.Url)
+		if _, err := tracking.Sync(syncActivity.Writer(), gh, dir); err != nil {
+			syncActivity.EndWithFailure(err)
+			errorCount++
+		} else {
+			syncActivity.EndWithSuccess()
 		}
 	}
 
@@ -144,6 +254,35 @@ func run(c *cobra.Command, _ []string) {
 	}
 }
 
+// enableAutoMerge turns on auto-merge for a newly created PR. It reports whether that went without error, along with
+// the reason auto-merge was refused if the repo does not allow it. Failures are warnings, as the PR itself was raised.
+func enableAutoMerge(logger *logging.Logger, repo campaign.Repo, prUrl string) (*github.AutoMergeNotAllowedError, bool) {
+	autoMergeActivity := logger.StartActivity("Enabling auto-merge for PR in %s", repo.FullRepoName)
+	number, ok := github.PrNumberFromUrl(prUrl)
+	if !ok {
+		autoMergeActivity.EndWithWarningf("Unable to find the PR number in %s", prUrl)
+		return nil, false
+	}
+
+	err := gh.EnableAutoMerge(autoMergeActivity.Writer(), repo.FullRepoName, number, mergeStrategy)
+	var notAllowed *github.AutoMergeNotAllowedError
+	if errors.As(err, &notAllowed) {
+		autoMergeActivity.EndWithWarning(notAllowed)
+		return notAllowed, true
+	} else if err != nil {
+		autoMergeActivity.EndWithWarning(err)
+		return nil, false
+	}
+	autoMergeActivity.EndWithSuccess()
+	return nil, true
+}
+
+func updateState(dir *campaign.Campaign, repo campaign.Repo, logger *logging.Logger, update func(*state.RepoState)) {
+	if err := dir.State.Update(repo.FullRepoName, update); err != nil {
+		logger.Warnf("Unable to record the state of %s: %v", repo.FullRepoName, err)
+	}
+}
+
 func prDescriptionUnchanged(dir *campaign.Campaign) bool {
 	originalPrTitleTodo := "TODO: Title of Pull Request"
 	originalPrBodyTodo := "TODO: This file will serve as both a README and the description of the PR."
@@ -17,6 +17,9 @@ package create_prs
 
 import (
 	"bytes"
+	"errors"
+	"io"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -24,6 +27,7 @@ import (
 	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/github"
 	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/state"
 	"github.com/skyscanner/turbolift/internal/testsupport"
 )
 
@@ -174,6 +178,66 @@ func TestItLogsCreatePrsSucceeds(t *testing.T) {
 	})
 }
 
+func TestItRecordsCreatedPrsAndSkipsThemWhenRerun(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "2 OK, 0 skipped")
+
+	campaignState, err := state.Load(state.DefaultFilename, testsupport.Pwd())
+	assert.NoError(t, err)
+	repoState := campaignState.Get("org/repo1")
+	assert.Equal(t, git.FakeSHA, repoState.PushedSHA)
+	assert.Equal(t, "https://github.com/org/repo1/pull/1", repoState.PrUrl)
+	assert.Equal(t, 1, repoState.PrNumber)
+	assert.Equal(t, "OPEN", repoState.PrState)
+
+	out, err = runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "PR already raised: https://github.com/org/repo1/pull/1")
+	assert.Contains(t, out, "0 OK, 2 skipped")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"create_pull_request", "work/org/repo1", "PR title"},
+		{"create_pull_request", "work/org/repo2", "PR title"},
+	})
+}
+
+func TestItRaisesPrsWhenThePushedCommitCannotBeRecorded(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewFakeGit(func(output io.Writer, call []string) (bool, error) {
+		if call[0] == "getHeadSHA" {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	})
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Pushed, but unable to record the pushed commit: synthetic error")
+	assert.Contains(t, out, "1 OK, 0 skipped")
+
+	campaignState, err := state.Load(state.DefaultFilename, testsupport.Pwd())
+	assert.NoError(t, err)
+	repoState := campaignState.Get("org/repo1")
+	assert.Empty(t, repoState.PushedSHA)
+	assert.Equal(t, "https://github.com/org/repo1/pull/1", repoState.PrUrl)
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"create_pull_request", "work/org/repo1", "PR title"},
+	})
+}
+
 func TestItLogsCreateDraftPr(t *testing.T) {
 	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
 	gh = fakeGitHub
@@ -220,6 +284,172 @@ func TestItCreatesPrsFromAlternativeDescriptionFile(t *testing.T) {
 	})
 }
 
+func TestItAppliesPrOptionsFromFrontMatter(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	_ = os.WriteFile("README.md", []byte("---\nlabels: [dependencies]\nteam_reviewers: [platform]\nbase: develop\n---\n# PR title\nPR body"), 0o644)
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "1 OK, 0 skipped")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"create_pull_request", "work/org/repo1", "PR title", "labels=dependencies", "team_reviewers=platform", "base=develop"},
+	})
+
+	campaignState, err := state.Load(state.DefaultFilename, testsupport.Pwd())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dependencies"}, campaignState.Get("org/repo1").AppliedLabels)
+	assert.Equal(t, []string{"org/platform"}, campaignState.Get("org/repo1").AppliedReviewers)
+}
+
+func TestItCreatesATrackingIssueListingThePrs(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommandWithTrackingIssue("org/tracking")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Created tracking issue https://github.com/org/tracking/issues/1")
+	assert.Contains(t, out, "Updating tracking issue https://github.com/org/tracking/issues/1")
+	assert.Contains(t, out, "2 OK, 0 skipped")
+
+	campaignState, err := state.Load(state.DefaultFilename, testsupport.Pwd())
+	assert.NoError(t, err)
+	assert.Equal(t, &state.TrackingIssue{Repo: "org/tracking", Number: 1, Url: "https://github.com/org/tracking/issues/1"}, campaignState.GetTrackingIssue())
+
+	issue, err := fakeGitHub.GetIssue(nil, "org/tracking", 1)
+	assert.NoError(t, err)
+	assert.Contains(t, issue.Body, "0 of 2 PRs merged.\n\n- [ ] org/repo1 https://github.com/org/repo1/pull/1\n- [ ] org/repo2 https://github.com/org/repo2/pull/1\n")
+}
+
+func TestItDoesNotCreatePrsIfTheTrackingIssueCannotBeOpened(t *testing.T) {
+	fakeGitHub := github.NewAlwaysFailsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommandWithTrackingIssue("org/tracking#5")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Opening tracking issue in org/tracking#5")
+	assert.NotContains(t, out, "turbolift create-prs completed")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_issue", "org/tracking", "5"},
+	})
+}
+
+func TestItEnablesAutoMergeOnCreatedPrs(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommandWithAutoMerge(github.MergeStrategySquash)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Enabling auto-merge for PR in org/repo1")
+	assert.Contains(t, out, "2 OK, 0 skipped")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"create_pull_request", "work/org/repo1", "PR title"},
+		{"enable_auto_merge", "org/repo1", "1", "squash"},
+		{"create_pull_request", "work/org/repo2", "PR title"},
+		{"enable_auto_merge", "org/repo2", "1", "squash"},
+	})
+}
+
+func TestItReportsReposThatDoNotAllowAutoMergeSeparately(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.EnableAutoMerge && args[1] == "org/repo2" {
+			return false, &github.AutoMergeNotAllowedError{Repo: args[1], Reason: "it is not enabled in the repository settings"}
+		}
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return nil, nil
+	})
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommandWithAutoMerge(github.MergeStrategyMerge)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Auto-merge is not allowed in these repos")
+	assert.Contains(t, out, "org/repo2: it is not enabled in the repository settings")
+	assert.Contains(t, out, "turbolift create-prs completed")
+	assert.Contains(t, out, "2 OK, 0 skipped")
+	assert.NotContains(t, out, "errored")
+}
+
+func TestItCountsReposWhereAutoMergeFailsOnceAsDone(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.EnableAutoMerge && args[1] == "org/repo2" {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return nil, nil
+	})
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommandWithAutoMerge(github.MergeStrategyMerge)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Auto-merge could not be enabled in these repos")
+	assert.Contains(t, out, "  org/repo2")
+	assert.Contains(t, out, "2 OK, 0 skipped")
+	assert.NotContains(t, out, "errored")
+}
+
+func TestItRejectsAutoMergeForDraftPrs(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	cmd := NewCreatePRsCmd()
+	autoMerge = true
+	isDraft = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, outBuffer.String(), "--auto-merge cannot be combined with --draft")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItRejectsUnknownMergeStrategiesForAutoMerge(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommandWithAutoMerge("fast-forward")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "unknown merge strategy fast-forward")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
 func runCommand() (string, error) {
 	cmd := NewCreatePRsCmd()
 	outBuffer := bytes.NewBufferString("")
@@ -245,3 +475,22 @@ func runCommandDraft() (string, error) {
 	err := cmd.Execute()
 	return outBuffer.String(), err
 }
+
+func runCommandWithTrackingIssue(ref string) (string, error) {
+	cmd := NewCreatePRsCmd()
+	trackingIssue = ref
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
+
+func runCommandWithAutoMerge(strategy string) (string, error) {
+	cmd := NewCreatePRsCmd()
+	autoMerge = true
+	mergeStrategy = strategy
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
@@ -21,6 +21,8 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 
@@ -28,6 +30,7 @@ import (
 	"github.com/skyscanner/turbolift/internal/colors"
 	"github.com/skyscanner/turbolift/internal/executor"
 	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/state"
 
 	"github.com/alessio/shellescape"
 )
@@ -38,6 +41,7 @@ var (
 	repoFile   = "repos.txt"
 	successful bool
 	failed     bool
+	parallel   int
 
 	overallResultsDirectory string
 
@@ -50,6 +54,14 @@ var (
 
 const previousResultsSymlink = ".turbolift_previous_results"
 
+type outcome int
+
+const (
+	skipped outcome = iota
+	succeeded
+	errored
+)
+
 func formatArguments(arguments []string) string {
 	quotedArgs := make([]string, len(arguments))
 	for i, arg := range arguments {
@@ -83,6 +95,7 @@ marks that no further options should be interpreted by turbolift.`,
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
 	cmd.Flags().BoolVar(&successful, "successful", false, "Indication of whether to run against previously successful repos only.")
 	cmd.Flags().BoolVar(&failed, "failed", false, "Indication of whether to run against previously failed repos only.")
+	cmd.Flags().IntVar(&parallel, "parallel", 1, "Number of working copies to run COMMAND against concurrently.")
 
 	return cmd
 }
@@ -94,6 +107,10 @@ func runE(c *cobra.Command, args []string) error {
 		return errors.New("use -- to separate command")
 	}
 
+	if parallel < 1 {
+		return errors.New("--parallel must be at least 1")
+	}
+
 	isCustomRepoFile := repoFile != "repos.txt"
 	if moreThanOne(successful, failed, isCustomRepoFile) {
 		return errors.New("a maximum of one repositories flag / option may be specified: either --successful; --failed; or --repos <file>")
@@ -133,28 +150,62 @@ func runE(c *cobra.Command, args []string) error {
 	logger.Printf("Logs for all executions will be stored under %s", overallResultsDirectory)
 
 	var doneCount, skippedCount, errorCount int
-	for _, repo := range dir.Repos {
-		repoDirPath := path.Join("work", repo.OrgName, repo.RepoName) // i.e. work/org/repo
-
-		execActivity := logger.StartActivity("Executing { %s } in %s", prettyArgs, repoDirPath)
-
-		// skip if the working copy does not exist
-		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
-			execActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+	count := func(o outcome) {
+		switch o {
+		case succeeded:
+			doneCount++
+		case skipped:
 			skippedCount++
-			continue
+		case errored:
+			errorCount++
 		}
+	}
 
-		err := exec.Execute(execActivity.Writer(), repoDirPath, args[0], args[1:]...)
-
-		if err != nil {
-			emitOutcomeToFiles(repo, failedReposFileName, failedResultsDirectory, execActivity.Logs(), logger)
-			execActivity.EndWithFailure(err)
-			errorCount++
-		} else {
-			emitOutcomeToFiles(repo, successfulReposFileName, successfulResultsDirectory, execActivity.Logs(), logger)
-			execActivity.EndWithSuccessAndEmitLogs()
-			doneCount++
+	if parallel == 1 {
+		for _, repo := range dir.Repos {
+			execActivity := logger.StartActivity("Executing { %s } in %s", prettyArgs, repo.FullRepoPath())
+			o, err := executeInRepo(dir, repo, args, execActivity)
+			count(o)
+			if err != nil {
+				logger.Errorf("Failed to store the results of %s: %v", repo.FullRepoName, err)
+			}
+		}
+	} else {
+		logger.Printf("Running against up to %d repos at a time", parallel)
+		group := logger.StartActivityGroup()
+
+		repos := make(chan campaign.Repo)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		// nothing else may be logged while the group is displayed, so failures to store results are logged afterwards
+		storeErrs := map[string]error{}
+		for i := 0; i < parallel; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for repo := range repos {
+					execActivity := group.StartActivity("Executing { %s } in %s", prettyArgs, repo.FullRepoPath())
+					o, err := executeInRepo(dir, repo, args, execActivity)
+					mu.Lock()
+					count(o)
+					if err != nil {
+						storeErrs[repo.FullRepoName] = err
+					}
+					mu.Unlock()
+				}
+			}()
+		}
+		for _, repo := range dir.Repos {
+			repos <- repo
+		}
+		close(repos)
+		wg.Wait()
+		group.End()
+
+		for _, repo := range dir.Repos {
+			if err, ok := storeErrs[repo.FullRepoName]; ok {
+				logger.Errorf("Failed to store the results of %s: %v", repo.FullRepoName, err)
+			}
 		}
 	}
 
@@ -171,6 +222,40 @@ func runE(c *cobra.Command, args []string) error {
 	return nil
 }
 
+// executeInRepo runs the command in the working copy of a single repo, recording the outcome in the results directory.
+// Any failure to record the outcome is returned for the caller to log.
+func executeInRepo(dir *campaign.Campaign, repo campaign.Repo, args []string, execActivity *logging.Activity) (outcome, error) {
+	repoDirPath := repo.FullRepoPath() // i.e. work/org/repo
+
+	// skip if the working copy does not exist
+	if _, err := os.Stat(repoDirPath); os.IsNotExist(err) {
+		execActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
+		return skipped, nil
+	}
+
+	err := exec.Execute(execActivity.Writer(), repoDirPath, args[0], args[1:]...)
+
+	if stateErr := dir.State.Update(repo.FullRepoName, func(r *state.RepoState) {
+		r.LastForeach = &state.Foreach{
+			Command:   formatArguments(args),
+			Succeeded: err == nil,
+			At:        time.Now().UTC(),
+		}
+	}); stateErr != nil {
+		execActivity.Logf("Unable to record the state of %s: %v", repo.FullRepoName, stateErr)
+	}
+
+	if err != nil {
+		storeErr := emitOutcomeToFiles(repo, failedReposFileName, failedResultsDirectory, execActivity.Logs())
+		execActivity.EndWithFailure(err)
+		return errored, storeErr
+	}
+
+	storeErr := emitOutcomeToFiles(repo, successfulReposFileName, successfulResultsDirectory, execActivity.Logs())
+	execActivity.EndWithSuccessAndEmitLogs()
+	return succeeded, storeErr
+}
+
 // sets up a temporary directory to store success/failure logs etc
 func setupOutputFiles(campaignName string, command string, logger *logging.Logger) {
 	overallResultsDirectory, _ = os.MkdirTemp("", fmt.Sprintf("turbolift-foreach-%s-", campaignName))
@@ -204,27 +289,44 @@ func setupOutputFiles(campaignName string, command string, logger *logging.Logge
 	_, _ = fmt.Fprintf(failedReposFile, "# This file contains the list of repositories that failed to be processed by turbolift foreach\n# for the command: %s\n", command)
 }
 
-func emitOutcomeToFiles(repo campaign.Repo, reposFileName string, logsDirectoryParent string, executionLogs string, logger *logging.Logger) {
+// guards the repos files, which may be appended to by several executions at once
+var reposFileMutex sync.Mutex
+
+func emitOutcomeToFiles(repo campaign.Repo, reposFileName string, logsDirectoryParent string, executionLogs string) error {
+	reposFileMutex.Lock()
+	defer reposFileMutex.Unlock()
+
+	var errs []error
+
 	// write the repo name to the repos file
-	reposFile, _ := os.OpenFile(reposFileName, os.O_RDWR|os.O_APPEND, 0644)
-	defer closeWithWarning(reposFile, "reposFile", logger)
-	_, err := reposFile.WriteString(repo.FullRepoName + "\n")
-	if err != nil {
-		logger.Errorf("Failed to write repo name to %s: %s", reposFile.Name(), err)
+	if reposFile, err := os.OpenFile(reposFileName, os.O_RDWR|os.O_APPEND, 0644); err != nil {
+		errs = append(errs, fmt.Errorf("failed to open %s: %w", reposFileName, err))
+	} else {
+		if _, err := reposFile.WriteString(repo.FullRepoName + "\n"); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write repo name to %s: %w", reposFileName, err))
+		}
+		if err := reposFile.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", reposFileName, err))
+		}
 	}
 
 	// write logs to a file under the logsParent directory, in a directory structure that mirrors that of the work directory
 	logsDir := path.Join(logsDirectoryParent, repo.FullRepoName)
 	logsFile := path.Join(logsDir, "logs.txt")
-	err = os.MkdirAll(logsDir, 0755)
-	if err != nil {
-		logger.Errorf("Failed to create directory %s: %s", logsDir, err)
+	if err := os.MkdirAll(logsDir, 0755); err != nil {
+		errs = append(errs, fmt.Errorf("failed to create directory %s: %w", logsDir, err))
 	}
 
-	logs, _ := os.Create(logsFile)
-	defer closeWithWarning(logs, "logs", logger)
-	_, err = logs.WriteString(executionLogs)
-	if err != nil {
-		logger.Errorf("Failed to write logs to %s: %s", logsFile, err)
+	if logs, err := os.Create(logsFile); err != nil {
+		errs = append(errs, fmt.Errorf("failed to create %s: %w", logsFile, err))
+	} else {
+		if _, err := logs.WriteString(executionLogs); err != nil {
+			errs = append(errs, fmt.Errorf("failed to write logs to %s: %w", logsFile, err))
+		}
+		if err := logs.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("failed to close %s: %w", logsFile, err))
+		}
 	}
+
+	return errors.Join(errs...)
 }
@@ -17,11 +17,14 @@ package foreach
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path"
 	"regexp"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -126,6 +129,80 @@ func TestItContinuesOnAndRecordsFailures(t *testing.T) {
 	})
 }
 
+func TestItRunsCommandInParallel(t *testing.T) {
+	fakeExecutor := executor.NewAlternatingSuccessFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3", "org/repo4")
+	_ = os.Remove("work/org/repo4")
+
+	out, err := runCommand("--parallel", "2", "--", "some", "command")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Running against up to 2 repos at a time")
+	assert.Contains(t, out, "turbolift foreach completed with errors")
+	assert.Contains(t, out, "2 OK, 1 skipped, 1 errored")
+	assert.Contains(t, out, "Executing { some command } in work/org/repo1")
+	assert.Contains(t, out, "Executing { some command } in work/org/repo2")
+	assert.Contains(t, out, "Executing { some command } in work/org/repo3")
+
+	fakeExecutor.AssertCalledWithInAnyOrder(t, [][]string{
+		{"work/org/repo1", "some", "command"},
+		{"work/org/repo2", "some", "command"},
+		{"work/org/repo3", "some", "command"},
+	})
+
+	resultsDir, err := os.Readlink(".turbolift_previous_results")
+	assert.NoError(t, err)
+	successfulRepos, err := os.ReadFile(path.Join(resultsDir, "successful", "repos.txt"))
+	assert.NoError(t, err)
+	failedRepos, err := os.ReadFile(path.Join(resultsDir, "failed", "repos.txt"))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(string(successfulRepos), "org/repo"))
+	assert.Equal(t, 1, strings.Count(string(failedRepos), "org/repo"))
+	assert.NotContains(t, string(successfulRepos)+string(failedRepos), "org/repo4")
+}
+
+func TestItRunsReposAtTheSameTime(t *testing.T) {
+	// each execution waits for the other to start, so both succeed only if they run at the same time
+	var started sync.WaitGroup
+	started.Add(2)
+	fakeExecutor := executor.NewFakeExecutor(func(string, string, ...string) error {
+		started.Done()
+		allStarted := make(chan struct{})
+		go func() {
+			started.Wait()
+			close(allStarted)
+		}()
+		select {
+		case <-allStarted:
+			return nil
+		case <-time.After(5 * time.Second):
+			return errors.New("ran alone")
+		}
+	}, func(string, string, ...string) (string, error) {
+		return "", nil
+	})
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand("--parallel", "2", "--", "some", "command")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "2 OK, 0 skipped")
+}
+
+func TestItRejectsParallelismBelowOne(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	exec = fakeExecutor
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	_, err := runCommand("--parallel", "0", "--", "some", "command")
+	assert.EqualError(t, err, "--parallel must be at least 1")
+
+	fakeExecutor.AssertCalledWith(t, [][]string{})
+}
+
 func TestHelpFlagReturnsUsage(t *testing.T) {
 	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
 	exec = fakeExecutor
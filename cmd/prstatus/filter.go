@@ -0,0 +1,154 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package prstatus
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// The values accepted by each filter, mapped to the value in the report that they match
+var (
+	stateFilterValues = map[string]string{
+		"open":    "OPEN",
+		"closed":  "CLOSED",
+		"merged":  "MERGED",
+		"skipped": "SKIPPED",
+		"no_pr":   "NO_PR",
+	}
+	checksFilterValues = map[string]string{
+		"passing": "SUCCESS",
+		"failing": "FAILURE",
+		"pending": "PENDING",
+	}
+	reviewFilterValues = map[string]string{
+		"approved":          "APPROVED",
+		"changes_requested": "CHANGES_REQUESTED",
+		"review_required":   "REVIEW_REQUIRED",
+		"none":              "",
+	}
+)
+
+// prFilter picks out the repos whose PRs match all of the given filters. A filter with several values matches any of
+// them, and an empty filter matches everything.
+type prFilter struct {
+	states  map[string]bool
+	checks  map[string]bool
+	reviews map[string]bool
+}
+
+func newPrFilter(states []string, checks []string, reviews []string) (prFilter, error) {
+	var f prFilter
+	var err error
+	if f.states, err = filterValues("--state", states, stateFilterValues); err != nil {
+		return f, err
+	}
+	if f.checks, err = filterValues("--checks", checks, checksFilterValues); err != nil {
+		return f, err
+	}
+	if f.reviews, err = filterValues("--review", reviews, reviewFilterValues); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func filterValues(flag string, given []string, accepted map[string]string) (map[string]bool, error) {
+	if len(given) == 0 {
+		return nil, nil
+	}
+
+	values := map[string]bool{}
+	for _, value := range given {
+		reportValue, ok := accepted[strings.ToLower(value)]
+		if !ok {
+			var names []string
+			for name := range accepted {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return nil, fmt.Errorf("unknown value %s for %s: use one of %s", value, flag, strings.Join(names, ", "))
+		}
+		values[reportValue] = true
+	}
+	return values, nil
+}
+
+// describeFilters describes the filters as they were given on the command line
+func describeFilters(states []string, checks []string, reviews []string) string {
+	var description []string
+	for _, state := range states {
+		description = append(description, "--state", state)
+	}
+	for _, check := range checks {
+		description = append(description, "--checks", check)
+	}
+	for _, review := range reviews {
+		description = append(description, "--review", review)
+	}
+	if len(description) == 0 {
+		return "none"
+	}
+	return strings.Join(description, " ")
+}
+
+func (f prFilter) matches(repo repoReport) bool {
+	return (f.states == nil || f.states[repo.State]) &&
+		(f.checks == nil || f.checks[repo.Checks.Status]) &&
+		(f.reviews == nil || f.reviews[repo.ReviewDecision])
+}
+
+// apply narrows a report down to the repos that match the filter, counting only those in the summary and reactions
+func (f prFilter) apply(r report) report {
+	filtered := report{Repos: []repoReport{}, Reactions: map[string]int{}}
+	for _, repo := range r.Repos {
+		if !f.matches(repo) {
+			continue
+		}
+
+		filtered.Repos = append(filtered.Repos, repo)
+		filtered.Summary.Total++
+		switch repo.State {
+		case "MERGED":
+			filtered.Summary.Merged++
+		case "OPEN":
+			filtered.Summary.Open++
+		case "CLOSED":
+			filtered.Summary.Closed++
+		case "SKIPPED":
+			filtered.Summary.Skipped++
+		case "NO_PR":
+			filtered.Summary.NoPr++
+		}
+		for reaction, count := range repo.Reactions {
+			filtered.Reactions[reaction] += count
+		}
+	}
+	return filtered
+}
+
+// writeReposFile writes the repos in a report to a file in the same format as repos.txt, so that other commands can
+// be run against just those repos with --repos
+func writeReposFile(filename string, r report, description string) error {
+	var sb strings.Builder
+	sb.WriteString("# This file contains the list of repositories whose PRs matched turbolift pr-status\n")
+	sb.WriteString(fmt.Sprintf("# with the filters: %s\n", description))
+	for _, repo := range r.Repos {
+		sb.WriteString(repo.Repository + "\n")
+	}
+	return os.WriteFile(filename, []byte(sb.String()), 0644)
+}
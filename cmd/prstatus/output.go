@@ -0,0 +1,150 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package prstatus
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+// Output formats for pr-status
+const (
+	outputTable = "table"
+	outputJson  = "json"
+	outputCsv   = "csv"
+)
+
+// report is the machine-readable form of the status of a campaign's PRs
+type report struct {
+	Repos     []repoReport   `json:"repos"`
+	Summary   summaryReport  `json:"summary"`
+	Reactions map[string]int `json:"reactions"`
+}
+
+type repoReport struct {
+	Repository     string         `json:"repository"`
+	Number         int            `json:"number,omitempty"`
+	Url            string         `json:"url,omitempty"`
+	State          string         `json:"state"`
+	ReviewDecision string         `json:"reviewDecision,omitempty"`
+	Mergeable      string         `json:"mergeable,omitempty"`
+	HasConflicts   bool           `json:"hasConflicts"`
+	Checks         checksReport   `json:"checks"`
+	Reactions      map[string]int `json:"reactions"`
+	// Error is why the PR of a SKIPPED repo could not be looked up
+	Error string `json:"error,omitempty"`
+}
+
+// checksReport is the overall status of the checks of a PR, along with the number of checks in each state and which
+// checks have failed or are yet to complete
+type checksReport struct {
+	Status        string        `json:"status"`
+	Passed        int           `json:"passed"`
+	Failed        int           `json:"failed"`
+	Pending       int           `json:"pending"`
+	FailingChecks []checkReport `json:"failingChecks"`
+	PendingChecks []checkReport `json:"pendingChecks"`
+}
+
+type checkReport struct {
+	Name string `json:"name"`
+	Url  string `json:"url,omitempty"`
+}
+
+type summaryReport struct {
+	Merged  int `json:"merged"`
+	Open    int `json:"open"`
+	Closed  int `json:"closed"`
+	Skipped int `json:"skipped"`
+	NoPr    int `json:"noPr"`
+	Total   int `json:"total"`
+}
+
+func writeJson(w io.Writer, r report) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// writeCsv writes a row for each repo, followed by a blank line and the summary counts
+func writeCsv(w io.Writer, r report) error {
+	writer := csv.NewWriter(w)
+
+	_ = writer.Write([]string{"repository", "number", "url", "state", "review_decision", "mergeable", "has_conflicts",
+		"checks", "checks_passed", "checks_failed", "checks_pending", "failing_checks", "failing_check_urls",
+		"pending_checks", "reactions", "error"})
+	for _, repo := range r.Repos {
+		number := ""
+		if repo.Number != 0 {
+			number = fmt.Sprint(repo.Number)
+		}
+		_ = writer.Write([]string{repo.Repository, number, repo.Url, repo.State, repo.ReviewDecision, repo.Mergeable,
+			fmt.Sprint(repo.HasConflicts), repo.Checks.Status, fmt.Sprint(repo.Checks.Passed), fmt.Sprint(repo.Checks.Failed),
+			fmt.Sprint(repo.Checks.Pending), checkNames(repo.Checks.FailingChecks, ";"), checkUrls(repo.Checks.FailingChecks),
+			checkNames(repo.Checks.PendingChecks, ";"), formatReactions(repo.Reactions), repo.Error})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintln(w); err != nil {
+		return err
+	}
+	_ = writer.Write([]string{"state", "count"})
+	_ = writer.Write([]string{"MERGED", fmt.Sprint(r.Summary.Merged)})
+	_ = writer.Write([]string{"OPEN", fmt.Sprint(r.Summary.Open)})
+	_ = writer.Write([]string{"CLOSED", fmt.Sprint(r.Summary.Closed)})
+	_ = writer.Write([]string{"SKIPPED", fmt.Sprint(r.Summary.Skipped)})
+	_ = writer.Write([]string{"NO_PR", fmt.Sprint(r.Summary.NoPr)})
+	_ = writer.Write([]string{"TOTAL", fmt.Sprint(r.Summary.Total)})
+	writer.Flush()
+	return writer.Error()
+}
+
+// checkNames joins the names of some checks with a separator
+func checkNames(checks []checkReport, sep string) string {
+	var names []string
+	for _, check := range checks {
+		names = append(names, check.Name)
+	}
+	return strings.Join(names, sep)
+}
+
+// checkUrls lists the links to some checks in a single CSV field, in the same order as checkNames
+func checkUrls(checks []checkReport) string {
+	var urls []string
+	for _, check := range checks {
+		urls = append(urls, check.Url)
+	}
+	return strings.Join(urls, ";")
+}
+
+// formatReactions lists reactions in a single CSV field, e.g. THUMBS_UP=3;ROCKET=1
+func formatReactions(reactions map[string]int) string {
+	var formatted []string
+	for _, key := range github.ReactionsOrder {
+		if reactions[key] > 0 {
+			formatted = append(formatted, fmt.Sprintf("%s=%d", key, reactions[key]))
+		}
+	}
+	return strings.Join(formatted, ";")
+}
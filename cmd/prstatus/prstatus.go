@@ -16,10 +16,10 @@
 package prstatus
 
 import (
+	"errors"
 	"fmt"
-	"os"
-	"path"
 	"strings"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/rodaine/table"
@@ -28,51 +28,68 @@ import (
 	"github.com/skyscanner/turbolift/internal/campaign"
 	"github.com/skyscanner/turbolift/internal/github"
 	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/state"
+	"github.com/skyscanner/turbolift/internal/tracking"
 )
 
-var reactionsOrder = []string{
-	"THUMBS_UP",
-	"THUMBS_DOWN",
-	"LAUGH",
-	"HOORAY",
-	"CONFUSED",
-	"HEART",
-	"ROCKET",
-	"EYES",
-}
-
-var reactionsMapping = map[string]string{
-	"THUMBS_UP":   "👍",
-	"THUMBS_DOWN": "👎",
-	"LAUGH":       "😆",
-	"HOORAY":      "🎉",
-	"CONFUSED":    "😕",
-	"HEART":       "❤️",
-	"ROCKET":      "🚀",
-	"EYES":        "👀",
-}
-
-var gh github.GitHub = github.NewRealGitHub()
+var gh github.GitHub = github.NewGitHub()
 
 var (
-	list     bool
-	repoFile string
+	list          bool
+	repoFile      string
+	outputFormat  string
+	watchMode     bool
+	watchInterval time.Duration
+	stateFilter   []string
+	checksFilter  []string
+	reviewFilter  []string
+	writeRepos    string
 )
 
 func NewPrStatusCmd() *cobra.Command {
 	cmd := &cobra.Command{
 		Use:   "pr-status",
 		Short: "Displays the status of PRs",
-		Run:   run,
+		RunE:  runE,
 	}
 	cmd.Flags().BoolVar(&list, "list", false, "Displays a listing by PR")
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
+	cmd.Flags().StringVarP(&outputFormat, "output", "o", outputTable, "Output format: table, json or csv. json and csv are written to stdout, with progress on stderr.")
+	cmd.Flags().BoolVar(&watchMode, "watch", false, "Keep polling the status of PRs and redraw it, noting what has changed since the last poll.")
+	cmd.Flags().DurationVar(&watchInterval, "interval", time.Minute, "How often to poll the status of PRs when watching.")
+	cmd.Flags().StringSliceVar(&stateFilter, "state", nil, "Only show PRs in this state: open, closed, merged, skipped or no_pr. May be repeated or comma-separated.")
+	cmd.Flags().StringSliceVar(&checksFilter, "checks", nil, "Only show PRs whose checks are: passing, failing or pending. May be repeated or comma-separated.")
+	cmd.Flags().StringSliceVar(&reviewFilter, "review", nil, "Only show PRs with this review decision: approved, changes_requested, review_required or none. May be repeated or comma-separated.")
+	cmd.Flags().StringVar(&writeRepos, "write-repos", "", "Write the repos whose PRs are shown to this file, in the same format as repos.txt, for use with --repos.")
 
 	return cmd
 }
 
-func run(c *cobra.Command, _ []string) {
-	logger := logging.NewLogger(c)
+func runE(c *cobra.Command, _ []string) error {
+	var logger *logging.Logger
+	switch outputFormat {
+	case outputTable:
+		logger = logging.NewLogger(c)
+	case outputJson, outputCsv:
+		logger = logging.NewStderrLogger(c)
+	default:
+		return fmt.Errorf("unknown output format %s: use table, json or csv", outputFormat)
+	}
+	if watchMode && outputFormat != outputTable {
+		return errors.New("--watch can only be used with table output")
+	}
+	if watchMode && watchInterval <= 0 {
+		return errors.New("--interval must be positive")
+	}
+	if watchMode && writeRepos != "" {
+		return errors.New("--write-repos cannot be used with --watch")
+	}
+	filter, err := newPrFilter(stateFilter, checksFilter, reviewFilter)
+	if err != nil {
+		return err
+	}
+	// errors from here on are not down to how the command was used, and usage would only get mixed into the output
+	c.SilenceUsage = true
 
 	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
 
@@ -81,72 +98,221 @@ func run(c *cobra.Command, _ []string) {
 	dir, err := campaign.OpenCampaign(options)
 	if err != nil {
 		readCampaignActivity.EndWithFailure(err)
-		return
+		return err
 	}
 	readCampaignActivity.EndWithSuccess()
 
-	statuses := make(map[string]int)
-	reactions := make(map[string]int)
+	if watchMode {
+		watch(logger, dir, filter)
+		return nil
+	}
+
+	r, snapshot, err := fetchReport(logger, dir)
+	if err != nil {
+		return err
+	}
+	recordReport(logger, dir, snapshot)
+	r = filter.apply(r)
+
+	logger.Successf("turbolift pr-status completed\n")
+
+	switch outputFormat {
+	case outputJson:
+		err = writeJson(c.OutOrStdout(), r)
+	case outputCsv:
+		err = writeCsv(c.OutOrStdout(), r)
+	default:
+		printTables(logger, r, nil)
+	}
+	if err != nil {
+		return err
+	}
 
-	detailsTable := table.New("Repository", "State", "Reviews", "Checks status", "URL")
-	detailsTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
-	detailsTable.WithFirstColumnFormatter(color.New(color.FgCyan).SprintfFunc())
-	detailsTable.WithWriter(logger.Writer())
+	if writeRepos != "" {
+		if err := writeReposFile(writeRepos, r, describeFilters(stateFilter, checksFilter, reviewFilter)); err != nil {
+			return fmt.Errorf("unable to write repos to %s: %w", writeRepos, err)
+		}
+		logger.Printf("Names of %d matching repos have been written to %s. Use --repos %s to run further commands against these repos", len(r.Repos), writeRepos, writeRepos)
+	}
+	return nil
+}
 
+// fetchReport looks up the PRs of all the repos in a campaign, and records what it finds in the campaign state. It
+// also gives a snapshot of the PRs for recordReport.
+func fetchReport(logger *logging.Logger, dir *campaign.Campaign) (report, state.Snapshot, error) {
+	r := report{Repos: []repoReport{}, Reactions: map[string]int{}}
+	snapshot := state.Snapshot{At: time.Now().UTC(), Repos: map[string]state.PrSnapshot{}}
+
+	fetchActivity := logger.StartActivity("Fetching PRs for %d repos", len(dir.Repos))
+	var fullRepoNames []string
 	for _, repo := range dir.Repos {
-		repoDirPath := path.Join("work", repo.OrgName, repo.RepoName) // i.e. work/org/repo
+		fullRepoNames = append(fullRepoNames, repo.FullRepoName)
+	}
+	prStatuses, lookupErrs, err := gh.GetPRs(fetchActivity.Writer(), fullRepoNames, dir.Name)
+	if err != nil {
+		fetchActivity.EndWithFailure(err)
+		return r, snapshot, err
+	}
+	if len(lookupErrs) > 0 {
+		fetchActivity.EndWithWarningf("Unable to get the PRs of %d repos", len(lookupErrs))
+	} else {
+		fetchActivity.EndWithSuccess()
+	}
 
+	for _, repo := range dir.Repos {
 		checkStatusActivity := logger.StartActivity("Checking PR status for %s", repo.FullRepoName)
+		r.Summary.Total++
 
-		// skip if the working copy does not exist
-		if _, err = os.Stat(repoDirPath); os.IsNotExist(err) {
-			checkStatusActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repoDirPath)
-			statuses["SKIPPED"]++
+		// a repo whose PR could not be looked up is left out of the state and history, rather than taken to have no PR
+		if lookupErr, ok := lookupErrs[repo.FullRepoName]; ok {
+			checkStatusActivity.EndWithFailure(lookupErr)
+			r.Summary.Skipped++
+			r.Repos = append(r.Repos, repoReport{Repository: repo.FullRepoName, State: "SKIPPED", Error: lookupErr.Error(), Checks: summariseChecks(nil), Reactions: map[string]int{}})
 			continue
 		}
 
-		prStatus, err := gh.GetPR(checkStatusActivity.Writer(), repoDirPath, dir.Name)
-		if err != nil {
-			checkStatusActivity.EndWithFailuref("No PR found: %v", err)
-			statuses["NO_PR"]++
+		prStatus, ok := prStatuses[repo.FullRepoName]
+		if !ok {
+			checkStatusActivity.EndWithFailuref("No PR found for branch %s", dir.Name)
+			r.Summary.NoPr++
+			r.Repos = append(r.Repos, repoReport{Repository: repo.FullRepoName, State: "NO_PR", Checks: summariseChecks(nil), Reactions: map[string]int{}})
+			snapshot.Repos[repo.FullRepoName] = state.PrSnapshot{State: "NO_PR"}
 			continue
 		}
 
-		statuses[prStatus.State]++
+		switch prStatus.State {
+		case "MERGED":
+			r.Summary.Merged++
+		case "OPEN":
+			r.Summary.Open++
+		case "CLOSED":
+			r.Summary.Closed++
+		}
 
-		for _, reaction := range prStatus.ReactionGroups {
-			reactions[reaction.Content] += reaction.Users.TotalCount
+		if err := dir.State.Update(repo.FullRepoName, func(rs *state.RepoState) {
+			rs.PrNumber = prStatus.Number
+			rs.PrUrl = prStatus.Url
+			rs.PrState = prStatus.State
+		}); err != nil {
+			checkStatusActivity.Logf("Unable to record the state of %s: %v", repo.FullRepoName, err)
 		}
 
-		failedCheck := false
-		pendingCheck := false
-		for _, check := range prStatus.StatusCheckRollup {
-			if strings.Contains(check.State, "FAILURE") {
-				failedCheck = true
-			} else if strings.Contains(check.State, "PENDING") {
-				pendingCheck = true
+		repoReactions := map[string]int{}
+		for _, reaction := range prStatus.ReactionGroups {
+			if reaction.Users.TotalCount > 0 {
+				repoReactions[reaction.Content] += reaction.Users.TotalCount
+				r.Reactions[reaction.Content] += reaction.Users.TotalCount
 			}
 		}
 
-		checksStatus := "SUCCESS"
-		if failedCheck {
-			checksStatus = "FAILURE"
-		} else if pendingCheck {
-			checksStatus = "PENDING"
+		prReport := repoReport{
+			Repository:     repo.FullRepoName,
+			Number:         prStatus.Number,
+			Url:            prStatus.Url,
+			State:          prStatus.State,
+			ReviewDecision: prStatus.ReviewDecision,
+			Mergeable:      prStatus.Mergeable,
+			HasConflicts:   prStatus.Mergeable == "CONFLICTING",
+			Checks:         summariseChecks(prStatus.StatusCheckRollup),
+			Reactions:      repoReactions,
+		}
+		r.Repos = append(r.Repos, prReport)
+
+		snapshot.Repos[repo.FullRepoName] = state.PrSnapshot{
+			State:          prStatus.State,
+			Number:         prStatus.Number,
+			Url:            prStatus.Url,
+			ReviewDecision: prStatus.ReviewDecision,
+			Checks:         prReport.Checks.Status,
+			CreatedAt:      state.OptionalTime(prStatus.CreatedAt),
+			MergedAt:       state.OptionalTime(prStatus.MergedAt),
+			ClosedAt:       state.OptionalTime(prStatus.ClosedAt),
+			FirstReviewAt:  state.OptionalTime(prStatus.FirstReviewedAt()),
+			Reactions:      repoReactions,
 		}
-
-		detailsTable.AddRow(repo.FullRepoName, prStatus.State, prStatus.ReviewDecision, checksStatus, prStatus.Url)
 
 		checkStatusActivity.EndWithSuccess()
 	}
 
-	logger.Successf("turbolift pr-status completed\n")
+	return r, snapshot, nil
+}
+
+// recordReport adds a snapshot of the PRs to the campaign history, and brings the campaign's tracking issue up to date
+// if it has one
+func recordReport(logger *logging.Logger, dir *campaign.Campaign, snapshot state.Snapshot) {
+	if err := state.RecordSnapshot(state.DefaultHistoryFilename, snapshot); err != nil {
+		logger.Warnf("Unable to record the history of the campaign: %v", err)
+	}
+
+	if issue := dir.State.GetTrackingIssue(); issue != nil {
+		syncActivity := logger.StartActivity("Updating tracking issue %s", issue.Url)
+		if _, err := tracking.Sync(syncActivity.Writer(), gh, dir); err != nil {
+			syncActivity.EndWithFailure(err)
+		} else {
+			syncActivity.EndWithSuccess()
+		}
+	}
+}
 
+// summariseChecks counts the checks of a PR in each state, and notes which have failed or are pending. Checks that
+// finished in any state other than a passing one, such as TIMED_OUT or CANCELLED, have failed. Their overall status is
+// FAILURE if any have failed, otherwise PENDING if any are yet to complete.
+func summariseChecks(checks []github.StatusCheckRollup) checksReport {
+	summary := checksReport{FailingChecks: []checkReport{}, PendingChecks: []checkReport{}}
+	for _, check := range checks {
+		switch {
+		case check.Passed():
+			summary.Passed++
+		case check.Pending():
+			summary.Pending++
+			summary.PendingChecks = append(summary.PendingChecks, checkReport{Name: check.Name, Url: check.Url})
+		default:
+			summary.Failed++
+			summary.FailingChecks = append(summary.FailingChecks, checkReport{Name: check.Name, Url: check.Url})
+		}
+	}
+
+	if len(checks) == 0 {
+		return summary
+	}
+	summary.Status = "SUCCESS"
+	if summary.Failed > 0 {
+		summary.Status = "FAILURE"
+	} else if summary.Pending > 0 {
+		summary.Status = "PENDING"
+	}
+	return summary
+}
+
+// printTables prints the summary of a campaign's PRs, along with the listing by PR if requested. Repos in changed
+// are marked in the listing.
+func printTables(logger *logging.Logger, r report, changed map[string]bool) {
 	logger.Println()
 
 	if list {
+		detailsTable := table.New("Repository", "State", "Reviews", "Checks status", "Conflicts", "Failing checks", "Pending checks", "URL")
+		detailsTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+		detailsTable.WithFirstColumnFormatter(color.New(color.FgCyan).SprintfFunc())
+		detailsTable.WithWriter(logger.Writer())
+		for _, repo := range r.Repos {
+			if repo.State == "NO_PR" {
+				continue
+			}
+			name := repo.Repository
+			if changed[repo.Repository] {
+				name += " *"
+			}
+			conflicts := ""
+			if repo.HasConflicts {
+				conflicts = "CONFLICTING"
+			}
+			detailsTable.AddRow(name, repo.State, repo.ReviewDecision, repo.Checks.Status, conflicts,
+				checkNames(repo.Checks.FailingChecks, ", "), checkNames(repo.Checks.PendingChecks, ", "), repo.Url)
+		}
 		detailsTable.Print()
 		logger.Println()
+
+		printFailingCheckLinks(logger, r)
 	}
 
 	summaryTable := table.New("State", "Count")
@@ -154,23 +320,47 @@ func run(c *cobra.Command, _ []string) {
 	summaryTable.WithFirstColumnFormatter(color.New(color.FgCyan).SprintfFunc())
 	summaryTable.WithWriter(logger.Writer())
 
-	summaryTable.AddRow("Merged", statuses["MERGED"])
-	summaryTable.AddRow("Open", statuses["OPEN"])
-	summaryTable.AddRow("Closed", statuses["CLOSED"])
-	summaryTable.AddRow("Skipped", statuses["SKIPPED"])
-	summaryTable.AddRow("No PR Found", statuses["NO_PR"])
+	summaryTable.AddRow("Merged", r.Summary.Merged)
+	summaryTable.AddRow("Open", r.Summary.Open)
+	summaryTable.AddRow("Closed", r.Summary.Closed)
+	summaryTable.AddRow("Skipped", r.Summary.Skipped)
+	summaryTable.AddRow("No PR Found", r.Summary.NoPr)
 
 	summaryTable.Print()
 
 	logger.Println()
 
 	var reactionsOutput []string
-	for _, key := range reactionsOrder {
-		if reactions[key] > 0 {
-			reactionsOutput = append(reactionsOutput, fmt.Sprintf("%s %d", reactionsMapping[key], reactions[key]))
+	for _, key := range github.ReactionsOrder {
+		if r.Reactions[key] > 0 {
+			reactionsOutput = append(reactionsOutput, fmt.Sprintf("%s %d", github.ReactionEmoji[key], r.Reactions[key]))
 		}
 	}
 	if len(reactionsOutput) > 0 {
 		logger.Println("Reactions:", strings.Join(reactionsOutput, "   "))
 	}
 }
+
+// printFailingCheckLinks lists where to find out why the checks of open PRs have failed
+func printFailingCheckLinks(logger *logging.Logger, r report) {
+	var links []string
+	for _, repo := range r.Repos {
+		if repo.State != "OPEN" {
+			continue
+		}
+		for _, check := range repo.Checks.FailingChecks {
+			if check.Url != "" {
+				links = append(links, fmt.Sprintf("  %s %s: %s", repo.Repository, check.Name, check.Url))
+			}
+		}
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	logger.Println("Failing checks:")
+	for _, link := range links {
+		logger.Println(link)
+	}
+	logger.Println()
+}
@@ -17,13 +17,19 @@ package prstatus
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/skyscanner/turbolift/internal/campaign"
 	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/state"
 	"github.com/skyscanner/turbolift/internal/testsupport"
 )
 
@@ -72,7 +78,21 @@ func TestItLogsDetailedInformation(t *testing.T) {
 	assert.Regexp(t, "org/repo6\\s+OPEN\\s+REVIEW_REQUIRED\\s+PENDING", out)
 }
 
-func TestItSkipsUnclonedRepos(t *testing.T) {
+func TestItListsFailingChecksAndConflicts(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo4", "org/repo5")
+
+	out, err := runCommand(true)
+	assert.NoError(t, err)
+
+	assert.Regexp(t, "org/repo1\\s+OPEN\\s+REVIEW_REQUIRED\\s+FAILURE\\s+build\\s*\\n", out)
+	assert.Regexp(t, "org/repo5\\s+OPEN\\s+REVIEW_REQUIRED\\s+FAILURE\\s+CONFLICTING\\s+test\\s+deploy", out)
+	assert.Contains(t, out, "Failing checks:\n  org/repo1 build: https://ci.example.com/repo1/build\n")
+	assert.NotContains(t, out, "org/repo5 test:")
+}
+
+func TestItReportsOnReposThatHaveNotBeenCloned(t *testing.T) {
 	prepareFakeResponses()
 
 	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
@@ -80,32 +100,336 @@ func TestItSkipsUnclonedRepos(t *testing.T) {
 
 	out, err := runCommand(true)
 	assert.NoError(t, err)
-	// Should still show summary info
 	assert.Regexp(t, "Open\\s+1", out)
-	assert.Regexp(t, "Merged\\s+0", out)
-	assert.Regexp(t, "Skipped\\s+1", out)
+	assert.Regexp(t, "Merged\\s+1", out)
 	assert.Regexp(t, "No PR Found\\s+0", out)
 
 	assert.Regexp(t, "org/repo1\\s+OPEN", out)
-	assert.NotRegexp(t, "org/repo2\\s+MERGED", out)
+	assert.Regexp(t, "org/repo2\\s+MERGED", out)
+}
+
+func TestItLooksUpAllPrsInOneCall(t *testing.T) {
+	prepareFakeResponses()
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	_, err := runCommand(false)
+	assert.NoError(t, err)
+
+	gh.(*github.FakeGitHub).AssertCalledWith(t, [][]string{
+		{"get_prs", campaign.ApplyCampaignNamePrefix(filepath.Base(tempDir)), "org/repo1", "org/repo2"},
+	})
+}
+
+func TestItRecordsASnapshotOfThePrsInTheCampaignHistory(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repoWithoutPr")
+
+	_, err := runCommand(false)
+	assert.NoError(t, err)
+	_, err = runCommand(false)
+	assert.NoError(t, err)
+
+	history, err := state.LoadHistory(state.DefaultHistoryFilename)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, state.PrSnapshot{
+		State:          "OPEN",
+		ReviewDecision: "REVIEW_REQUIRED",
+		Checks:         "FAILURE",
+		Reactions:      map[string]int{"THUMBS_UP": 3, "ROCKET": 1},
+	}, history[1].Repos["org/repo1"])
+	assert.Equal(t, state.PrSnapshot{State: "NO_PR"}, history[1].Repos["org/repoWithoutPr"])
+}
+
+func TestItKeepsReposLeftOutOfTheReposFileInTheCampaignHistory(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	testsupport.CreateAnotherRepoFile("subset.txt", "org/repo1")
+
+	_, err := runCommand(false)
+	assert.NoError(t, err)
+	_, _, err = runCommandWithArgs("--repos", "subset.txt")
+	assert.NoError(t, err)
+
+	history, err := state.LoadHistory(state.DefaultHistoryFilename)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "OPEN", history[1].Repos["org/repo1"].State)
+	assert.Equal(t, "MERGED", history[1].Repos["org/repo2"].State)
+}
+
+func TestItKeepsTheTrackingIssueInSync(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/repo1" {
+			return &github.PrStatus{Number: 1, Url: "https://github.com/org/repo1/pull/1", State: "MERGED"}, nil
+		}
+		return nil, &github.NoPRFoundError{Path: workingDir}
+	})
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.NoError(t, dir.State.SetTrackingIssue(state.TrackingIssue{Repo: "org/tracking", Number: 5, Url: "https://github.com/org/tracking/issues/5"}))
+
+	out, err := runCommand(false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Updating tracking issue https://github.com/org/tracking/issues/5")
+
+	issue, err := fakeGitHub.GetIssue(nil, "org/tracking", 5)
+	assert.NoError(t, err)
+	assert.Contains(t, issue.Body, "1 of 1 PRs merged.\n\n- [x] org/repo1 https://github.com/org/repo1/pull/1\n")
 }
 
 func TestItNotesReposWhereNoPrCanBeFound(t *testing.T) {
 	prepareFakeResponses()
 
-	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repoWithError")
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repoWithoutPr")
 
 	out, err := runCommand(true)
 	assert.NoError(t, err)
 	// Should still show summary info
 	assert.Regexp(t, "Open\\s+1", out)
 	assert.Regexp(t, "Merged\\s+1", out)
-	assert.Regexp(t, "Skipped\\s+0", out)
 	assert.Regexp(t, "No PR Found\\s+1", out)
 
 	assert.Regexp(t, "org/repo1\\s+OPEN", out)
 }
 
+func TestItReportsReposWhosePrCannotBeLookedUpAsSkipped(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repoWithError")
+
+	out, err := runCommand(true)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Checking PR status for org/repoWithError: Synthetic error")
+	assert.Regexp(t, "Skipped\\s+1", out)
+	assert.Regexp(t, "No PR Found\\s+0", out)
+
+	history, err := state.LoadHistory(state.DefaultHistoryFilename)
+	assert.NoError(t, err)
+	assert.NotContains(t, history[0].Repos, "org/repoWithError")
+}
+
+func TestItWritesJsonToStdout(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repoWithoutPr")
+
+	stdout, stderr, err := runCommandWithArgs("--output", "json")
+	assert.NoError(t, err)
+	assert.Contains(t, stderr, "turbolift pr-status completed")
+
+	var r report
+	assert.NoError(t, json.Unmarshal([]byte(stdout), &r))
+	assert.Equal(t, summaryReport{Merged: 1, Open: 1, NoPr: 1, Total: 3}, r.Summary)
+	assert.Equal(t, map[string]int{"THUMBS_UP": 4, "ROCKET": 1}, r.Reactions)
+	assert.Equal(t, repoReport{
+		Repository:     "org/repo1",
+		State:          "OPEN",
+		ReviewDecision: "REVIEW_REQUIRED",
+		Checks: checksReport{
+			Status:        "FAILURE",
+			Passed:        1,
+			Failed:        1,
+			FailingChecks: []checkReport{{Name: "build", Url: "https://ci.example.com/repo1/build"}},
+			PendingChecks: []checkReport{},
+		},
+		Reactions: map[string]int{"THUMBS_UP": 3, "ROCKET": 1},
+	}, r.Repos[0])
+	assert.Equal(t, repoReport{
+		Repository: "org/repoWithoutPr",
+		State:      "NO_PR",
+		Checks:     checksReport{FailingChecks: []checkReport{}, PendingChecks: []checkReport{}},
+		Reactions:  map[string]int{},
+	}, r.Repos[2])
+}
+
+func TestItWritesCsvToStdout(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repoWithoutPr")
+
+	stdout, _, err := runCommandWithArgs("--output", "csv")
+	assert.NoError(t, err)
+	assert.Equal(t, `repository,number,url,state,review_decision,mergeable,has_conflicts,checks,checks_passed,checks_failed,checks_pending,failing_checks,failing_check_urls,pending_checks,reactions,error
+org/repo1,,,OPEN,REVIEW_REQUIRED,,false,FAILURE,1,1,0,build,https://ci.example.com/repo1/build,,THUMBS_UP=3;ROCKET=1,
+org/repo2,,,MERGED,APPROVED,,false,SUCCESS,2,0,0,,,,THUMBS_UP=1,
+org/repoWithoutPr,,,NO_PR,,,false,,0,0,0,,,,,
+
+state,count
+MERGED,1
+OPEN,1
+CLOSED,0
+SKIPPED,0
+NO_PR,1
+TOTAL,3
+`, stdout)
+}
+
+func TestItCountsChecksThatDidNotPassAsFailing(t *testing.T) {
+	checks := summariseChecks([]github.StatusCheckRollup{
+		{State: "SUCCESS", Name: "build"},
+		{State: "SKIPPED", Name: "deploy"},
+		{State: "TIMED_OUT", Name: "integration"},
+		{State: "CANCELLED", Name: "lint"},
+		{State: "PENDING", Name: "e2e"},
+	})
+
+	assert.Equal(t, "FAILURE", checks.Status)
+	assert.Equal(t, 2, checks.Passed)
+	assert.Equal(t, 2, checks.Failed)
+	assert.Equal(t, 1, checks.Pending)
+	assert.Equal(t, "integration, lint", checkNames(checks.FailingChecks, ", "))
+}
+
+func TestItFailsWhenTheCampaignCannotBeRead(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	stdout, _, err := runCommandWithArgs("--output", "json", "--repos", "missing.txt")
+	assert.Error(t, err)
+	assert.Empty(t, stdout)
+}
+
+func TestItRejectsUnknownOutputFormats(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, _, err := runCommandWithArgs("--output", "yaml")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown output format yaml")
+}
+
+func TestItFiltersPrsAndWritesTheMatchingReposToAFile(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3", "org/repo4", "org/repo5", "org/repo6")
+
+	stdout, _, err := runCommandWithArgs("--list", "--state", "open", "--checks", "failing", "--review", "review_required", "--write-repos", "failing.txt")
+	assert.NoError(t, err)
+	assert.Regexp(t, "org/repo1\\s+OPEN", stdout)
+	assert.Regexp(t, "org/repo5\\s+OPEN", stdout)
+	assert.NotRegexp(t, "org/repo3\\s+CLOSED", stdout)
+	assert.NotRegexp(t, "org/repo4\\s+OPEN", stdout)
+	assert.Regexp(t, "Open\\s+2", stdout)
+	assert.Contains(t, stdout, "Names of 2 matching repos have been written to failing.txt")
+
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = "failing.txt"
+	dir, err := campaign.OpenCampaign(options)
+	assert.NoError(t, err)
+	assert.Len(t, dir.Repos, 2)
+	assert.Equal(t, "org/repo1", dir.Repos[0].FullRepoName)
+	assert.Equal(t, "org/repo5", dir.Repos[1].FullRepoName)
+}
+
+func TestItFiltersOnReposWithoutAPr(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repoWithoutPr")
+
+	stdout, _, err := runCommandWithArgs("--output", "csv", "--state", "no_pr,closed")
+	assert.NoError(t, err)
+	assert.Contains(t, stdout, "org/repoWithoutPr,")
+	assert.NotContains(t, stdout, "org/repo1,")
+	assert.Contains(t, stdout, "TOTAL,1")
+}
+
+func TestItRejectsUnknownFilterValues(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, _, err := runCommandWithArgs("--checks", "red")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown value red for --checks: use one of failing, passing, pending")
+}
+
+func TestItWatchesForChangesToPrs(t *testing.T) {
+	polls := 0
+	gh = github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/repo1" {
+			polls++
+			if polls > 1 {
+				return &github.PrStatus{State: "MERGED", ReviewDecision: "APPROVED"}, nil
+			}
+		}
+		return &github.PrStatus{State: "OPEN", ReviewDecision: "REVIEW_REQUIRED"}, nil
+	})
+	maxWatchPolls = 2
+	sleep = func(time.Duration) {}
+	defer func() {
+		maxWatchPolls = 0
+		sleep = time.Sleep
+	}()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	stdout, _, err := runCommandWithArgs("--watch", "--list", "--interval", "10s")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(stdout, "Every 10s: turbolift pr-status"))
+	assert.Regexp(t, "org/repo1 \\*\\s+MERGED", stdout)
+	assert.NotContains(t, stdout, "org/repo2 *")
+	assert.Contains(t, stdout, "org/repo1: state OPEN -> MERGED, reviews REVIEW_REQUIRED -> APPROVED")
+}
+
+func TestItOnlyRecordsHistoryWhenWatchingFindsChanges(t *testing.T) {
+	polls := 0
+	gh = github.NewFakeGitHub(nil, func(workingDir string) (interface{}, error) {
+		polls++
+		if polls > 1 {
+			return &github.PrStatus{State: "MERGED"}, nil
+		}
+		return &github.PrStatus{State: "OPEN"}, nil
+	})
+	maxWatchPolls = 3
+	sleep = func(time.Duration) {}
+	defer func() {
+		maxWatchPolls = 0
+		sleep = time.Sleep
+	}()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, _, err := runCommandWithArgs("--watch", "--interval", "10s")
+	assert.NoError(t, err)
+
+	history, err := state.LoadHistory(state.DefaultHistoryFilename)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, "OPEN", history[0].Repos["org/repo1"].State)
+	assert.Equal(t, "MERGED", history[1].Repos["org/repo1"].State)
+}
+
+func TestItOnlyWatchesTableOutput(t *testing.T) {
+	prepareFakeResponses()
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	_, _, err := runCommandWithArgs("--watch", "--output", "json")
+	assert.Error(t, err)
+}
+
+func runCommandWithArgs(args ...string) (string, string, error) {
+	cmd := NewPrStatusCmd()
+	outBuffer := bytes.NewBufferString("")
+	errBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	cmd.SetErr(errBuffer)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return outBuffer.String(), errBuffer.String(), err
+}
+
 func runCommand(showList bool) (string, error) {
 	cmd := NewPrStatusCmd()
 	list = showList
@@ -125,9 +449,12 @@ func prepareFakeResponses() {
 			StatusCheckRollup: []github.StatusCheckRollup{
 				{
 					State: "FAILURE",
+					Name:  "build",
+					Url:   "https://ci.example.com/repo1/build",
 				},
 				{
 					State: "SUCCESS",
+					Name:  "lint",
 				},
 			},
 			ReactionGroups: []github.ReactionGroup{
@@ -204,13 +531,16 @@ func prepareFakeResponses() {
 			ReviewDecision: "REVIEW_REQUIRED",
 		},
 		"work/org/repo5": {
-			State: "OPEN",
+			State:     "OPEN",
+			Mergeable: "CONFLICTING",
 			StatusCheckRollup: []github.StatusCheckRollup{
 				{
 					State: "FAILURE",
+					Name:  "test",
 				},
 				{
 					State: "PENDING",
+					Name:  "deploy",
 				},
 			},
 			ReactionGroups: []github.ReactionGroup{
@@ -0,0 +1,131 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package prstatus
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/logging"
+)
+
+var (
+	// sleep and maxWatchPolls are replaced in tests, so that watching finishes promptly
+	sleep         = time.Sleep
+	maxWatchPolls = 0
+)
+
+// clearScreen moves the cursor to the top left of the terminal and clears it
+const clearScreen = "\033[H\033[2J"
+
+// watch polls the status of a campaign's PRs every interval until interrupted, redrawing the tables each time.
+// Repos whose PRs have changed since the previous poll are marked in the listing, and their changes are logged
+// below the tables. Changes are found before the filter is applied, so PRs that have just come to match it are noted.
+// The history and tracking issue are only brought up to date by the first poll and by polls that find changes.
+func watch(logger *logging.Logger, dir *campaign.Campaign, filter prFilter) {
+	var previous *report
+	previousAt := time.Now()
+
+	for poll := 1; maxWatchPolls == 0 || poll <= maxWatchPolls; poll++ {
+		if poll > 1 {
+			sleep(watchInterval)
+		}
+
+		// the progress of each poll would only be cleared away again, so it is not shown
+		pollLogger := logging.NewWriterLogger(io.Discard)
+		r, snapshot, err := fetchReport(pollLogger, dir)
+		now := time.Now()
+
+		if logger.IsTerminal() {
+			_, _ = fmt.Fprint(logger.Writer(), clearScreen)
+		}
+		logger.Printf("Every %s: turbolift pr-status (updated %s, Ctrl-C to stop)", watchInterval, now.Format("15:04:05"))
+
+		if err != nil {
+			logger.Errorf("Unable to refresh PR status: %v", err)
+			continue
+		}
+
+		var changes []string
+		changed := map[string]bool{}
+		if previous != nil {
+			changes, changed = compareReports(*previous, r)
+		}
+		if previous == nil || len(changes) > 0 {
+			recordReport(pollLogger, dir, snapshot)
+		}
+		printTables(logger, filter.apply(r), changed)
+
+		if previous != nil {
+			logger.Printf("Changes since %s:", previousAt.Format("15:04:05"))
+			if len(changes) == 0 {
+				logger.Println("  none")
+			}
+			for _, change := range changes {
+				logger.Println(colors.Yellow("  " + change))
+			}
+		}
+
+		previous = &r
+		previousAt = now
+	}
+}
+
+// compareReports describes how the state, review decision and checks of each repo's PR have changed between two
+// polls, and returns the set of repos that have changed
+func compareReports(before report, after report) ([]string, map[string]bool) {
+	previous := map[string]repoReport{}
+	for _, repo := range before.Repos {
+		previous[repo.Repository] = repo
+	}
+
+	var changes []string
+	changed := map[string]bool{}
+	for _, repo := range after.Repos {
+		old, ok := previous[repo.Repository]
+		if !ok {
+			continue
+		}
+
+		var differences []string
+		if old.State != repo.State {
+			differences = append(differences, fmt.Sprintf("state %s -> %s", old.State, repo.State))
+		}
+		if old.ReviewDecision != repo.ReviewDecision {
+			differences = append(differences, fmt.Sprintf("reviews %s -> %s", orNone(old.ReviewDecision), orNone(repo.ReviewDecision)))
+		}
+		if old.Checks.Status != repo.Checks.Status {
+			differences = append(differences, fmt.Sprintf("checks %s -> %s", orNone(old.Checks.Status), orNone(repo.Checks.Status)))
+		}
+
+		if len(differences) > 0 {
+			changed[repo.Repository] = true
+			changes = append(changes, fmt.Sprintf("%s: %s", repo.Repository, strings.Join(differences, ", ")))
+		}
+	}
+	return changes, changed
+}
+
+func orNone(value string) string {
+	if value == "" {
+		return "NONE"
+	}
+	return value
+}
@@ -0,0 +1,213 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package report
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/skyscanner/turbolift/internal/state"
+)
+
+// campaignReport is what the history of a campaign says about its progress. Summary, Repos and Reactions are as of
+// the latest snapshot, taken At.
+type campaignReport struct {
+	At                      time.Time
+	Summary                 burndownPoint
+	Repos                   []repoRow
+	Reactions               map[string]int
+	Burndown                []burndownPoint
+	Merged                  int
+	MedianTimeToMerge       time.Duration
+	Reviewed                int
+	MedianTimeToFirstReview time.Duration
+	LongestOpen             []openPr
+}
+
+// burndownPoint counts the PRs in each state as of the last snapshot taken on a day
+type burndownPoint struct {
+	Date   string
+	Open   int
+	Merged int
+	Closed int
+	NoPr   int
+	Total  int
+}
+
+type repoRow struct {
+	Repository     string
+	State          string
+	Number         int
+	Url            string
+	ReviewDecision string
+	Checks         string
+}
+
+type openPr struct {
+	Repository string
+	Url        string
+	OpenFor    time.Duration
+}
+
+// repoTimeline is what the history says about a single repo's PR. Where the forge did not report when something
+// happened, the time of the first snapshot that saw it is used instead.
+type repoTimeline struct {
+	latest        state.PrSnapshot
+	createdAt     time.Time
+	mergedAt      time.Time
+	firstReviewAt time.Time
+}
+
+// buildReport works out the burndown and metrics of a campaign from its history, which must not be empty. PRs are
+// counted as open for as long as it has been since they were created until now.
+func buildReport(history []state.Snapshot, now time.Time, top int) campaignReport {
+	r := campaignReport{At: history[len(history)-1].At, Reactions: map[string]int{}}
+
+	timelines := map[string]*repoTimeline{}
+	for _, snapshot := range history {
+		point := burndownPoint{Date: snapshot.At.Local().Format("2006-01-02")}
+		for repo, pr := range snapshot.Repos {
+			point.Total++
+			switch pr.State {
+			case "OPEN":
+				point.Open++
+			case "MERGED":
+				point.Merged++
+			case "CLOSED":
+				point.Closed++
+			case "NO_PR":
+				point.NoPr++
+			}
+
+			timeline, ok := timelines[repo]
+			if !ok {
+				timeline = &repoTimeline{}
+				timelines[repo] = timeline
+			}
+			timeline.latest = pr
+			if pr.State != "NO_PR" && timeline.createdAt.IsZero() {
+				timeline.createdAt = snapshot.At
+			}
+			if pr.State == "MERGED" && timeline.mergedAt.IsZero() {
+				timeline.mergedAt = snapshot.At
+			}
+			if (pr.ReviewDecision == "APPROVED" || pr.ReviewDecision == "CHANGES_REQUESTED") && timeline.firstReviewAt.IsZero() {
+				timeline.firstReviewAt = snapshot.At
+			}
+		}
+
+		if len(r.Burndown) > 0 && r.Burndown[len(r.Burndown)-1].Date == point.Date {
+			r.Burndown[len(r.Burndown)-1] = point
+		} else {
+			r.Burndown = append(r.Burndown, point)
+		}
+	}
+
+	r.Summary = r.Burndown[len(r.Burndown)-1]
+
+	// RecordSnapshot carries repos over from one snapshot to the next, so repos that have since been dropped from the
+	// campaign are still included, as they were last seen
+	var timesToMerge, timesToFirstReview []time.Duration
+	for repo := range history[len(history)-1].Repos {
+		timeline := timelines[repo]
+		pr := timeline.latest
+
+		r.Repos = append(r.Repos, repoRow{
+			Repository:     repo,
+			State:          pr.State,
+			Number:         pr.Number,
+			Url:            pr.Url,
+			ReviewDecision: pr.ReviewDecision,
+			Checks:         pr.Checks,
+		})
+		for reaction, count := range pr.Reactions {
+			r.Reactions[reaction] += count
+		}
+
+		createdAt := orElse(pr.CreatedAt, timeline.createdAt)
+		if createdAt.IsZero() {
+			continue
+		}
+
+		switch pr.State {
+		case "MERGED":
+			timesToMerge = append(timesToMerge, orElse(pr.MergedAt, timeline.mergedAt).Sub(createdAt))
+		case "OPEN":
+			r.LongestOpen = append(r.LongestOpen, openPr{Repository: repo, Url: pr.Url, OpenFor: now.Sub(createdAt)})
+		}
+
+		if firstReviewAt := orElse(pr.FirstReviewAt, timeline.firstReviewAt); !firstReviewAt.IsZero() {
+			timesToFirstReview = append(timesToFirstReview, firstReviewAt.Sub(createdAt))
+		}
+	}
+
+	r.Merged = len(timesToMerge)
+	r.MedianTimeToMerge = median(timesToMerge)
+	r.Reviewed = len(timesToFirstReview)
+	r.MedianTimeToFirstReview = median(timesToFirstReview)
+
+	sort.Slice(r.Repos, func(i, j int) bool { return r.Repos[i].Repository < r.Repos[j].Repository })
+	sort.Slice(r.LongestOpen, func(i, j int) bool {
+		if r.LongestOpen[i].OpenFor != r.LongestOpen[j].OpenFor {
+			return r.LongestOpen[i].OpenFor > r.LongestOpen[j].OpenFor
+		}
+		return r.LongestOpen[i].Repository < r.LongestOpen[j].Repository
+	})
+	if len(r.LongestOpen) > top {
+		r.LongestOpen = r.LongestOpen[:top]
+	}
+
+	return r
+}
+
+func orElse(t *time.Time, fallback time.Time) time.Time {
+	if t != nil {
+		return *t
+	}
+	return fallback
+}
+
+func median(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+	sorted := append([]time.Duration{}, durations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// formatDuration gives a duration to the nearest minute in days, hours and minutes, leaving out the smaller units
+// of long durations, e.g. 3d 4h, 5h 12m or 45m
+func formatDuration(d time.Duration) string {
+	minutes := int(d.Round(time.Minute).Minutes())
+	days, hours := minutes/(24*60), minutes/60%24
+	minutes = minutes % 60
+
+	switch {
+	case days > 0:
+		return fmt.Sprintf("%dd %dh", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("%dh %dm", hours, minutes)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package report
+
+import (
+	htmlTemplate "html/template"
+	"io"
+	"strings"
+	textTemplate "text/template"
+
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+// Report formats
+const (
+	formatTable    = "table"
+	formatMarkdown = "markdown"
+	formatHtml     = "html"
+)
+
+// reportView is what the Markdown and HTML reports show: a campaign report along with the campaign's title and
+// description, and its figures ready to print
+type reportView struct {
+	Title         string
+	Description   string
+	GeneratedAt   string
+	MergedPercent int
+	Report        campaignReport
+	Reactions     []reactionView
+}
+
+type reactionView struct {
+	Emoji string
+	Count int
+}
+
+func newReportView(title string, description string, r campaignReport) reportView {
+	view := reportView{
+		Title:       title,
+		Description: strings.TrimSpace(description),
+		GeneratedAt: r.At.Local().Format("2006-01-02 15:04 MST"),
+		Report:      r,
+	}
+	if r.Summary.Total > 0 {
+		view.MergedPercent = r.Summary.Merged * 100 / r.Summary.Total
+	}
+	for _, key := range github.ReactionsOrder {
+		if r.Reactions[key] > 0 {
+			view.Reactions = append(view.Reactions, reactionView{Emoji: github.ReactionEmoji[key], Count: r.Reactions[key]})
+		}
+	}
+	return view
+}
+
+var templateFuncs = map[string]interface{}{
+	"duration": formatDuration,
+	"cell":     markdownCell,
+}
+
+// markdownCell escapes a value so that it stays within a single cell of a Markdown table
+func markdownCell(value string) string {
+	value = strings.ReplaceAll(value, "|", "\\|")
+	return strings.Join(strings.Fields(value), " ")
+}
+
+const markdownReport = `# {{ .Title }}
+{{ if .Description }}
+{{ .Description }}
+{{ end }}
+_Campaign report as of {{ .GeneratedAt }}, generated by turbolift._
+
+## Summary
+
+| State | Count |
+| --- | ---: |
+| Merged | {{ .Report.Summary.Merged }} |
+| Open | {{ .Report.Summary.Open }} |
+| Closed | {{ .Report.Summary.Closed }} |
+| No PR | {{ .Report.Summary.NoPr }} |
+| **Total** | **{{ .Report.Summary.Total }}** |
+
+- **{{ .MergedPercent }}%** of PRs merged
+- {{ if .Report.Merged }}Median time to merge: **{{ duration .Report.MedianTimeToMerge }}** ({{ .Report.Merged }} PRs merged){{ else }}No PRs merged yet{{ end }}
+- {{ if .Report.Reviewed }}Median time to first review: **{{ duration .Report.MedianTimeToFirstReview }}** ({{ .Report.Reviewed }} PRs reviewed){{ else }}No PRs reviewed yet{{ end }}
+{{ if .Reactions }}- Reactions:{{ range .Reactions }} {{ .Emoji }} {{ .Count }}{{ end }}
+{{ end }}
+## Progress
+
+| Date | Open | Merged | Closed | No PR |
+| --- | ---: | ---: | ---: | ---: |
+{{ range .Report.Burndown }}| {{ .Date }} | {{ .Open }} | {{ .Merged }} | {{ .Closed }} | {{ .NoPr }} |
+{{ end }}{{ if .Report.LongestOpen }}
+## Longest open PRs
+
+| Repository | Open for | PR |
+| --- | --- | --- |
+{{ range .Report.LongestOpen }}| {{ cell .Repository }} | {{ duration .OpenFor }} | {{ .Url }} |
+{{ end }}{{ end }}
+## Pull requests
+
+Repos dropped from the campaign are still included, as pr-status last saw them.
+
+| Repository | State | Reviews | Checks | PR |
+| --- | --- | --- | --- | --- |
+{{ range .Report.Repos }}| {{ cell .Repository }} | {{ .State }} | {{ .ReviewDecision }} | {{ .Checks }} | {{ if .Url }}[{{ if .Number }}#{{ .Number }}{{ else }}PR{{ end }}]({{ .Url }}){{ end }} |
+{{ end }}`
+
+const htmlReport = `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{ .Title }}</title>
+<style>
+  body { font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 60em; margin: 2em auto; padding: 0 1em; color: #1f2328; }
+  table { border-collapse: collapse; margin: 1em 0; }
+  th, td { border: 1px solid #d0d7de; padding: 0.3em 0.8em; text-align: left; }
+  th { background: #f6f8fa; }
+  td.count { text-align: right; }
+  .description { white-space: pre-wrap; }
+  .generated { color: #656d76; font-style: italic; }
+  .progress { background: #d0d7de; width: 20em; height: 1em; border-radius: 0.5em; overflow: hidden; }
+  .progress div { background: #8250df; height: 100%; }
+  .MERGED { color: #8250df; } .OPEN { color: #1a7f37; } .CLOSED { color: #cf222e; } .NO_PR { color: #656d76; }
+  .FAILURE, .CHANGES_REQUESTED { color: #cf222e; } .SUCCESS, .APPROVED { color: #1a7f37; } .PENDING { color: #9a6700; }
+</style>
+</head>
+<body>
+<h1>{{ .Title }}</h1>
+{{ if .Description }}<div class="description">{{ .Description }}</div>
+{{ end }}<p class="generated">Campaign report as of {{ .GeneratedAt }}, generated by turbolift.</p>
+
+<h2>Summary</h2>
+<table>
+<tr><th>State</th><th>Count</th></tr>
+<tr><td class="MERGED">Merged</td><td class="count">{{ .Report.Summary.Merged }}</td></tr>
+<tr><td class="OPEN">Open</td><td class="count">{{ .Report.Summary.Open }}</td></tr>
+<tr><td class="CLOSED">Closed</td><td class="count">{{ .Report.Summary.Closed }}</td></tr>
+<tr><td class="NO_PR">No PR</td><td class="count">{{ .Report.Summary.NoPr }}</td></tr>
+<tr><th>Total</th><th class="count">{{ .Report.Summary.Total }}</th></tr>
+</table>
+<div class="progress"><div style="width: {{ .MergedPercent }}%"></div></div>
+<p><strong>{{ .MergedPercent }}%</strong> of PRs merged.</p>
+<p>{{ if .Report.Merged }}Median time to merge: <strong>{{ duration .Report.MedianTimeToMerge }}</strong> ({{ .Report.Merged }} PRs merged).{{ else }}No PRs merged yet.{{ end }}<br>
+{{ if .Report.Reviewed }}Median time to first review: <strong>{{ duration .Report.MedianTimeToFirstReview }}</strong> ({{ .Report.Reviewed }} PRs reviewed).{{ else }}No PRs reviewed yet.{{ end }}</p>
+{{ if .Reactions }}<p>Reactions:{{ range .Reactions }} {{ .Emoji }} {{ .Count }}{{ end }}</p>
+{{ end }}
+<h2>Progress</h2>
+<table>
+<tr><th>Date</th><th>Open</th><th>Merged</th><th>Closed</th><th>No PR</th></tr>
+{{ range .Report.Burndown }}<tr><td>{{ .Date }}</td><td class="count">{{ .Open }}</td><td class="count">{{ .Merged }}</td><td class="count">{{ .Closed }}</td><td class="count">{{ .NoPr }}</td></tr>
+{{ end }}</table>
+{{ if .Report.LongestOpen }}
+<h2>Longest open PRs</h2>
+<table>
+<tr><th>Repository</th><th>Open for</th><th>PR</th></tr>
+{{ range .Report.LongestOpen }}<tr><td>{{ .Repository }}</td><td>{{ duration .OpenFor }}</td><td>{{ if .Url }}<a href="{{ .Url }}">{{ .Url }}</a>{{ end }}</td></tr>
+{{ end }}</table>
+{{ end }}
+<h2>Pull requests</h2>
+<p>Repos dropped from the campaign are still included, as pr-status last saw them.</p>
+<table>
+<tr><th>Repository</th><th>State</th><th>Reviews</th><th>Checks</th><th>PR</th></tr>
+{{ range .Report.Repos }}<tr><td>{{ .Repository }}</td><td class="{{ .State }}">{{ .State }}</td><td class="{{ .ReviewDecision }}">{{ .ReviewDecision }}</td><td class="{{ .Checks }}">{{ .Checks }}</td><td>{{ if .Url }}<a href="{{ .Url }}">{{ if .Number }}#{{ .Number }}{{ else }}PR{{ end }}</a>{{ end }}</td></tr>
+{{ end }}</table>
+</body>
+</html>
+`
+
+// writeMarkdown renders a report that is ready to paste into a tracking issue or wiki page
+func writeMarkdown(w io.Writer, view reportView) error {
+	t := textTemplate.Must(textTemplate.New("report").Funcs(templateFuncs).Parse(markdownReport))
+	return t.Execute(w, view)
+}
+
+// writeHtml renders a report as a single HTML page with no external resources, so that it can be shared as a file
+func writeHtml(w io.Writer, view reportView) error {
+	t := htmlTemplate.Must(htmlTemplate.New("report").Funcs(templateFuncs).Parse(htmlReport))
+	return t.Execute(w, view)
+}
@@ -0,0 +1,156 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package report
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/state"
+)
+
+// now is replaced in tests so that the ages of PRs are predictable
+var now = time.Now
+
+var (
+	top    int
+	format string
+)
+
+// progressBarWidth is the number of characters in the bar showing the proportion of PRs merged
+const progressBarWidth = 20
+
+func NewReportCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "report",
+		Short: "Reports on the progress of a campaign over time, from the history recorded by pr-status",
+		RunE:  runE,
+	}
+	cmd.Flags().IntVar(&top, "top", 10, "The number of longest-open PRs to list.")
+	cmd.Flags().StringVar(&format, "format", formatTable, "Report format: table, markdown or html. markdown and html are written to stdout, with progress on stderr.")
+
+	return cmd
+}
+
+func runE(c *cobra.Command, _ []string) error {
+	var logger *logging.Logger
+	switch format {
+	case formatTable:
+		logger = logging.NewLogger(c)
+	case formatMarkdown, formatHtml:
+		logger = logging.NewStderrLogger(c)
+	default:
+		return fmt.Errorf("unknown report format %s: use table, markdown or html", format)
+	}
+
+	if top < 0 {
+		return errors.New("--top must not be negative")
+	}
+
+	var dir *campaign.Campaign
+	if format != formatTable {
+		readCampaignActivity := logger.StartActivity("Reading campaign data")
+		var err error
+		dir, err = campaign.OpenCampaign(campaign.NewCampaignOptions())
+		if err != nil {
+			readCampaignActivity.EndWithFailure(err)
+			return nil
+		}
+		readCampaignActivity.EndWithSuccess()
+	}
+
+	readHistoryActivity := logger.StartActivity("Reading campaign history (%s)", state.DefaultHistoryFilename)
+	history, err := state.LoadHistory(state.DefaultHistoryFilename)
+	if err != nil {
+		readHistoryActivity.EndWithFailure(err)
+		return nil
+	}
+	if len(history) == 0 {
+		readHistoryActivity.EndWithFailuref("No history found: run turbolift pr-status to record the state of the campaign's PRs")
+		return nil
+	}
+	readHistoryActivity.EndWithSuccess()
+
+	r := buildReport(history, now(), top)
+
+	logger.Successf("turbolift report completed\n")
+
+	switch format {
+	case formatMarkdown:
+		return writeMarkdown(c.OutOrStdout(), newReportView(dir.PrTitle, dir.PrBody, r))
+	case formatHtml:
+		return writeHtml(c.OutOrStdout(), newReportView(dir.PrTitle, dir.PrBody, r))
+	default:
+		printReport(logger, r)
+		return nil
+	}
+}
+
+func printReport(logger *logging.Logger, r campaignReport) {
+	logger.Println()
+
+	burndownTable := table.New("Date", "Open", "Merged", "Closed", "No PR", "Merged %")
+	burndownTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	burndownTable.WithFirstColumnFormatter(color.New(color.FgCyan).SprintfFunc())
+	burndownTable.WithWriter(logger.Writer())
+	for _, point := range r.Burndown {
+		burndownTable.AddRow(point.Date, point.Open, point.Merged, point.Closed, point.NoPr, progressBar(point.Merged, point.Total))
+	}
+	burndownTable.Print()
+	logger.Println("Repos dropped from the campaign are still counted, as pr-status last saw them.")
+	logger.Println()
+
+	if r.Merged > 0 {
+		logger.Printf("Median time to merge: %s (%d PRs merged)", formatDuration(r.MedianTimeToMerge), r.Merged)
+	} else {
+		logger.Println("Median time to merge: no PRs merged yet")
+	}
+	if r.Reviewed > 0 {
+		logger.Printf("Median time to first review: %s (%d PRs reviewed)", formatDuration(r.MedianTimeToFirstReview), r.Reviewed)
+	} else {
+		logger.Println("Median time to first review: no PRs reviewed yet")
+	}
+
+	if len(r.LongestOpen) > 0 {
+		logger.Println()
+		logger.Println("Longest open PRs:")
+		openTable := table.New("Repository", "Open for", "URL")
+		openTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+		openTable.WithFirstColumnFormatter(color.New(color.FgCyan).SprintfFunc())
+		openTable.WithWriter(logger.Writer())
+		for _, pr := range r.LongestOpen {
+			openTable.AddRow(pr.Repository, formatDuration(pr.OpenFor), pr.Url)
+		}
+		openTable.Print()
+	}
+}
+
+// progressBar draws the proportion of PRs that have been merged, e.g. ██████░░░░░░░░░░░░░░ 30%
+func progressBar(merged int, total int) string {
+	if total == 0 {
+		return ""
+	}
+	filled := merged * progressBarWidth / total
+	return fmt.Sprintf("%s%s %d%%", strings.Repeat("█", filled), strings.Repeat("░", progressBarWidth-filled), merged*100/total)
+}
@@ -0,0 +1,178 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package report
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/state"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+var (
+	day1 = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	day2 = day1.Add(24 * time.Hour)
+	day3 = day2.Add(24 * time.Hour)
+)
+
+func TestItReportsTheBurndownOfACampaign(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	recordHistory(t)
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift report completed")
+
+	assert.Regexp(t, "2024-03-01\\s+3\\s+0\\s+0\\s+1\\s+░{20} 0%", out)
+	assert.Regexp(t, "2024-03-02\\s+2\\s+1\\s+0\\s+1\\s+█{5}░{15} 25%", out)
+	assert.Regexp(t, "2024-03-03\\s+1\\s+2\\s+1\\s+0\\s+█{10}░{10} 50%", out)
+	assert.Equal(t, 1, strings.Count(out, "2024-03-03"), "only the last snapshot of each day is shown")
+}
+
+func TestItReportsTimesToMergeAndReview(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	recordHistory(t)
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+
+	// repo1 took 1 day to merge, and repo2 took 2 days going by when pr-status first saw it merged
+	assert.Contains(t, out, "Median time to merge: 1d 12h (2 PRs merged)")
+	assert.Contains(t, out, "Repos dropped from the campaign are still counted, as pr-status last saw them.")
+	// repo1 was reviewed after 2 hours, and repo3 was first seen approved the day after it was raised
+	assert.Contains(t, out, "Median time to first review: 13h 0m (2 PRs reviewed)")
+}
+
+func TestItListsTheLongestOpenPrs(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	recordHistory(t)
+
+	out, err := runCommand("--top", "1")
+	assert.NoError(t, err)
+	assert.Regexp(t, "org/repo3\\s+3d 0h\\s+https://github.com/org/repo3/pull/3", out)
+	assert.NotContains(t, out, "org/repo4")
+}
+
+func TestItNeedsSomeHistory(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "No history found")
+	assert.NotContains(t, out, "turbolift report completed")
+}
+
+func TestItWritesAMarkdownReport(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2", "org/repo3", "org/repo4")
+	testsupport.CreateOrUpdatePrDescriptionFile("README.md", "Upgrade the widget library", "Moves every service to widgets v2.")
+	recordHistory(t)
+
+	stdout, stderr, err := runCommandWithOutputs("--format", "markdown")
+	assert.NoError(t, err)
+	assert.Contains(t, stderr, "turbolift report completed")
+	assert.True(t, strings.HasPrefix(stdout, "# Upgrade the widget library\n\nMoves every service to widgets v2.\n"))
+	assert.Contains(t, stdout, "| Merged | 2 |\n| Open | 1 |\n| Closed | 1 |\n| No PR | 0 |\n| **Total** | **4** |")
+	assert.Contains(t, stdout, "- **50%** of PRs merged\n- Median time to merge: **1d 12h** (2 PRs merged)\n")
+	assert.Contains(t, stdout, "- Reactions: 👍 5 🚀 1\n")
+	assert.Contains(t, stdout, "| 2024-03-02 | 2 | 1 | 0 | 1 |")
+	assert.Contains(t, stdout, "| org/repo3 | OPEN | APPROVED | FAILURE | [#3](https://github.com/org/repo3/pull/3) |")
+	assert.Contains(t, stdout, "| org/repo4 | CLOSED |  |  |  |")
+}
+
+func TestItWritesASelfContainedHtmlReport(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2", "org/repo3", "org/repo4")
+	testsupport.CreateOrUpdatePrDescriptionFile("README.md", "Upgrade <widgets>", "Moves every service to widgets v2.")
+	recordHistory(t)
+
+	stdout, _, err := runCommandWithOutputs("--format", "html")
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(stdout, "<!DOCTYPE html>"))
+	assert.Contains(t, stdout, "<h1>Upgrade &lt;widgets&gt;</h1>")
+	assert.Contains(t, stdout, `<div class="progress"><div style="width: 50%"></div></div>`)
+	assert.Contains(t, stdout, `<td class="OPEN">OPEN</td><td class="APPROVED">APPROVED</td><td class="FAILURE">FAILURE</td><td><a href="https://github.com/org/repo3/pull/3">#3</a></td>`)
+	assert.NotContains(t, stdout, "<link")
+	assert.NotContains(t, stdout, "<script")
+}
+
+func TestItRejectsUnknownReportFormats(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	_, _, err := runCommandWithOutputs("--format", "pdf")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unknown report format pdf")
+}
+
+func recordHistory(t *testing.T) {
+	snapshots := []state.Snapshot{
+		{At: day1, Repos: map[string]state.PrSnapshot{
+			"org/repo1": {State: "OPEN", CreatedAt: state.OptionalTime(day1), FirstReviewAt: state.OptionalTime(day1.Add(2 * time.Hour))},
+			"org/repo2": {State: "OPEN"},
+			"org/repo3": {State: "OPEN", Url: "https://github.com/org/repo3/pull/3"},
+			"org/repo4": {State: "NO_PR"},
+		}},
+		{At: day2, Repos: map[string]state.PrSnapshot{
+			"org/repo1": {State: "MERGED", CreatedAt: state.OptionalTime(day1), MergedAt: state.OptionalTime(day2)},
+			"org/repo2": {State: "OPEN"},
+			"org/repo3": {State: "OPEN", Url: "https://github.com/org/repo3/pull/3", ReviewDecision: "APPROVED"},
+			"org/repo4": {State: "NO_PR"},
+		}},
+		{At: day3.Add(-2 * time.Hour), Repos: map[string]state.PrSnapshot{
+			"org/repo1": {State: "MERGED"},
+		}},
+		{At: day3, Repos: map[string]state.PrSnapshot{
+			"org/repo1": {State: "MERGED", CreatedAt: state.OptionalTime(day1), MergedAt: state.OptionalTime(day2), FirstReviewAt: state.OptionalTime(day1.Add(2 * time.Hour))},
+			"org/repo2": {State: "MERGED", Reactions: map[string]int{"THUMBS_UP": 3}},
+			"org/repo3": {State: "OPEN", Number: 3, Url: "https://github.com/org/repo3/pull/3", ReviewDecision: "APPROVED", Checks: "FAILURE",
+				Reactions: map[string]int{"THUMBS_UP": 2, "ROCKET": 1}},
+			"org/repo4": {State: "CLOSED"},
+		}},
+	}
+	for _, snapshot := range snapshots {
+		assert.NoError(t, state.AppendSnapshot(state.DefaultHistoryFilename, snapshot))
+	}
+	now = func() time.Time { return day3.Add(24 * time.Hour) }
+}
+
+func runCommand(args ...string) (string, error) {
+	cmd := NewReportCmd()
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
+
+func runCommandWithOutputs(args ...string) (string, string, error) {
+	cmd := NewReportCmd()
+	outBuffer := bytes.NewBufferString("")
+	errBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	cmd.SetErr(errBuffer)
+	cmd.SetArgs(args)
+	err := cmd.Execute()
+	return outBuffer.String(), errBuffer.String(), err
+}
@@ -28,6 +28,8 @@ import (
 	foreachCmd "github.com/skyscanner/turbolift/cmd/foreach"
 	initCmd "github.com/skyscanner/turbolift/cmd/init"
 	prStatusCmd "github.com/skyscanner/turbolift/cmd/prstatus"
+	reportCmd "github.com/skyscanner/turbolift/cmd/report"
+	statusCmd "github.com/skyscanner/turbolift/cmd/status"
 	updatePrsCmd "github.com/skyscanner/turbolift/cmd/updateprs"
 )
 
@@ -55,6 +57,8 @@ func init() {
 	rootCmd.AddCommand(foreachCmd.NewForeachCmd())
 	rootCmd.AddCommand(updatePrsCmd.NewUpdatePRsCmd())
 	rootCmd.AddCommand(prStatusCmd.NewPrStatusCmd())
+	rootCmd.AddCommand(reportCmd.NewReportCmd())
+	rootCmd.AddCommand(statusCmd.NewStatusCmd())
 }
 
 func Execute() {
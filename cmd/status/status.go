@@ -0,0 +1,196 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package status
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/rodaine/table"
+	"github.com/spf13/cobra"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/state"
+)
+
+var g git.Git = git.NewRealGit()
+
+var repoFile string
+
+// stages, in the order in which a repo passes through them
+var stagesOrder = []string{
+	"Not cloned",
+	"No changes",
+	"Uncommitted changes",
+	"Committed",
+	"Pushed",
+	"PR open",
+	"PR merged",
+	"PR closed",
+	"Errored",
+}
+
+func NewStatusCmd() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Displays where each repository is in the campaign lifecycle",
+		Run:   run,
+	}
+	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to show the status of.")
+
+	return cmd
+}
+
+func run(c *cobra.Command, _ []string) {
+	logger := logging.NewLogger(c)
+
+	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
+	options := campaign.NewCampaignOptions()
+	options.RepoFilename = repoFile
+	dir, err := campaign.OpenCampaign(options)
+	if err != nil {
+		readCampaignActivity.EndWithFailure(err)
+		return
+	}
+	readCampaignActivity.EndWithSuccess()
+
+	stages := make(map[string]int)
+
+	detailsTable := table.New("Repository", "Cloned", "Uncommitted", "Ahead", "Pushed", "PR", "Last foreach", "Error")
+	detailsTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	detailsTable.WithFirstColumnFormatter(color.New(color.FgCyan).SprintfFunc())
+	detailsTable.WithWriter(logger.Writer())
+
+	for _, repo := range dir.Repos {
+		repoState := dir.State.Get(repo.FullRepoName)
+		lastForeach := "-"
+		if repoState.LastForeach != nil {
+			outcome := "failed"
+			if repoState.LastForeach.Succeeded {
+				outcome = "succeeded"
+			}
+			lastForeach = fmt.Sprintf("%s: %s", outcome, repoState.LastForeach.Command)
+		}
+		prState := repoState.PrState
+		if prState == "" {
+			prState = "-"
+		}
+
+		checkStatusActivity := logger.StartActivity("Checking status of %s", repo.FullRepoName)
+		errored := func(err error) {
+			checkStatusActivity.EndWithFailure(err)
+			detailsTable.AddRow(repo.FullRepoName, "yes", "-", "-", "-", prState, lastForeach, err.Error())
+			stages["Errored"]++
+		}
+
+		if _, err = os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
+			checkStatusActivity.EndWithSuccess()
+			detailsTable.AddRow(repo.FullRepoName, "no", "-", "-", "-", prState, lastForeach, "")
+			stages["Not cloned"]++
+			continue
+		}
+
+		isChanged, err := g.IsRepoChanged(checkStatusActivity.Writer(), repo.FullRepoPath())
+		if err != nil {
+			errored(err)
+			continue
+		}
+
+		ahead, err := g.CommitsAhead(checkStatusActivity.Writer(), repo.FullRepoPath(), defaultBranchRef(repoState))
+		if err != nil {
+			errored(err)
+			continue
+		}
+
+		headSHA, err := g.GetHeadSHA(checkStatusActivity.Writer(), repo.FullRepoPath())
+		if err != nil {
+			errored(err)
+			continue
+		}
+
+		pushed := "no"
+		if repoState.PushedSHA == headSHA {
+			pushed = "yes"
+		} else if repoState.PushedSHA != "" {
+			pushed = "outdated"
+		}
+
+		checkStatusActivity.EndWithSuccess()
+		detailsTable.AddRow(repo.FullRepoName, "yes", yesNo(isChanged), strconv.Itoa(ahead), pushed, prState, lastForeach, "")
+		stages[stage(repoState, isChanged, ahead, pushed)]++
+	}
+
+	logger.Successf("turbolift status completed\n")
+
+	logger.Println()
+
+	detailsTable.Print()
+
+	logger.Println()
+
+	summaryTable := table.New("Stage", "Count")
+	summaryTable.WithHeaderFormatter(color.New(color.Underline).SprintfFunc())
+	summaryTable.WithFirstColumnFormatter(color.New(color.FgCyan).SprintfFunc())
+	summaryTable.WithWriter(logger.Writer())
+
+	for _, s := range stagesOrder {
+		summaryTable.AddRow(s, stages[s])
+	}
+
+	summaryTable.Print()
+}
+
+// defaultBranchRef is the remote-tracking ref that the campaign branch will be merged into.
+// Forks track the upstream repo in the upstream remote. Otherwise, we rely on origin/HEAD pointing at the default branch
+// unless the default branch has been recorded.
+func defaultBranchRef(repoState state.RepoState) string {
+	remote := repoState.UpstreamRemote()
+	if repoState.DefaultBranch == "" {
+		return remote + "/HEAD"
+	}
+	return remote + "/" + repoState.DefaultBranch
+}
+
+// stage identifies the furthest point in the lifecycle that a cloned repo has reached
+func stage(repoState state.RepoState, isChanged bool, ahead int, pushed string) string {
+	switch {
+	case repoState.PrState == "MERGED":
+		return "PR merged"
+	case repoState.PrState == "CLOSED":
+		return "PR closed"
+	case repoState.PrState == "OPEN":
+		return "PR open"
+	case pushed != "no":
+		return "Pushed"
+	case ahead > 0:
+		return "Committed"
+	case isChanged:
+		return "Uncommitted changes"
+	default:
+		return "No changes"
+	}
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package status
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/git"
+	"github.com/skyscanner/turbolift/internal/state"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func init() {
+	// disable output colouring so that strings we want to do 'Contains' checks on do not have ANSI escape sequences in IDEs
+	_ = os.Setenv("NO_COLOR", "1")
+}
+
+func TestItShowsWhereEachRepoIsInTheLifecycle(t *testing.T) {
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		switch {
+		case call[0] == "isRepoChanged":
+			return call[1] == "work/org/uncommitted", nil
+		case call[0] == "commitsAhead":
+			return call[1] != "work/org/uncommitted", nil
+		default:
+			return true, nil
+		}
+	})
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/uncommitted", "org/committed", "org/pushed", "org/raised", "org/notcloned")
+	_ = os.Remove("work/org/notcloned")
+	recordState(t, map[string]state.RepoState{
+		"org/committed": {
+			LastForeach: &state.Foreach{Command: "make test", Succeeded: false, At: time.Now()},
+		},
+		"org/pushed": {
+			Fork:          true,
+			DefaultBranch: "develop",
+			PushedSHA:     git.FakeSHA,
+		},
+		"org/raised": {
+			PushedSHA: "an older sha",
+			PrUrl:     "https://github.com/org/raised/pull/1",
+			PrState:   "OPEN",
+		},
+	})
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "turbolift status completed")
+
+	assert.Regexp(t, `org/uncommitted\s+yes\s+yes\s+0\s+no\s+-\s+-`, out)
+	assert.Regexp(t, `org/committed\s+yes\s+no\s+1\s+no\s+-\s+failed: make test`, out)
+	assert.Regexp(t, `org/pushed\s+yes\s+no\s+1\s+yes\s+-\s+-`, out)
+	assert.Regexp(t, `org/raised\s+yes\s+no\s+1\s+outdated\s+OPEN\s+-`, out)
+	assert.Regexp(t, `org/notcloned\s+no\s+-\s+-\s+-\s+-\s+-`, out)
+
+	assert.Regexp(t, `Not cloned\s+1`, out)
+	assert.Regexp(t, `Uncommitted changes\s+1`, out)
+	assert.Regexp(t, `Committed\s+1`, out)
+	assert.Regexp(t, `Pushed\s+1`, out)
+	assert.Regexp(t, `PR open\s+1`, out)
+	assert.Regexp(t, `Errored\s+0`, out)
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"isRepoChanged", "work/org/uncommitted"},
+		{"commitsAhead", "work/org/uncommitted", "origin/HEAD"},
+		{"getHeadSHA", "work/org/uncommitted"},
+		{"isRepoChanged", "work/org/committed"},
+		{"commitsAhead", "work/org/committed", "origin/HEAD"},
+		{"getHeadSHA", "work/org/committed"},
+		{"isRepoChanged", "work/org/pushed"},
+		{"commitsAhead", "work/org/pushed", "upstream/develop"},
+		{"getHeadSHA", "work/org/pushed"},
+		{"isRepoChanged", "work/org/raised"},
+		{"commitsAhead", "work/org/raised", "origin/HEAD"},
+		{"getHeadSHA", "work/org/raised"},
+	})
+}
+
+func TestItCountsReposThatCannotBeInspected(t *testing.T) {
+	fakeGit := git.NewAlwaysFailsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	out, err := runCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Checking status of org/repo1")
+	assert.Regexp(t, `org/repo1\s+yes\s+-\s+-\s+-\s+-\s+-\s+synthetic error`, out)
+	assert.Regexp(t, `org/repo2\s+yes\s+-\s+-\s+-\s+-\s+-\s+synthetic error`, out)
+	assert.Regexp(t, `Errored\s+2`, out)
+}
+
+func recordState(t *testing.T, repos map[string]state.RepoState) {
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+	for name, repoState := range repos {
+		err := dir.State.Update(name, func(r *state.RepoState) {
+			*r = repoState
+		})
+		assert.NoError(t, err)
+	}
+}
+
+func runCommand() (string, error) {
+	cmd := NewStatusCmd()
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
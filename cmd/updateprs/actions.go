@@ -0,0 +1,286 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package updateprs
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/state"
+)
+
+// action is something that update-prs does to the PR of each repo. Several actions can be asked for at once, in which
+// case they are run one after another for each repo in the order given by selectedActions.
+type action struct {
+	// flag selects the action
+	flag string
+	// flags lists the flags that were given for an action made up of several, such as the PR edits. The action is
+	// named by them rather than by flag.
+	flags []string
+	// description says what the action does, for the confirmation prompt
+	description string
+	// activity is shown while the action runs in a repo, given the repo's name
+	activity string
+	// needsWorkingCopy skips repos that have not been cloned
+	needsWorkingCopy bool
+	// needsPrs looks up the PRs of every repo at once before any action runs, for actions that use repoRun.prs
+	needsPrs bool
+	// changesPrState brings the tracking issue up to date once the action has merged or closed any PRs
+	changesPrState bool
+	// listSkipped lists the repos that were skipped at the end, along with the reasons
+	listSkipped bool
+	// notAllowedHeading introduces the list of repos that the action was not allowed in
+	notAllowedHeading string
+	run               func(r *repoRun) result
+}
+
+// flagNames names the action in messages by the flags that selected it
+func (a action) flagNames() string {
+	if len(a.flags) == 0 {
+		return "--" + a.flag
+	}
+	return "--" + strings.Join(a.flags, ", --")
+}
+
+// outcome is what became of an action in one repo
+type outcome int
+
+const (
+	outcomeDone outcome = iota
+	outcomeSkipped
+	outcomeFailed
+	// outcomeNotAllowed is for repos whose settings rule out the action. They are listed separately rather than
+	// counted as skipped or failed.
+	outcomeNotAllowed
+)
+
+type result struct {
+	outcome outcome
+	reason  string
+	err     error
+}
+
+func done() result {
+	return result{outcome: outcomeDone}
+}
+
+func skipped(reason string) result {
+	return result{outcome: outcomeSkipped, reason: reason}
+}
+
+func failed(err error) result {
+	return result{outcome: outcomeFailed, err: err}
+}
+
+func notAllowed(reason string) result {
+	return result{outcome: outcomeNotAllowed, reason: reason}
+}
+
+// repoRun holds what the actions in one repo share
+type repoRun struct {
+	dir      *campaign.Campaign
+	repo     campaign.Repo
+	logger   *logging.Logger
+	activity *logging.Activity
+	// prs are the campaign's PRs looked up up front, if an action needs them, keyed by repo
+	prs map[string]*github.PrStatus
+	// prErrs are the errors for repos whose PRs could not be looked up up front
+	prErrs map[string]error
+
+	pr         *github.PrStatus
+	prErr      error
+	prLookedUp bool
+}
+
+// getPR looks up the PR of the repo from its working copy, once however many actions need it
+func (r *repoRun) getPR() (*github.PrStatus, error) {
+	if !r.prLookedUp {
+		r.pr, r.prErr = gh.GetPR(r.activity.Writer(), r.repo.FullRepoPath(), r.repo.FullRepoName, r.dir.Name)
+		r.prLookedUp = true
+	}
+	return r.pr, r.prErr
+}
+
+// fetchPrs looks up the PRs of all the repos in a campaign, which need not have been cloned, along with the errors for
+// any repos whose PRs could not be looked up
+func fetchPrs(logger *logging.Logger, dir *campaign.Campaign) (map[string]*github.PrStatus, map[string]error, error) {
+	fetchActivity := logger.StartActivity("Fetching PRs for %d repos", len(dir.Repos))
+	var fullRepoNames []string
+	for _, repo := range dir.Repos {
+		fullRepoNames = append(fullRepoNames, repo.FullRepoName)
+	}
+	prStatuses, lookupErrs, err := gh.GetPRs(fetchActivity.Writer(), fullRepoNames, dir.Name)
+	if err != nil {
+		fetchActivity.EndWithFailure(err)
+		return nil, nil, err
+	}
+	if len(lookupErrs) > 0 {
+		fetchActivity.EndWithWarningf("Unable to get the PRs of %d repos", len(lookupErrs))
+	} else {
+		fetchActivity.EndWithSuccess()
+	}
+	return prStatuses, lookupErrs, nil
+}
+
+// noPrResult skips a repo that has no PR, and fails for any other error in looking it up
+func noPrResult(err error) result {
+	var noPrErr *github.NoPRFoundError
+	if errors.As(err, &noPrErr) {
+		return skipped(noPrErr.Error())
+	}
+	return failed(err)
+}
+
+// selectedActions lists the actions asked for by the flags, in the order that they run in each repo: closed PRs are
+// reopened first, then the branch is updated or new commits pushed and the PR brought up to date and out of draft
+// before it is commented on, and it is merged or closed last
+func selectedActions() []action {
+	var actions []action
+	for _, candidate := range []struct {
+		selected bool
+		action   action
+	}{
+		{reopenFlag, reopenAction},
+		{updateBranchFlag, updateBranchAction()},
+		{pushFlag, pushAction},
+		{updateDescriptionFlag, amendDescriptionAction},
+		{hasPrEdits(), editAction()},
+		{readyFlag, readyAction()},
+		{toDraftFlag, toDraftAction()},
+		{comment != "" || commentFile != "", commentAction},
+		{enableAutoMergeFlag, enableAutoMergeAction()},
+		{disableAutoMergeFlag, disableAutoMergeAction},
+		{mergeFlag, mergeAction()},
+		{closeFlag, closeAction},
+	} {
+		if candidate.selected {
+			actions = append(actions, candidate.action)
+		}
+	}
+	return actions
+}
+
+var pushAction = action{
+	flag:             "push",
+	description:      "push new commits",
+	activity:         "Pushing changes in %s to origin",
+	needsWorkingCopy: true,
+	run: func(r *repoRun) result {
+		if err := g.Push(r.activity.Writer(), r.repo.FullRepoPath(), "origin", r.dir.Name); err != nil {
+			return failed(err)
+		}
+		pushedSHA, err := g.GetHeadSHA(r.activity.Writer(), r.repo.FullRepoPath())
+		if err != nil {
+			return failed(err)
+		}
+		updateState(r.dir, r.repo, r.logger, func(s *state.RepoState) {
+			s.PushedSHA = pushedSHA
+		})
+		return done()
+	},
+}
+
+var amendDescriptionAction = action{
+	flag:             "amend-description",
+	description:      "update titles and descriptions",
+	activity:         "Updating PR description in %s",
+	needsWorkingCopy: true,
+	run: func(r *repoRun) result {
+		prTitle, prBody, err := r.dir.RenderPrDescriptionFor(r.activity.Writer(), g, r.repo)
+		if err != nil {
+			return failed(err)
+		}
+
+		pullRequest := github.PullRequest{
+			Title:         prTitle,
+			Body:          prBody,
+			UpstreamRepo:  r.repo.FullRepoName,
+			Labels:        r.dir.PrOptions.Labels,
+			Reviewers:     r.dir.PrOptions.Reviewers,
+			TeamReviewers: r.dir.PrOptions.TeamReviewers,
+			Assignees:     r.dir.PrOptions.Assignees,
+			Milestone:     r.dir.PrOptions.Milestone,
+			Base:          r.dir.PrOptions.Base,
+		}
+		if err := gh.UpdatePRDescription(r.activity.Writer(), r.repo.FullRepoPath(), pullRequest); err != nil {
+			return noPrResult(err)
+		}
+
+		if removals := droppedFromFrontMatter(r.dir.State.Get(r.repo.FullRepoName), pullRequest); len(removals) > 0 {
+			pr, err := r.getPR()
+			if err != nil {
+				return noPrResult(err)
+			}
+			for _, removal := range removals {
+				if err := removal.apply(r.activity.Writer(), r.repo.FullRepoName, pr.Number, removal.values); err != nil {
+					return failed(fmt.Errorf("%s: %w", removal.description, err))
+				}
+			}
+		}
+		updateState(r.dir, r.repo, r.logger, func(s *state.RepoState) {
+			s.AppliedLabels = pullRequest.Labels
+			s.AppliedReviewers = pullRequest.AllReviewers()
+			s.AppliedAssignees = pullRequest.Assignees
+		})
+		return done()
+	},
+}
+
+var closeAction = action{
+	flag:             "close",
+	description:      "close",
+	activity:         "Closing PR in %s",
+	needsWorkingCopy: true,
+	changesPrState:   true,
+	run: func(r *repoRun) result {
+		if err := gh.ClosePullRequest(r.activity.Writer(), r.repo.FullRepoPath(), r.repo.FullRepoName, r.dir.Name); err != nil {
+			return noPrResult(err)
+		}
+		updateState(r.dir, r.repo, r.logger, func(s *state.RepoState) {
+			s.PrState = "CLOSED"
+		})
+		return done()
+	},
+}
+
+// runAction runs an action in a repo within its own activity
+func runAction(a action, r *repoRun) result {
+	r.activity = r.logger.StartActivity(a.activity, r.repo.FullRepoName)
+
+	var res result
+	if _, err := os.Stat(r.repo.FullRepoPath()); a.needsWorkingCopy && os.IsNotExist(err) {
+		res = skipped(fmt.Sprintf("Directory %s does not exist - has it been cloned?", r.repo.FullRepoPath()))
+	} else if prErr := r.prErrs[r.repo.FullRepoName]; a.needsPrs && prErr != nil {
+		res = failed(fmt.Errorf("unable to look up the PR: %w", prErr))
+	} else {
+		res = a.run(r)
+	}
+
+	switch res.outcome {
+	case outcomeDone:
+		r.activity.EndWithSuccess()
+	case outcomeSkipped, outcomeNotAllowed:
+		r.activity.EndWithWarning(res.reason)
+	case outcomeFailed:
+		r.activity.EndWithFailure(res.err)
+	}
+	return res
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package updateprs
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/github"
+)
+
+const autoMergeNotAllowedHeading = "Auto-merge is not allowed in these repos, so their PRs will need merging by other means:"
+
+func enableAutoMergeAction() action {
+	return action{
+		flag:              "enable-auto-merge",
+		description:       fmt.Sprintf("enable auto-merge (%s)", mergeStrategy),
+		activity:          "Enabling auto-merge for PR in %s",
+		needsPrs:          true,
+		listSkipped:       true,
+		notAllowedHeading: autoMergeNotAllowedHeading,
+		run: func(r *repoRun) result {
+			return setAutoMerge(r, func(number int) error {
+				return gh.EnableAutoMerge(r.activity.Writer(), r.repo.FullRepoName, number, mergeStrategy)
+			})
+		},
+	}
+}
+
+var disableAutoMergeAction = action{
+	flag:              "disable-auto-merge",
+	description:       "disable auto-merge",
+	activity:          "Disabling auto-merge for PR in %s",
+	needsPrs:          true,
+	listSkipped:       true,
+	notAllowedHeading: autoMergeNotAllowedHeading,
+	run: func(r *repoRun) result {
+		return setAutoMerge(r, func(number int) error {
+			return gh.DisableAutoMerge(r.activity.Writer(), r.repo.FullRepoName, number)
+		})
+	},
+}
+
+// setAutoMerge turns auto-merge on or off for the repo's PR if it is open. Repos that do not allow auto-merge are
+// reported apart from the other skipped repos, as their PRs need merging by hand.
+func setAutoMerge(r *repoRun, set func(number int) error) result {
+	pr, ok := r.prs[r.repo.FullRepoName]
+	if !ok {
+		return skipped(fmt.Sprintf("no PR found for branch %s", r.dir.Name))
+	}
+	if pr.State != "OPEN" {
+		return skipped(fmt.Sprintf("PR is %s", strings.ToLower(pr.State)))
+	}
+
+	err := set(pr.Number)
+	var notAllowedErr *github.AutoMergeNotAllowedError
+	if errors.As(err, &notAllowedErr) {
+		return notAllowed(notAllowedErr.Reason)
+	} else if err != nil {
+		return failed(err)
+	}
+	return done()
+}
@@ -0,0 +1,137 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package updateprs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/logging"
+	"github.com/skyscanner/turbolift/internal/state"
+)
+
+const (
+	updateMethodRebase = "rebase"
+	updateMethodMerge  = "merge"
+)
+
+var updateMethods = map[string]bool{
+	updateMethodRebase: true,
+	updateMethodMerge:  true,
+}
+
+// conflictError is returned when the campaign branch of a repo cannot be brought up to date without resolving
+// conflicts by hand
+type conflictError struct {
+	base  string
+	files []string
+}
+
+func (e *conflictError) Error() string {
+	return fmt.Sprintf("conflicts with %s in %s", e.base, strings.Join(e.files, ", "))
+}
+
+// conflictedRepo is a repo whose campaign branch was left as it was because of conflicts
+type conflictedRepo struct {
+	repo  string
+	files []string
+}
+
+func updateBranchAction() action {
+	return action{
+		flag:             "update-branch",
+		description:      fmt.Sprintf("%s onto the latest base branch and force-push", updateMethod),
+		activity:         "Updating campaign branch in %s",
+		needsWorkingCopy: true,
+		run: func(r *repoRun) result {
+			repoPath := r.repo.FullRepoPath()
+			repoState := r.dir.State.Get(r.repo.FullRepoName)
+			remote := repoState.UpstreamRemote()
+			// PRs are raised against the base given in the front matter, or else the repo's current default branch
+			baseBranch, defaultBranch := r.dir.PrOptions.Base, ""
+			if baseBranch == "" {
+				var err error
+				if defaultBranch, err = gh.GetDefaultBranchName(r.activity.Writer(), repoPath, r.repo.FullRepoName); err != nil {
+					return failed(err)
+				}
+				baseBranch = defaultBranch
+			}
+			// only the base branch is fetched, so that the lease below cannot pass for commits pushed to the campaign
+			// branch by someone else
+			if err := g.Fetch(r.activity.Writer(), repoPath, remote, baseBranch); err != nil {
+				return failed(err)
+			}
+			headSHA, err := g.GetHeadSHA(r.activity.Writer(), repoPath)
+			if err != nil {
+				return failed(err)
+			}
+
+			base := remote + "/" + baseBranch
+			update, abort := g.Rebase, g.AbortRebase
+			if updateMethod == updateMethodMerge {
+				update, abort = g.Merge, g.AbortMerge
+			}
+			if err := update(r.activity.Writer(), repoPath, base); err != nil {
+				files, filesErr := g.ConflictingFiles(r.activity.Writer(), repoPath)
+				if filesErr != nil || len(files) == 0 {
+					return failed(err)
+				}
+				// the working copy is put back as it was, so that the conflicts can be resolved by hand
+				if abortErr := abort(r.activity.Writer(), repoPath); abortErr != nil {
+					return failed(fmt.Errorf("unable to abort the %s after conflicts in %s: %w", updateMethod, strings.Join(files, ", "), abortErr))
+				}
+				return failed(&conflictError{base: base, files: files})
+			}
+
+			updatedSHA, err := g.GetHeadSHA(r.activity.Writer(), repoPath)
+			if err != nil {
+				return failed(err)
+			}
+			if updatedSHA == headSHA {
+				return skipped(fmt.Sprintf("already up to date with %s", base))
+			}
+			// the remote branch must still be at the last commit turbolift pushed, if it is known
+			if err := g.ForcePushWithLease(r.activity.Writer(), repoPath, "origin", r.dir.Name, repoState.PushedSHA); err != nil {
+				return failed(err)
+			}
+			updateState(r.dir, r.repo, r.logger, func(s *state.RepoState) {
+				if defaultBranch != "" {
+					s.DefaultBranch = defaultBranch
+				}
+				s.PushedSHA = updatedSHA
+			})
+			return done()
+		},
+	}
+}
+
+// writeConflictsFile lists the repos whose campaign branch could not be updated in the same format as repos.txt, with
+// the conflicting files of each, so that they can be dealt with by hand and follow-up commands run with --repos
+func writeConflictsFile(logger *logging.Logger, conflicts []conflictedRepo) {
+	var sb strings.Builder
+	sb.WriteString("# This file contains the list of repositories whose campaign branch could not be updated by turbolift update-prs\n")
+	sb.WriteString("# because of conflicts with their base branch, each preceded by the conflicting files\n")
+	for _, c := range conflicts {
+		sb.WriteString(fmt.Sprintf("# %s\n", strings.Join(c.files, ", ")))
+		sb.WriteString(c.repo + "\n")
+	}
+	if err := os.WriteFile(conflictsFile, []byte(sb.String()), 0644); err != nil {
+		logger.Errorf("Failed to write the repos with conflicts to %s: %v", conflictsFile, err)
+		return
+	}
+	logger.Printf("Names of repos with conflicts have been written to %s, along with the conflicting files. Resolve the conflicts by hand, or use --repos %s to run follow-up commands against these repos", conflictsFile, conflictsFile)
+}
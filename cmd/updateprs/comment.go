@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package updateprs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prStates are the values accepted by --only-state
+var prStates = map[string]bool{
+	"open":   true,
+	"closed": true,
+	"merged": true,
+}
+
+// commentTemplate is the comment read by readComment, before it is rendered for each repo
+var commentTemplate string
+
+// readComment returns the comment given by --comment or --comment-file, which is rendered for each repo
+func readComment() (string, error) {
+	if commentFile == "" {
+		return comment, nil
+	}
+	content, err := os.ReadFile(commentFile)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the comment file %s: %w", commentFile, err)
+	}
+	if strings.TrimSpace(string(content)) == "" {
+		return "", fmt.Errorf("the comment file %s is empty", commentFile)
+	}
+	return string(content), nil
+}
+
+var commentAction = action{
+	flag:             "comment",
+	description:      "comment",
+	activity:         "Commenting on PR in %s",
+	needsWorkingCopy: true,
+	run: func(r *repoRun) result {
+		pr, err := r.getPR()
+		if err != nil {
+			return noPrResult(err)
+		}
+		if onlyState != "" && !strings.EqualFold(pr.State, onlyState) {
+			return skipped(fmt.Sprintf("PR is %s", strings.ToLower(pr.State)))
+		}
+
+		body, err := r.dir.RenderComment(commentTemplate, r.dir.PrTemplateDataFor(r.activity.Writer(), g, r.repo))
+		if err != nil {
+			return failed(err)
+		}
+		if err := gh.CommentOnPR(r.activity.Writer(), r.repo.FullRepoName, pr.Number, body); err != nil {
+			return failed(err)
+		}
+		return done()
+	},
+}
@@ -0,0 +1,76 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package updateprs
+
+import (
+	"fmt"
+	"strings"
+)
+
+func readyAction() action {
+	return draftAction("ready", "mark drafts as ready for review", "Marking PR in %s as ready for review", false)
+}
+
+func toDraftAction() action {
+	return draftAction("to-draft", "convert to drafts", "Converting PR in %s to a draft", true)
+}
+
+// draftAction moves open PRs in or out of draft. With --if-checks-pass, PRs whose checks have not all passed are left
+// as they are.
+func draftAction(flag string, description string, activity string, toDraft bool) action {
+	if ifChecksPassFlag {
+		description += " if their checks pass"
+	}
+	return action{
+		flag:        flag,
+		description: description,
+		activity:    activity,
+		needsPrs:    true,
+		listSkipped: true,
+		run: func(r *repoRun) result {
+			pr, ok := r.prs[r.repo.FullRepoName]
+			if !ok {
+				return skipped(fmt.Sprintf("no PR found for branch %s", r.dir.Name))
+			}
+			if pr.State != "OPEN" {
+				return skipped(fmt.Sprintf("PR is %s", strings.ToLower(pr.State)))
+			}
+			if pr.IsDraft == toDraft {
+				if toDraft {
+					return skipped("PR is already a draft")
+				}
+				return skipped("PR is already ready for review")
+			}
+			if ifChecksPassFlag {
+				if reason := checksBlocker(pr); reason != "" {
+					return skipped(reason)
+				}
+			}
+
+			var err error
+			if toDraft {
+				err = gh.ConvertPRToDraft(r.activity.Writer(), r.repo.FullRepoName, pr.Number)
+			} else {
+				err = gh.MarkPRReady(r.activity.Writer(), r.repo.FullRepoName, pr.Number)
+			}
+			if err != nil {
+				return failed(err)
+			}
+			pr.IsDraft = toDraft
+			return done()
+		},
+	}
+}
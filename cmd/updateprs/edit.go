@@ -0,0 +1,115 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package updateprs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/state"
+)
+
+// prEdit is a change to the labels, reviewers or assignees of a PR
+type prEdit struct {
+	flag        string
+	description string
+	values      []string
+	apply       func(output io.Writer, fullRepoName string, number int, values []string) error
+}
+
+// prEdits lists the edits asked for by the flags, in the order that they are made. Removals come before additions so
+// that a label or reviewer can be replaced in one go.
+func prEdits() []prEdit {
+	var edits []prEdit
+	for _, edit := range []prEdit{
+		{flag: "remove-label", description: "removing labels", values: removeLabels, apply: gh.RemoveLabels},
+		{flag: "add-label", description: "adding labels", values: addLabels, apply: gh.AddLabels},
+		{flag: "remove-reviewer", description: "removing reviewers", values: removeReviewers, apply: gh.RemoveReviewers},
+		{flag: "add-reviewer", description: "adding reviewers", values: addReviewers, apply: gh.AddReviewers},
+		{flag: "assign", description: "assigning", values: assignees, apply: gh.AddAssignees},
+	} {
+		if len(edit.values) > 0 {
+			edits = append(edits, edit)
+		}
+	}
+	return edits
+}
+
+// droppedFromFrontMatter lists the removals that bring a PR's labels, reviewers and assignees back in line with the
+// front matter, for those that were applied to it earlier but are no longer listed. Any that were added by other
+// means are left alone.
+func droppedFromFrontMatter(applied state.RepoState, pr github.PullRequest) []prEdit {
+	var edits []prEdit
+	for _, edit := range []prEdit{
+		{description: "removing labels", values: missingFrom(applied.AppliedLabels, pr.Labels), apply: gh.RemoveLabels},
+		{description: "removing reviewers", values: missingFrom(applied.AppliedReviewers, pr.AllReviewers()), apply: gh.RemoveReviewers},
+		{description: "removing assignees", values: missingFrom(applied.AppliedAssignees, pr.Assignees), apply: gh.RemoveAssignees},
+	} {
+		if len(edit.values) > 0 {
+			edits = append(edits, edit)
+		}
+	}
+	return edits
+}
+
+// missingFrom lists the values that are not in current
+func missingFrom(values []string, current []string) []string {
+	kept := map[string]bool{}
+	for _, value := range current {
+		kept[value] = true
+	}
+	var missing []string
+	for _, value := range values {
+		if !kept[value] {
+			missing = append(missing, value)
+		}
+	}
+	return missing
+}
+
+func hasPrEdits() bool {
+	return len(addLabels) > 0 || len(removeLabels) > 0 || len(addReviewers) > 0 || len(removeReviewers) > 0 || len(assignees) > 0
+}
+
+func editAction() action {
+	edits := prEdits()
+	var flags, changes []string
+	for _, edit := range edits {
+		flags = append(flags, edit.flag)
+		changes = append(changes, fmt.Sprintf("%s %s", edit.description, strings.Join(edit.values, ", ")))
+	}
+
+	return action{
+		flags:            flags,
+		description:      strings.Join(changes, ", "),
+		activity:         "Editing PR in %s",
+		needsWorkingCopy: true,
+		run: func(r *repoRun) result {
+			pr, err := r.getPR()
+			if err != nil {
+				return noPrResult(err)
+			}
+			for _, edit := range edits {
+				if err := edit.apply(r.activity.Writer(), r.repo.FullRepoName, pr.Number, edit.values); err != nil {
+					return failed(fmt.Errorf("%s: %w", edit.description, err))
+				}
+			}
+			return done()
+		},
+	}
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package updateprs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/state"
+)
+
+func mergeAction() action {
+	return action{
+		flag:           "merge",
+		description:    fmt.Sprintf("merge (%s) those that are ready to merge", mergeStrategy),
+		activity:       "Merging PR in %s",
+		needsPrs:       true,
+		changesPrState: true,
+		listSkipped:    true,
+		run: func(r *repoRun) result {
+			pr, ok := r.prs[r.repo.FullRepoName]
+			if !ok {
+				return skipped(fmt.Sprintf("no PR found for branch %s", r.dir.Name))
+			}
+			if reason := mergeBlocker(pr); reason != "" {
+				return skipped(reason)
+			}
+
+			if err := gh.MergePullRequest(r.activity.Writer(), r.repo.FullRepoName, pr.Number, mergeStrategy, deleteBranchFlag); err != nil {
+				return failed(err)
+			}
+			updateState(r.dir, r.repo, r.logger, func(s *state.RepoState) {
+				s.PrNumber = pr.Number
+				s.PrUrl = pr.Url
+				s.PrState = "MERGED"
+			})
+			return done()
+		},
+	}
+}
+
+// mergeBlocker gives the reason that a PR is not ready to merge, or "" if it is open, out of draft, approved, has
+// passing checks and can be merged without conflicts
+func mergeBlocker(pr *github.PrStatus) string {
+	if pr.State != "OPEN" {
+		return fmt.Sprintf("PR is %s", strings.ToLower(pr.State))
+	}
+	if pr.IsDraft {
+		return "PR is a draft"
+	}
+	if pr.ReviewDecision != "APPROVED" {
+		if pr.ReviewDecision == "" {
+			return "not approved"
+		}
+		return fmt.Sprintf("not approved (%s)", pr.ReviewDecision)
+	}
+	if reason := checksBlocker(pr); reason != "" {
+		return reason
+	}
+	switch pr.Mergeable {
+	case "MERGEABLE":
+		return ""
+	case "CONFLICTING":
+		return "has merge conflicts"
+	default:
+		return "not yet known whether it can be merged, try again shortly"
+	}
+}
+
+// checksBlocker gives the reason that the checks of a PR are not green, or "" if they have all passed
+func checksBlocker(pr *github.PrStatus) string {
+	if failing, pending := unfinishedChecks(pr.StatusCheckRollup); len(failing) > 0 {
+		return fmt.Sprintf("checks failing: %s", strings.Join(failing, ", "))
+	} else if len(pending) > 0 {
+		return fmt.Sprintf("checks pending: %s", strings.Join(pending, ", "))
+	}
+	return ""
+}
+
+// unfinishedChecks names the checks of a PR that have not passed, separating those that are still running
+func unfinishedChecks(checks []github.StatusCheckRollup) (failing []string, pending []string) {
+	for _, check := range checks {
+		name := check.Name
+		if name == "" {
+			name = "unnamed check"
+		}
+		switch {
+		case check.Passed():
+		case check.Pending():
+			pending = append(pending, name)
+		default:
+			failing = append(failing, name)
+		}
+	}
+	return failing, pending
+}
@@ -0,0 +1,77 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package updateprs
+
+import (
+	"fmt"
+
+	"github.com/skyscanner/turbolift/internal/state"
+)
+
+// reopenAction reopens PRs that were closed without being merged. PRs that were merged, or whose branch has since been
+// deleted, cannot be reopened and are reported apart from the other skipped repos.
+var reopenAction = action{
+	flag:              "reopen",
+	description:       "reopen those that were closed without being merged",
+	activity:          "Reopening PR in %s",
+	needsWorkingCopy:  true,
+	needsPrs:          true,
+	changesPrState:    true,
+	listSkipped:       true,
+	notAllowedHeading: "These PRs cannot be reopened:",
+	run: func(r *repoRun) result {
+		pr, ok := r.prs[r.repo.FullRepoName]
+		if !ok {
+			return skipped(fmt.Sprintf("no PR found for branch %s", r.dir.Name))
+		}
+		switch pr.State {
+		case "OPEN":
+			return skipped("PR is already open")
+		case "MERGED":
+			return notAllowed("PR was merged")
+		}
+
+		branchExists, err := g.RemoteBranchExists(r.activity.Writer(), r.repo.FullRepoPath(), "origin", r.dir.Name)
+		if err != nil {
+			return failed(err)
+		}
+		if !branchExists {
+			return notAllowed(fmt.Sprintf("branch %s has been deleted", r.dir.Name))
+		}
+
+		if err := gh.ReopenPullRequest(r.activity.Writer(), r.repo.FullRepoName, pr.Number); err != nil {
+			return failed(err)
+		}
+		pr.State = "OPEN"
+		updateState(r.dir, r.repo, r.logger, func(s *state.RepoState) {
+			s.PrNumber = pr.Number
+			s.PrUrl = pr.Url
+			s.PrState = "OPEN"
+		})
+
+		if reopenComment == "" {
+			return done()
+		}
+		body, err := r.dir.RenderComment(reopenComment, r.dir.PrTemplateDataFor(r.activity.Writer(), g, r.repo))
+		if err != nil {
+			return failed(fmt.Errorf("reopened the PR, but could not render the comment: %w", err))
+		}
+		if err := gh.CommentOnPR(r.activity.Writer(), r.repo.FullRepoName, pr.Number, body); err != nil {
+			return failed(fmt.Errorf("reopened the PR, but could not comment on it: %w", err))
+		}
+		return done()
+	},
+}
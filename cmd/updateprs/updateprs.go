@@ -18,28 +18,52 @@ package updateprs
 import (
 	"errors"
 	"fmt"
-	"github.com/skyscanner/turbolift/internal/git"
-	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
 
 	"github.com/skyscanner/turbolift/internal/campaign"
 	"github.com/skyscanner/turbolift/internal/colors"
+	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/github"
 	"github.com/skyscanner/turbolift/internal/logging"
 	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/state"
+	"github.com/skyscanner/turbolift/internal/tracking"
 )
 
 var (
-	gh github.GitHub = github.NewRealGitHub()
+	gh github.GitHub = github.NewGitHub()
 	g  git.Git       = git.NewRealGit()
 	p  prompt.Prompt = prompt.NewRealPrompt()
 )
 
 var (
 	closeFlag             bool
+	reopenFlag            bool
+	reopenComment         string
 	updateDescriptionFlag bool
 	pushFlag              bool
+	syncTrackingIssueFlag bool
+	mergeFlag             bool
+	enableAutoMergeFlag   bool
+	disableAutoMergeFlag  bool
+	updateBranchFlag      bool
+	updateMethod          string
+	conflictsFile         string
+	readyFlag             bool
+	toDraftFlag           bool
+	ifChecksPassFlag      bool
+	comment               string
+	commentFile           string
+	onlyState             string
+	addLabels             []string
+	removeLabels          []string
+	addReviewers          []string
+	removeReviewers       []string
+	assignees             []string
+	mergeStrategy         string
+	deleteBranchFlag      bool
 	yesFlag               bool
 	repoFile              string
 	prDescriptionFile     string
@@ -53,8 +77,30 @@ func NewUpdatePRsCmd() *cobra.Command {
 	}
 
 	cmd.Flags().BoolVar(&closeFlag, "close", false, "Close all generated PRs")
+	cmd.Flags().BoolVar(&reopenFlag, "reopen", false, "Reopen PRs that were closed without being merged")
+	cmd.Flags().StringVar(&reopenComment, "reopen-comment", "", "Post a comment on each PR reopened with --reopen, rendered as with --comment")
 	cmd.Flags().BoolVar(&updateDescriptionFlag, "amend-description", false, "Update PR titles and descriptions")
 	cmd.Flags().BoolVar(&pushFlag, "push", false, "Push new commits")
+	cmd.Flags().BoolVar(&updateBranchFlag, "update-branch", false, "Fetch the latest base branch of each repo, which is its default branch unless the description's front matter gives a base, bring the campaign branch up to date with it and force-push with lease")
+	cmd.Flags().StringVar(&updateMethod, "update-method", updateMethodRebase, "How to update campaign branches with --update-branch: rebase or merge")
+	cmd.Flags().StringVar(&conflictsFile, "conflicts-file", "conflicting-repos.txt", "The file that --update-branch lists repos with conflicts in, along with the conflicting files")
+	cmd.Flags().BoolVar(&syncTrackingIssueFlag, "sync-tracking-issue", false, "Bring the checklist in the campaign's tracking issue up to date with the state of its PRs")
+	cmd.Flags().BoolVar(&mergeFlag, "merge", false, "Merge PRs that are approved, have passing checks and are mergeable")
+	cmd.Flags().BoolVar(&enableAutoMergeFlag, "enable-auto-merge", false, "Enable auto-merge on open PRs, so that they are merged once their branch protection requirements are met")
+	cmd.Flags().BoolVar(&disableAutoMergeFlag, "disable-auto-merge", false, "Disable auto-merge on open PRs")
+	cmd.Flags().BoolVar(&readyFlag, "ready", false, "Mark draft PRs as ready for review")
+	cmd.Flags().BoolVar(&toDraftFlag, "to-draft", false, "Convert open PRs to drafts")
+	cmd.Flags().BoolVar(&ifChecksPassFlag, "if-checks-pass", false, "Only change PRs whose checks have all passed with --ready or --to-draft")
+	cmd.Flags().StringVar(&comment, "comment", "", "Post a comment on PRs. The comment is rendered for each repo in the same way as PR descriptions")
+	cmd.Flags().StringVar(&commentFile, "comment-file", "", "Post the contents of a file as a comment on PRs, rendered as with --comment")
+	cmd.Flags().StringVar(&onlyState, "only-state", "", "Only comment on PRs in this state with --comment or --comment-file: open, closed or merged. Other actions are not filtered")
+	cmd.Flags().StringSliceVar(&addLabels, "add-label", nil, "Add labels to PRs")
+	cmd.Flags().StringSliceVar(&removeLabels, "remove-label", nil, "Remove labels from PRs")
+	cmd.Flags().StringSliceVar(&addReviewers, "add-reviewer", nil, "Request reviews of PRs from users, or from teams given as org/team")
+	cmd.Flags().StringSliceVar(&removeReviewers, "remove-reviewer", nil, "Remove requested reviewers from PRs")
+	cmd.Flags().StringSliceVar(&assignees, "assign", nil, "Assign users to PRs")
+	cmd.Flags().StringVar(&mergeStrategy, "strategy", github.MergeStrategyMerge, "How to merge PRs with --merge or --enable-auto-merge: merge, squash or rebase")
+	cmd.Flags().BoolVar(&deleteBranchFlag, "delete-branch", false, "Delete the branch of each PR once it has been merged with --merge")
 	cmd.Flags().BoolVar(&yesFlag, "yes", false, "Skips the confirmation prompt")
 	cmd.Flags().StringVar(&repoFile, "repos", "repos.txt", "A file containing a list of repositories to clone.")
 	cmd.Flags().StringVar(&prDescriptionFile, "description", "README.md", "A file containing the title and description for the PRs.")
@@ -62,203 +108,264 @@ func NewUpdatePRsCmd() *cobra.Command {
 	return cmd
 }
 
-// makes sure there is only one action activated
-func onlyOne(args ...bool) bool {
-	// simple counter
-	b := map[bool]int{
-		false: 0,
-		true:  0,
+func validateFlags() error {
+	if len(selectedActions()) == 0 && !syncTrackingIssueFlag {
+		return errors.New("update-prs needs at least one action flag")
+	}
+	if closeFlag && (mergeFlag || enableAutoMergeFlag) {
+		return errors.New("--close cannot be combined with --merge or --enable-auto-merge")
+	}
+	if closeFlag && reopenFlag {
+		return errors.New("--close and --reopen cannot be combined")
+	}
+	if reopenComment != "" && !reopenFlag {
+		return errors.New("--reopen-comment needs --reopen")
+	}
+	if enableAutoMergeFlag && disableAutoMergeFlag {
+		return errors.New("--enable-auto-merge and --disable-auto-merge cannot be combined")
+	}
+	if readyFlag && toDraftFlag {
+		return errors.New("--ready and --to-draft cannot be combined")
+	}
+	if ifChecksPassFlag && !readyFlag && !toDraftFlag {
+		return errors.New("--if-checks-pass needs --ready or --to-draft")
+	}
+	if ifChecksPassFlag && (pushFlag || updateBranchFlag) {
+		return errors.New("--if-checks-pass cannot be combined with --push or --update-branch, as the checks of the pushed commits will not have run yet")
+	}
+	if mergeFlag && (pushFlag || updateBranchFlag || toDraftFlag) {
+		return errors.New("--merge cannot be combined with --push, --update-branch or --to-draft, as PRs are checked for readiness before they change")
+	}
+	if updateBranchFlag && pushFlag {
+		return errors.New("--update-branch pushes the campaign branch itself, so cannot be combined with --push")
+	}
+	if updateBranchFlag && !updateMethods[updateMethod] {
+		return fmt.Errorf("unknown update method %s: use rebase or merge", updateMethod)
 	}
-	for _, v := range args {
-		b[v] += 1
+	if (mergeFlag || enableAutoMergeFlag) && !github.MergeStrategies[mergeStrategy] {
+		return fmt.Errorf("unknown merge strategy %s: use merge, squash or rebase", mergeStrategy)
 	}
-	return b[true] == 1
+	if comment != "" && commentFile != "" {
+		return errors.New("use either --comment or --comment-file, not both")
+	}
+	if onlyState != "" && !prStates[strings.ToLower(onlyState)] {
+		return fmt.Errorf("unknown PR state %s: use open, closed or merged", onlyState)
+	}
+	if onlyState != "" && comment == "" && commentFile == "" {
+		return errors.New("--only-state needs --comment or --comment-file")
+	}
+	return nil
+}
+
+// actionResults tallies what became of an action across the repos of a campaign
+type actionResults struct {
+	doneCount  int
+	errorCount int
+	skipped    []skippedRepo
+	notAllowed []skippedRepo
+	conflicts  []conflictedRepo
 }
 
-func validateFlags(closeFlag bool, updateDescriptionFlag bool, pushFlag bool) error {
-	if !onlyOne(closeFlag, updateDescriptionFlag, pushFlag) {
-		return errors.New("update-prs needs one and only one action flag")
+// skippedRepo notes why an action left a repo's PR alone
+type skippedRepo struct {
+	repo   string
+	reason string
+}
+
+func (a *actionResults) add(repo string, res result) {
+	switch res.outcome {
+	case outcomeDone:
+		a.doneCount++
+	case outcomeSkipped:
+		a.skipped = append(a.skipped, skippedRepo{repo: repo, reason: res.reason})
+	case outcomeNotAllowed:
+		a.notAllowed = append(a.notAllowed, skippedRepo{repo: repo, reason: res.reason})
+	case outcomeFailed:
+		a.errorCount++
+		var conflictErr *conflictError
+		if errors.As(res.err, &conflictErr) {
+			a.conflicts = append(a.conflicts, conflictedRepo{repo: repo, files: conflictErr.files})
+		}
 	}
-	return nil
 }
 
-// we keep the args as one of the subfunctions might need it one day.
-func run(c *cobra.Command, args []string) {
+// run validates the flags, asks for confirmation once, and then runs the selected actions in each repo in turn
+func run(c *cobra.Command, _ []string) {
 	logger := logging.NewLogger(c)
-	if err := validateFlags(closeFlag, updateDescriptionFlag, pushFlag); err != nil {
+	if err := validateFlags(); err != nil {
 		logger.Errorf("Error while parsing the flags: %v", err)
 		return
 	}
-
-	if closeFlag {
-		runClose(c, args)
-	} else if updateDescriptionFlag {
-		runUpdatePrDescription(c, args)
-	} else if pushFlag {
-		runPush(c, args)
+	var err error
+	if commentTemplate, err = readComment(); err != nil {
+		logger.Errorf("Error while parsing the flags: %v", err)
+		return
 	}
-}
-
-func runClose(c *cobra.Command, _ []string) {
-	logger := logging.NewLogger(c)
+	actions := selectedActions()
 
 	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
 	options := campaign.NewCampaignOptions()
 	options.RepoFilename = repoFile
+	// the description file also gives the base branch that --update-branch brings campaign branches up to date with
+	if updateDescriptionFlag || updateBranchFlag {
+		options.PrDescriptionFilename = prDescriptionFile
+	}
 	dir, err := campaign.OpenCampaign(options)
 	if err != nil {
 		readCampaignActivity.EndWithFailure(err)
 		return
 	}
+	if syncTrackingIssueFlag && dir.State.GetTrackingIssue() == nil {
+		readCampaignActivity.EndWithFailuref("Campaign %s has no tracking issue: create one with turbolift create-prs --tracking-issue", dir.Name)
+		return
+	}
 	readCampaignActivity.EndWithSuccess()
 
-	// Prompting for confirmation
-	if !yesFlag {
-		// TODO: add the number of PRs that it will actually close
-		if !p.AskConfirm(fmt.Sprintf("Close %s campaign PRs for all repos in %s", dir.Name, repoFile)) {
+	// Prompting for confirmation, unless all that is asked for is to sync the tracking issue
+	if !yesFlag && len(actions) > 0 {
+		var descriptions []string
+		for _, a := range actions {
+			descriptions = append(descriptions, a.description)
+		}
+		if syncTrackingIssueFlag {
+			descriptions = append(descriptions, "sync the tracking issue")
+		}
+		if !p.AskConfirm(fmt.Sprintf("Update %s campaign PRs for all repos in %s: %s", dir.Name, repoFile, strings.Join(descriptions, "; "))) {
 			return
 		}
 	}
 
-	doneCount := 0
-	skippedCount := 0
-	errorCount := 0
-
-	for _, repo := range dir.Repos {
-
-		closeActivity := logger.StartActivity("Closing PR in %s", repo.FullRepoName)
-		// skip if the working copy does not exist
-		if _, err = os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
-			closeActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repo.FullRepoPath())
-			skippedCount++
-			continue
+	needsPrs := syncTrackingIssueFlag
+	for _, a := range actions {
+		needsPrs = needsPrs || a.needsPrs
+	}
+	var prStatuses map[string]*github.PrStatus
+	var prErrs map[string]error
+	if needsPrs {
+		if prStatuses, prErrs, err = fetchPrs(logger, dir); err != nil {
+			return
 		}
+	}
 
-		err = gh.ClosePullRequest(closeActivity.Writer(), repo.FullRepoPath(), dir.Name)
-		if err != nil {
-			if _, ok := err.(*github.NoPRFoundError); ok {
-				closeActivity.EndWithWarning(err)
-				skippedCount++
-			} else {
-				closeActivity.EndWithFailure(err)
-				errorCount++
+	// the PRs are recorded before any action runs, so that the state they leave the PRs in is kept
+	if syncTrackingIssueFlag {
+		for _, repo := range dir.Repos {
+			if prStatus, ok := prStatuses[repo.FullRepoName]; ok {
+				updateState(dir, repo, logger, func(r *state.RepoState) {
+					r.PrNumber = prStatus.Number
+					r.PrUrl = prStatus.Url
+					r.PrState = prStatus.State
+				})
 			}
-		} else {
-			closeActivity.EndWithSuccess()
-			doneCount++
 		}
 	}
 
-	if errorCount == 0 {
-		logger.Successf("turbolift update-prs completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
-	} else {
-		logger.Warnf("turbolift update-prs completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
-	}
-}
-
-func runUpdatePrDescription(c *cobra.Command, _ []string) {
-	logger := logging.NewLogger(c)
-
-	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
-	options := campaign.NewCampaignOptions()
-	options.RepoFilename = repoFile
-	options.PrDescriptionFilename = prDescriptionFile
-	dir, err := campaign.OpenCampaign(options)
-	if err != nil {
-		readCampaignActivity.EndWithFailure(err)
-		return
+	results := make([]actionResults, len(actions))
+	for _, repo := range dir.Repos {
+		r := &repoRun{dir: dir, repo: repo, logger: logger, prs: prStatuses, prErrs: prErrs}
+		failedAction := ""
+		for i, a := range actions {
+			// once an action has failed in a repo, the later ones would act on a PR that is not as intended
+			if failedAction != "" {
+				logger.StartActivity(a.activity, repo.FullRepoName).EndWithWarningf("Skipped as %s failed", failedAction)
+				results[i].add(repo.FullRepoName, skipped(fmt.Sprintf("%s failed", failedAction)))
+				continue
+			}
+			res := runAction(a, r)
+			if res.outcome == outcomeFailed {
+				failedAction = a.flagNames()
+			}
+			results[i].add(repo.FullRepoName, res)
+		}
 	}
-	readCampaignActivity.EndWithSuccess()
 
-	// Prompting for confirmation
-	if !yesFlag {
-		if !p.AskConfirm(fmt.Sprintf("Update %s campaign PR titles and descriptions for all repos listed in %s", dir.Name, repoFile)) {
-			return
+	prStatesChanged := false
+	for i, a := range actions {
+		if a.changesPrState && results[i].doneCount > 0 {
+			prStatesChanged = true
 		}
 	}
+	trackingIssueFailed := false
+	if dir.State.GetTrackingIssue() != nil && (syncTrackingIssueFlag || prStatesChanged) {
+		trackingIssueFailed = !syncTrackingIssue(logger, dir)
+	}
 
-	doneCount := 0
-	skippedCount := 0
-	errorCount := 0
-
-	for _, repo := range dir.Repos {
-		updatePrActivity := logger.StartActivity("Updating PR description in %s", repo.FullRepoName)
-
-		// skip if the working copy does not exist
-		if _, err = os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
-			updatePrActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repo.FullRepoPath())
-			skippedCount++
-			continue
+	printSummary(logger, actions, results, trackingIssueFailed)
+	for i := range actions {
+		if len(results[i].conflicts) > 0 {
+			writeConflictsFile(logger, results[i].conflicts)
 		}
+	}
+}
 
-		err = gh.UpdatePRDescription(updatePrActivity.Writer(), repo.FullRepoPath(), dir.PrTitle, dir.PrBody)
-		if err != nil {
-			if _, ok := err.(*github.NoPRFoundError); ok {
-				updatePrActivity.EndWithWarning(err)
-				skippedCount++
+// printSummary lists the repos that actions skipped or were not allowed in, and then the results of each action
+func printSummary(logger *logging.Logger, actions []action, results []actionResults, trackingIssueFailed bool) {
+	for i, a := range actions {
+		if a.listSkipped && len(results[i].skipped) > 0 {
+			logger.Println()
+			if len(actions) == 1 {
+				logger.Println("Skipped PRs:")
 			} else {
-				updatePrActivity.EndWithFailure(err)
-				errorCount++
+				logger.Printf("Skipped PRs (%s):", a.flagNames())
 			}
-		} else {
-			updatePrActivity.EndWithSuccess()
-			doneCount++
+			for _, s := range results[i].skipped {
+				logger.Printf("  %s: %s", s.repo, s.reason)
+			}
+			logger.Println()
+		}
+		if len(results[i].notAllowed) > 0 {
+			logger.Println()
+			logger.Println(a.notAllowedHeading)
+			for _, s := range results[i].notAllowed {
+				logger.Printf("  %s: %s", s.repo, s.reason)
+			}
+			logger.Println()
 		}
 	}
 
-	if errorCount == 0 {
-		logger.Successf("turbolift update-prs completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
+	hasErrors := trackingIssueFailed
+	var counts []string
+	for i, a := range actions {
+		count := fmt.Sprintf("%s, %s", colors.Green(results[i].doneCount, " OK"), colors.Yellow(len(results[i].skipped), " skipped"))
+		if results[i].errorCount > 0 {
+			count += fmt.Sprintf(", %s", colors.Red(results[i].errorCount, " errored"))
+			hasErrors = true
+		}
+		if len(actions) > 1 {
+			count = fmt.Sprintf("%s: %s", a.flagNames(), count)
+		}
+		counts = append(counts, count)
+	}
+
+	summary := ""
+	if len(counts) > 0 {
+		summary = fmt.Sprintf(" %s(%s)", colors.Normal(), strings.Join(counts, "; "))
+	}
+	if hasErrors {
+		logger.Warnf("turbolift update-prs completed with %s%s\n", colors.Red("errors"), summary)
 	} else {
-		logger.Warnf("turbolift update-prs completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+		logger.Successf("turbolift update-prs completed%s\n", summary)
 	}
 }
 
-func runPush(c *cobra.Command, _ []string) {
-	logger := logging.NewLogger(c)
-
-	readCampaignActivity := logger.StartActivity("Reading campaign data (%s)", repoFile)
-	options := campaign.NewCampaignOptions()
-	options.RepoFilename = repoFile
-	dir, err := campaign.OpenCampaign(options)
+// syncTrackingIssue brings the campaign's tracking issue up to date with the PRs recorded in the campaign state,
+// reporting whether it succeeded
+func syncTrackingIssue(logger *logging.Logger, dir *campaign.Campaign) bool {
+	syncActivity := logger.StartActivity("Updating tracking issue %s", dir.State.GetTrackingIssue().Url)
+	updated, err := tracking.Sync(syncActivity.Writer(), gh, dir)
 	if err != nil {
-		readCampaignActivity.EndWithFailure(err)
-		return
+		syncActivity.EndWithFailure(err)
+		return false
 	}
-	readCampaignActivity.EndWithSuccess()
-
-	// Prompting for confirmation
-	if !yesFlag {
-		if !p.AskConfirm(fmt.Sprintf("Push new commits to %s campaign PRs for all repos in %s", dir.Name, repoFile)) {
-			return
-		}
-	}
-
-	doneCount := 0
-	skippedCount := 0
-	errorCount := 0
-
-	for _, repo := range dir.Repos {
-		pushActivity := logger.StartActivity("Pushing changes in %s to origin", repo.FullRepoName)
-		// skip if the working copy does not exist
-		if _, err = os.Stat(repo.FullRepoPath()); os.IsNotExist(err) {
-			pushActivity.EndWithWarningf("Directory %s does not exist - has it been cloned?", repo.FullRepoPath())
-			skippedCount++
-			continue
-		}
-
-		err := g.Push(pushActivity.Writer(), repo.FullRepoPath(), "origin", dir.Name)
-		if err != nil {
-			pushActivity.EndWithFailure(err)
-			errorCount++
-			continue
-		}
-		pushActivity.EndWithSuccess()
-		doneCount++
+	if !updated {
+		syncActivity.Log("The tracking issue is already up to date")
 	}
+	syncActivity.EndWithSuccessAndEmitLogs()
+	return true
+}
 
-	if errorCount == 0 {
-		logger.Successf("turbolift update-prs completed %s(%s, %s)\n", colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"))
-	} else {
-		logger.Warnf("turbolift update-prs completed with %s %s(%s, %s, %s)\n", colors.Red("errors"), colors.Normal(), colors.Green(doneCount, " OK"), colors.Yellow(skippedCount, " skipped"), colors.Red(errorCount, " errored"))
+func updateState(dir *campaign.Campaign, repo campaign.Repo, logger *logging.Logger, update func(*state.RepoState)) {
+	if err := dir.State.Update(repo.FullRepoName, update); err != nil {
+		logger.Warnf("Unable to record the state of %s: %v", repo.FullRepoName, err)
 	}
 }
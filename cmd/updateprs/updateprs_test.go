@@ -2,32 +2,96 @@ package updateprs
 
 import (
 	"bytes"
+	"errors"
 	"github.com/skyscanner/turbolift/internal/git"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 
+	"github.com/skyscanner/turbolift/internal/campaign"
 	"github.com/skyscanner/turbolift/internal/github"
 	"github.com/skyscanner/turbolift/internal/prompt"
+	"github.com/skyscanner/turbolift/internal/state"
 	"github.com/skyscanner/turbolift/internal/testsupport"
 )
 
 func TestValidateFlagsNoneSet(t *testing.T) {
-	err := validateFlags(false, false, false)
+	NewUpdatePRsCmd()
+	err := validateFlags()
 	assert.Error(t, err)
-	assert.Equal(t, "update-prs needs one and only one action flag", err.Error())
+	assert.Equal(t, "update-prs needs at least one action flag", err.Error())
 }
 
 func TestValidateFlagsMultipleSet(t *testing.T) {
-	err := validateFlags(true, false, true)
-	assert.Error(t, err)
-	assert.Equal(t, "update-prs needs one and only one action flag", err.Error())
+	NewUpdatePRsCmd()
+	pushFlag = true
+	updateDescriptionFlag = true
+	comment = "Rebased"
+	assert.NoError(t, validateFlags())
 }
 
 func TestValidateFlagsSingleSet(t *testing.T) {
-	err := validateFlags(true, false, false)
-	assert.NoError(t, err)
+	NewUpdatePRsCmd()
+	closeFlag = true
+	assert.NoError(t, validateFlags())
+}
+
+func TestValidateFlagsConflictingActions(t *testing.T) {
+	NewUpdatePRsCmd()
+	closeFlag = true
+	mergeFlag = true
+	err := validateFlags()
+	assert.Error(t, err)
+	assert.Equal(t, "--close cannot be combined with --merge or --enable-auto-merge", err.Error())
+
+	NewUpdatePRsCmd()
+	enableAutoMergeFlag = true
+	disableAutoMergeFlag = true
+	err = validateFlags()
+	assert.Error(t, err)
+	assert.Equal(t, "--enable-auto-merge and --disable-auto-merge cannot be combined", err.Error())
+
+	NewUpdatePRsCmd()
+	readyFlag = true
+	toDraftFlag = true
+	err = validateFlags()
+	assert.Error(t, err)
+	assert.Equal(t, "--ready and --to-draft cannot be combined", err.Error())
+
+	NewUpdatePRsCmd()
+	pushFlag = true
+	readyFlag = true
+	ifChecksPassFlag = true
+	err = validateFlags()
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "--if-checks-pass cannot be combined with --push")
+
+	NewUpdatePRsCmd()
+	updateBranchFlag = true
+	pushFlag = true
+	err = validateFlags()
+	assert.Error(t, err)
+	assert.Equal(t, "--update-branch pushes the campaign branch itself, so cannot be combined with --push", err.Error())
+
+	for _, changesPr := range []*bool{&pushFlag, &updateBranchFlag, &toDraftFlag} {
+		NewUpdatePRsCmd()
+		mergeFlag = true
+		*changesPr = true
+		err = validateFlags()
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "--merge cannot be combined with --push, --update-branch or --to-draft")
+	}
+
+	NewUpdatePRsCmd()
+	closeFlag = true
+	onlyState = "open"
+	err = validateFlags()
+	assert.Error(t, err)
+	assert.Equal(t, "--only-state needs --comment or --comment-file", err.Error())
 }
 
 func TestItLogsClosePrErrorsButContinuesToTryAll(t *testing.T) {
@@ -145,6 +209,45 @@ func TestItUpdatesDescriptionsSuccessfully(t *testing.T) {
 	})
 }
 
+func TestItRendersDescriptionsForEachRepo(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	_ = os.WriteFile("README.md", []byte("---\ntemplate: true\n---\n# Update {{.Repo.RepoName}}\nBumps from {{.Metadata.version}} on {{.DefaultBranch}}"), 0o644)
+	_ = os.WriteFile("metadata.json", []byte(`{"org/repo1": {"version": "1.0"}, "org/repo2": {"version": "2.0"}}`), 0o644)
+
+	out, err := runUpdateDescriptionCommandAuto("README.md")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "2 OK, 0 skipped")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"update_pr_description", "work/org/repo1", "Update repo1", "Bumps from 1.0 on main"},
+		{"update_pr_description", "work/org/repo2", "Update repo2", "Bumps from 2.0 on main"},
+	})
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"defaultBranch", "work/org/repo1", "origin"},
+		{"defaultBranch", "work/org/repo2", "origin"},
+	})
+}
+
+func TestItDoesNotUpdateDescriptionsThatCannotBeRendered(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	_ = os.WriteFile("README.md", []byte("---\ntemplate: true\n---\n# PR title\nBumps from {{.Metadata.version"), 0o644)
+
+	out, err := runUpdateDescriptionCommandAuto("README.md")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "unable to parse PR description template")
+	assert.Contains(t, out, "1 errored")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
 func TestItUpdatesDescriptionsFromAlternativeFile(t *testing.T) {
 	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
 	gh = fakeGitHub
@@ -165,6 +268,41 @@ func TestItUpdatesDescriptionsFromAlternativeFile(t *testing.T) {
 	})
 }
 
+func TestItRemovesLabelsReviewersAndAssigneesDroppedFromTheFrontMatter(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/repo1": {Number: 7, State: "OPEN"},
+	})
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	_ = os.WriteFile("README.md", []byte("---\nlabels: [dependencies]\nteam_reviewers: [platform]\n---\n# PR title\nPR body"), 0o644)
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.NoError(t, dir.State.Update("org/repo1", func(s *state.RepoState) {
+		s.AppliedLabels = []string{"dependencies", "automated"}
+		s.AppliedReviewers = []string{"octocat", "org/platform"}
+		s.AppliedAssignees = []string{"hubot"}
+	}))
+
+	out, err := runUpdateDescriptionCommandAuto("README.md")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "1 OK, 0 skipped")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"update_pr_description", "work/org/repo1", "PR title", "PR body", "labels=dependencies", "team_reviewers=platform"},
+		{"get_pr", "work/org/repo1"},
+		{"remove_labels", "org/repo1", "7", "automated"},
+		{"remove_reviewers", "org/repo1", "7", "octocat"},
+		{"remove_assignees", "org/repo1", "7", "hubot"},
+	})
+
+	campaignState, err := state.Load(state.DefaultFilename, testsupport.Pwd())
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"dependencies"}, campaignState.Get("org/repo1").AppliedLabels)
+	assert.Equal(t, []string{"org/platform"}, campaignState.Get("org/repo1").AppliedReviewers)
+	assert.Empty(t, campaignState.Get("org/repo1").AppliedAssignees)
+}
+
 func TestItDoesNotUpdateDescriptionsIfNotConfirmed(t *testing.T) {
 	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
 	gh = fakeGitHub
@@ -200,10 +338,109 @@ func TestItPushesNewCommits(t *testing.T) {
 
 	fakeGit.AssertCalledWith(t, [][]string{
 		{"push", "work/org/repo1", filepath.Base(tempDir)},
+		{"getHeadSHA", "work/org/repo1"},
 		{"push", "work/org/repo2", filepath.Base(tempDir)},
+		{"getHeadSHA", "work/org/repo2"},
 	})
 }
 
+func TestItRebasesCampaignBranchesAndListsReposWithConflicts(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		if call[0] == "rebase" && call[1] == "work/org/conflicted" {
+			return false, errors.New("synthetic conflict")
+		}
+		return true, nil
+	})
+	g = fakeGit
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1", "org/conflicted")
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.NoError(t, dir.State.Update("org/repo1", func(s *state.RepoState) {
+		s.PushedSHA = "previouslypushed"
+	}))
+
+	out, err := runUpdateBranchCommand(updateMethodRebase)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "conflicts with origin/main in README.md")
+	assert.Contains(t, out, "turbolift update-prs completed with errors")
+	assert.Contains(t, out, "1 OK, 0 skipped, 1 errored")
+	assert.Contains(t, out, "Names of repos with conflicts have been written to conflicting-repos.txt")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"getHeadSHA", "work/org/repo1"},
+		{"rebase", "work/org/repo1", "origin/main"},
+		{"getHeadSHA", "work/org/repo1"},
+		{"forcePushWithLease", "work/org/repo1", filepath.Base(tempDir), "previouslypushed"},
+		{"fetch", "work/org/conflicted", "origin", "main"},
+		{"getHeadSHA", "work/org/conflicted"},
+		{"rebase", "work/org/conflicted", "origin/main"},
+		{"conflictingFiles", "work/org/conflicted"},
+		{"abortRebase", "work/org/conflicted"},
+	})
+
+	conflicts, err := os.ReadFile("conflicting-repos.txt")
+	assert.NoError(t, err)
+	assert.Contains(t, string(conflicts), "# README.md\norg/conflicted\n")
+	assert.NotContains(t, string(conflicts), "org/repo1")
+}
+
+func TestItDoesNotPushBranchesThatAreAlreadyUpToDateWithTheBase(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		return false, nil
+	})
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+	_ = os.WriteFile("README.md", []byte("---\nbase: develop\n---\n# PR title\nPR body"), 0o644)
+
+	out, err := runUpdateBranchCommand(updateMethodMerge)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "already up to date with origin/develop")
+	assert.Contains(t, out, "0 OK, 1 skipped")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"fetch", "work/org/repo1", "origin", "develop"},
+		{"getHeadSHA", "work/org/repo1"},
+		{"merge", "work/org/repo1", "origin/develop"},
+		{"getHeadSHA", "work/org/repo1"},
+	})
+}
+
+func TestItFailsToMergeTheDefaultBranchWithoutConflicts(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		if call[0] == "merge" {
+			return false, errors.New("synthetic error")
+		}
+		return false, nil
+	})
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runUpdateBranchCommand(updateMethodMerge)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "synthetic error")
+	assert.Contains(t, out, "0 OK, 0 skipped, 1 errored")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"fetch", "work/org/repo1", "origin", "main"},
+		{"getHeadSHA", "work/org/repo1"},
+		{"merge", "work/org/repo1", "origin/main"},
+		{"conflictingFiles", "work/org/repo1"},
+	})
+	_, err = os.Stat("conflicting-repos.txt")
+	assert.True(t, os.IsNotExist(err))
+}
+
 func TestItLogsPushErrorsButContinuesToTryAll(t *testing.T) {
 	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
 	gh = fakeGitHub
@@ -243,6 +480,511 @@ func TestItDoesNotPushIfNotConfirmed(t *testing.T) {
 	fakeGitHub.AssertCalledWith(t, [][]string{})
 }
 
+func TestItSyncsTheTrackingIssueWithThePrs(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/repo1" {
+			return &github.PrStatus{Number: 3, Url: "https://github.com/org/repo1/pull/3", State: "MERGED"}, nil
+		}
+		return &github.PrStatus{Number: 4, Url: "https://github.com/org/repo2/pull/4", State: "CLOSED"}, nil
+	})
+	gh = fakeGitHub
+	fakeGitHub.SetIssueBody("org/tracking", 5, "Hand-written notes")
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+	assert.NoError(t, dir.State.SetTrackingIssue(state.TrackingIssue{Repo: "org/tracking", Number: 5, Url: "https://github.com/org/tracking/issues/5"}))
+
+	out, err := runSyncTrackingIssueCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Updating tracking issue https://github.com/org/tracking/issues/5")
+	assert.Contains(t, out, "turbolift update-prs completed")
+
+	issue, err := fakeGitHub.GetIssue(nil, "org/tracking", 5)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(issue.Body, "Hand-written notes\n\n"))
+	assert.Contains(t, issue.Body, "1 of 2 PRs merged.\n\n- [x] org/repo1 https://github.com/org/repo1/pull/3\n- [ ] ~~org/repo2 https://github.com/org/repo2/pull/4~~ (closed)\n")
+
+	out, err = runSyncTrackingIssueCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "The tracking issue is already up to date")
+}
+
+func TestItNeedsATrackingIssueToSync(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runSyncTrackingIssueCommand()
+	assert.NoError(t, err)
+	assert.Contains(t, out, "has no tracking issue")
+	assert.NotContains(t, out, "turbolift update-prs completed")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItOnlyMergesPrsThatAreReady(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/ready": {Number: 1, State: "OPEN", ReviewDecision: "APPROVED", Mergeable: "MERGEABLE",
+			StatusCheckRollup: []github.StatusCheckRollup{{State: "SUCCESS", Name: "build"}, {State: "SKIPPED", Name: "deploy"}}},
+		"work/org/unapproved": {Number: 2, State: "OPEN", ReviewDecision: "REVIEW_REQUIRED", Mergeable: "MERGEABLE"},
+		"work/org/failing": {Number: 3, State: "OPEN", ReviewDecision: "APPROVED", Mergeable: "MERGEABLE",
+			StatusCheckRollup: []github.StatusCheckRollup{{State: "FAILURE", Name: "build"}, {State: "PENDING", Name: "lint"}}},
+		"work/org/pending": {Number: 4, State: "OPEN", ReviewDecision: "APPROVED", Mergeable: "MERGEABLE",
+			StatusCheckRollup: []github.StatusCheckRollup{{State: "PENDING", Name: "lint"}}},
+		"work/org/conflicting": {Number: 5, State: "OPEN", ReviewDecision: "APPROVED", Mergeable: "CONFLICTING"},
+		"work/org/merged":      {Number: 6, State: "MERGED", ReviewDecision: "APPROVED"},
+		"work/org/draft":       {Number: 7, State: "OPEN", IsDraft: true, ReviewDecision: "APPROVED", Mergeable: "MERGEABLE"},
+	})
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(false, "org/ready", "org/unapproved", "org/failing", "org/pending", "org/conflicting", "org/merged", "org/draft", "org/nopr")
+
+	out, err := runMergeCommand("squash", true)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Skipped PRs:\n"+
+		"  org/unapproved: not approved (REVIEW_REQUIRED)\n"+
+		"  org/failing: checks failing: build\n"+
+		"  org/pending: checks pending: lint\n"+
+		"  org/conflicting: has merge conflicts\n"+
+		"  org/merged: PR is merged\n"+
+		"  org/draft: PR is a draft\n"+
+		"  org/nopr: no PR found for branch")
+	assert.Contains(t, out, "turbolift update-prs completed (1 OK, 7 skipped)")
+
+	campaignState, err := state.Load(state.DefaultFilename, testsupport.Pwd())
+	assert.NoError(t, err)
+	assert.Equal(t, "MERGED", campaignState.Get("org/ready").PrState)
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_prs", campaign.ApplyCampaignNamePrefix(filepath.Base(tempDir)), "org/ready", "org/unapproved", "org/failing", "org/pending", "org/conflicting", "org/merged", "org/draft", "org/nopr"},
+		{"merge_pull_request", "org/ready", "1", "squash", "delete_branch"},
+	})
+}
+
+func TestItFailsForReposWhosePrCannotBeLookedUp(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		if workingDir == "work/org/ready" {
+			return &github.PrStatus{Number: 1, State: "OPEN", ReviewDecision: "APPROVED", Mergeable: "MERGEABLE"}, nil
+		}
+		return nil, errors.New("synthetic error")
+	})
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(false, "org/ready", "org/unknown")
+
+	out, err := runMergeCommand("squash", true)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Unable to get the PRs of 1 repos")
+	assert.Contains(t, out, "unable to look up the PR: synthetic error")
+	assert.Contains(t, out, "turbolift update-prs completed with errors (1 OK, 0 skipped, 1 errored)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_prs", campaign.ApplyCampaignNamePrefix(filepath.Base(tempDir)), "org/ready", "org/unknown"},
+		{"merge_pull_request", "org/ready", "1", "squash", "delete_branch"},
+	})
+}
+
+func TestItRejectsUnknownMergeStrategies(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	out, err := runMergeCommand("octopus", false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "unknown merge strategy octopus")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItDoesNotMergeIfNotConfirmed(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+	fakePrompt := prompt.NewFakePromptNo()
+	p = fakePrompt
+
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	cmd := NewUpdatePRsCmd()
+	mergeFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	assert.NoError(t, cmd.Execute())
+	assert.NotContains(t, outBuffer.String(), "turbolift update-prs completed")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItEnablesAutoMergeOnOpenPrsAndListsReposThatDoNotAllowIt(t *testing.T) {
+	prs := map[string]*github.PrStatus{
+		"work/org/repo1":      {Number: 1, State: "OPEN"},
+		"work/org/notallowed": {Number: 2, State: "OPEN"},
+		"work/org/closed":     {Number: 3, State: "CLOSED"},
+	}
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.EnableAutoMerge && args[1] == "org/notallowed" {
+			return false, &github.AutoMergeNotAllowedError{Repo: args[1], Reason: "it is not enabled in the repository settings"}
+		}
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		if pr, ok := prs[workingDir]; ok {
+			return pr, nil
+		}
+		return nil, &github.NoPRFoundError{Path: workingDir}
+	})
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(false, "org/repo1", "org/notallowed", "org/closed")
+
+	out, err := runAutoMergeCommand(true, "rebase")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Skipped PRs:\n  org/closed: PR is closed")
+	assert.Contains(t, out, "Auto-merge is not allowed in these repos, so their PRs will need merging by other means:\n"+
+		"  org/notallowed: it is not enabled in the repository settings")
+	assert.Contains(t, out, "turbolift update-prs completed (1 OK, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_prs", campaign.ApplyCampaignNamePrefix(filepath.Base(tempDir)), "org/repo1", "org/notallowed", "org/closed"},
+		{"enable_auto_merge", "org/repo1", "1", "rebase"},
+		{"enable_auto_merge", "org/notallowed", "2", "rebase"},
+	})
+}
+
+func TestItDisablesAutoMergeOnOpenPrs(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/repo1": {Number: 1, State: "OPEN"},
+	})
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(false, "org/repo1", "org/nopr")
+
+	out, err := runAutoMergeCommand(false, github.MergeStrategyMerge)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "org/nopr: no PR found for branch")
+	assert.Contains(t, out, "turbolift update-prs completed (1 OK, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_prs", campaign.ApplyCampaignNamePrefix(filepath.Base(tempDir)), "org/repo1", "org/nopr"},
+		{"disable_auto_merge", "org/repo1", "1"},
+	})
+}
+
+func TestItMarksDraftPrsAsReadyOnceTheirChecksPass(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/green":   {Number: 1, State: "OPEN", IsDraft: true, StatusCheckRollup: []github.StatusCheckRollup{{Name: "build", State: "SUCCESS"}}},
+		"work/org/failing": {Number: 2, State: "OPEN", IsDraft: true, StatusCheckRollup: []github.StatusCheckRollup{{Name: "build", State: "FAILURE"}}},
+		"work/org/pending": {Number: 3, State: "OPEN", IsDraft: true, StatusCheckRollup: []github.StatusCheckRollup{{Name: "build", State: "PENDING"}}},
+		"work/org/ready":   {Number: 4, State: "OPEN"},
+	})
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(false, "org/green", "org/failing", "org/pending", "org/ready")
+
+	out, err := runDraftCommand(true, true)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "org/failing: checks failing: build")
+	assert.Contains(t, out, "org/pending: checks pending: build")
+	assert.Contains(t, out, "org/ready: PR is already ready for review")
+	assert.Contains(t, out, "turbolift update-prs completed (1 OK, 3 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_prs", campaign.ApplyCampaignNamePrefix(filepath.Base(tempDir)), "org/green", "org/failing", "org/pending", "org/ready"},
+		{"mark_pr_ready", "org/green", "1"},
+	})
+}
+
+func TestItConvertsOpenPrsToDraftsWhateverTheirChecks(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/repo1":  {Number: 1, State: "OPEN", StatusCheckRollup: []github.StatusCheckRollup{{Name: "build", State: "FAILURE"}}},
+		"work/org/draft":  {Number: 2, State: "OPEN", IsDraft: true},
+		"work/org/merged": {Number: 3, State: "MERGED"},
+	})
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(false, "org/repo1", "org/draft", "org/merged")
+
+	out, err := runDraftCommand(false, false)
+	assert.NoError(t, err)
+	assert.Contains(t, out, "org/draft: PR is already a draft")
+	assert.Contains(t, out, "org/merged: PR is merged")
+	assert.Contains(t, out, "turbolift update-prs completed (1 OK, 2 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_prs", campaign.ApplyCampaignNamePrefix(filepath.Base(tempDir)), "org/repo1", "org/draft", "org/merged"},
+		{"convert_pr_to_draft", "org/repo1", "1"},
+	})
+}
+
+func TestItReopensClosedPrsAndReportsThoseThatCannotBeReopenedSeparately(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/closed":   {Number: 1, State: "CLOSED"},
+		"work/org/merged":   {Number: 2, State: "MERGED"},
+		"work/org/deleted":  {Number: 3, State: "CLOSED"},
+		"work/org/reopened": {Number: 4, State: "OPEN"},
+	})
+	gh = fakeGitHub
+	fakeGit := git.NewFakeGit(func(_ io.Writer, call []string) (bool, error) {
+		return call[1] != "work/org/deleted", nil
+	})
+	g = fakeGit
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/closed", "org/merged", "org/deleted", "org/reopened")
+
+	out, err := runReopenCommand("Reopening {{.Repo.RepoName}} as it is still needed")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Skipped PRs:\n  org/reopened: PR is already open")
+	assert.Contains(t, out, "These PRs cannot be reopened:\n"+
+		"  org/merged: PR was merged\n"+
+		"  org/deleted: branch "+filepath.Base(tempDir)+" has been deleted")
+	assert.Contains(t, out, "turbolift update-prs completed (1 OK, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_prs", campaign.ApplyCampaignNamePrefix(filepath.Base(tempDir)), "org/closed", "org/merged", "org/deleted", "org/reopened"},
+		{"reopen_pull_request", "org/closed", "1"},
+		{"comment_on_pr", "org/closed", "1", "Reopening closed as it is still needed"},
+	})
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"remoteBranchExists", "work/org/closed", filepath.Base(tempDir)},
+		{"remoteBranchExists", "work/org/deleted", filepath.Base(tempDir)},
+	})
+}
+
+func TestItCommentsOnPrsWithATemplatedComment(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/repo1": {Number: 4, State: "OPEN"},
+		"work/org/repo2": {Number: 5, State: "MERGED"},
+	})
+	gh = fakeGitHub
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2", "org/repo3")
+	campaignName := campaign.ApplyCampaignNamePrefix(filepath.Base(tempDir))
+
+	out, err := runCommentCommand("Rebased {{.Repo.RepoName}} for {{.Campaign}}", "", "")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "Commenting on PR in org/repo3")
+	assert.Contains(t, out, "no PR found")
+	assert.Contains(t, out, "turbolift update-prs completed (2 OK, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_pr", "work/org/repo1"},
+		{"comment_on_pr", "org/repo1", "4", "Rebased repo1 for " + campaignName},
+		{"get_pr", "work/org/repo2"},
+		{"comment_on_pr", "org/repo2", "5", "Rebased repo2 for " + campaignName},
+		{"get_pr", "work/org/repo3"},
+	})
+}
+
+func TestItOnlyCommentsOnPrsInTheGivenState(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/repo1": {Number: 4, State: "OPEN"},
+		"work/org/repo2": {Number: 5, State: "MERGED"},
+	})
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+	assert.NoError(t, os.WriteFile("comment.md", []byte("Please review"), 0o644))
+
+	out, err := runCommentCommand("", "comment.md", "open")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "PR is merged")
+	assert.Contains(t, out, "turbolift update-prs completed (1 OK, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_pr", "work/org/repo1"},
+		{"comment_on_pr", "org/repo1", "4", "Please review"},
+		{"get_pr", "work/org/repo2"},
+	})
+}
+
+func TestItRejectsBothACommentAndACommentFile(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	out, err := runCommentCommand("Please review", "comment.md", "")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "use either --comment or --comment-file, not both")
+
+	out, err = runCommentCommand("Please review", "", "draft")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "unknown PR state draft")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{})
+}
+
+func TestItEditsTheLabelsReviewersAndAssigneesOfPrs(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/repo1": {Number: 4, State: "OPEN"},
+	})
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	cmd := NewUpdatePRsCmd()
+	addLabels = []string{"ready"}
+	removeLabels = []string{"wip", "blocked"}
+	addReviewers = []string{"alice", "org/platform"}
+	assignees = []string{"bob"}
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, outBuffer.String(), "Editing PR in org/repo2")
+	assert.Contains(t, outBuffer.String(), "no PR found")
+	assert.Contains(t, outBuffer.String(), "turbolift update-prs completed (1 OK, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_pr", "work/org/repo1"},
+		{"remove_labels", "org/repo1", "4", "wip", "blocked"},
+		{"add_labels", "org/repo1", "4", "ready"},
+		{"add_reviewers", "org/repo1", "4", "alice", "org/platform"},
+		{"add_assignees", "org/repo1", "4", "bob"},
+		{"get_pr", "work/org/repo2"},
+	})
+}
+
+func TestItStopsEditingAPrWhenAnEditFails(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.RemoveReviewers {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return &github.PrStatus{Number: 4, State: "OPEN"}, nil
+	})
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	cmd := NewUpdatePRsCmd()
+	removeReviewers = []string{"alice"}
+	assignees = []string{"bob"}
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, outBuffer.String(), "removing reviewers: synthetic error")
+	assert.Contains(t, outBuffer.String(), "1 errored")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_pr", "work/org/repo1"},
+		{"remove_reviewers", "org/repo1", "4", "alice"},
+	})
+}
+
+func TestItRunsSeveralActionsInOnePassWithOneConfirmation(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/repo1": {Number: 4, State: "OPEN"},
+		"work/org/repo2": {Number: 5, State: "OPEN"},
+	})
+	gh = fakeGitHub
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+	g = fakeGit
+	p = prompt.NewFakePromptYes()
+
+	tempDir := testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	cmd := NewUpdatePRsCmd()
+	pushFlag = true
+	updateDescriptionFlag = true
+	comment = "New commits pushed"
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, outBuffer.String(), "turbolift update-prs completed (--push: 2 OK, 0 skipped; --amend-description: 2 OK, 0 skipped; --comment: 2 OK, 0 skipped)")
+
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"push", "work/org/repo1", filepath.Base(tempDir)},
+		{"getHeadSHA", "work/org/repo1"},
+		{"push", "work/org/repo2", filepath.Base(tempDir)},
+		{"getHeadSHA", "work/org/repo2"},
+	})
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"update_pr_description", "work/org/repo1", "PR title", "PR body"},
+		{"get_pr", "work/org/repo1"},
+		{"comment_on_pr", "org/repo1", "4", "New commits pushed"},
+		{"update_pr_description", "work/org/repo2", "PR title", "PR body"},
+		{"get_pr", "work/org/repo2"},
+		{"comment_on_pr", "org/repo2", "5", "New commits pushed"},
+	})
+}
+
+func TestItSkipsTheRemainingActionsInARepoOnceOneFails(t *testing.T) {
+	fakeGitHub := fakeGitHubWithPrs(map[string]*github.PrStatus{
+		"work/org/repo1": {Number: 4, State: "OPEN"},
+		"work/org/repo2": {Number: 5, State: "OPEN"},
+	})
+	gh = fakeGitHub
+	fakeGit := git.NewFakeGit(func(output io.Writer, call []string) (bool, error) {
+		if call[0] == "push" && call[1] == "work/org/repo1" {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	})
+	g = fakeGit
+
+	testsupport.PrepareTempCampaign(true, "org/repo1", "org/repo2")
+
+	cmd := NewUpdatePRsCmd()
+	pushFlag = true
+	comment = "New commits pushed"
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, outBuffer.String(), "Skipped as --push failed")
+	assert.Contains(t, outBuffer.String(), "turbolift update-prs completed with errors (--push: 1 OK, 0 skipped, 1 errored; --comment: 1 OK, 1 skipped)")
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_pr", "work/org/repo2"},
+		{"comment_on_pr", "org/repo2", "5", "New commits pushed"},
+	})
+}
+
+func TestItNamesPrEditsByTheFlagsGiven(t *testing.T) {
+	fakeGitHub := github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		if command == github.AddLabels {
+			return false, errors.New("synthetic error")
+		}
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		return &github.PrStatus{Number: 4, State: "OPEN"}, nil
+	})
+	gh = fakeGitHub
+
+	testsupport.PrepareTempCampaign(true, "org/repo1")
+
+	cmd := NewUpdatePRsCmd()
+	addLabels = []string{"ready"}
+	assignees = []string{"bob"}
+	comment = "Labelled"
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	assert.NoError(t, cmd.Execute())
+	assert.Contains(t, outBuffer.String(), "Skipped as --add-label, --assign failed")
+	assert.Contains(t, outBuffer.String(), "turbolift update-prs completed with errors (--add-label, --assign: 0 OK, 0 skipped, 1 errored; --comment: 0 OK, 1 skipped)")
+}
+
+// fakeGitHubWithPrs returns a FakeGitHub that finds the given PRs, keyed by working copy, and no others
+func fakeGitHubWithPrs(prs map[string]*github.PrStatus) *github.FakeGitHub {
+	return github.NewFakeGitHub(func(command github.Command, args []string) (bool, error) {
+		return true, nil
+	}, func(workingDir string) (interface{}, error) {
+		if pr, ok := prs[workingDir]; ok {
+			return pr, nil
+		}
+		return nil, &github.NoPRFoundError{Path: workingDir}
+	})
+}
+
 func runCloseCommandAuto() (string, error) {
 	cmd := NewUpdatePRsCmd()
 	closeFlag = true
@@ -309,6 +1051,17 @@ func runPushCommandAuto() (string, error) {
 	return outBuffer.String(), nil
 }
 
+func runUpdateBranchCommand(method string) (string, error) {
+	cmd := NewUpdatePRsCmd()
+	updateBranchFlag = true
+	updateMethod = method
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
+
 func runPushCommandConfirm() (string, error) {
 	cmd := NewUpdatePRsCmd()
 	pushFlag = true
@@ -321,3 +1074,71 @@ func runPushCommandConfirm() (string, error) {
 	}
 	return outBuffer.String(), nil
 }
+
+func runSyncTrackingIssueCommand() (string, error) {
+	cmd := NewUpdatePRsCmd()
+	syncTrackingIssueFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
+
+func runMergeCommand(strategy string, deleteBranch bool) (string, error) {
+	cmd := NewUpdatePRsCmd()
+	mergeFlag = true
+	mergeStrategy = strategy
+	deleteBranchFlag = deleteBranch
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
+
+func runAutoMergeCommand(enable bool, strategy string) (string, error) {
+	cmd := NewUpdatePRsCmd()
+	enableAutoMergeFlag = enable
+	disableAutoMergeFlag = !enable
+	mergeStrategy = strategy
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
+
+func runDraftCommand(ready bool, ifChecksPass bool) (string, error) {
+	cmd := NewUpdatePRsCmd()
+	readyFlag = ready
+	toDraftFlag = !ready
+	ifChecksPassFlag = ifChecksPass
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
+
+func runReopenCommand(message string) (string, error) {
+	cmd := NewUpdatePRsCmd()
+	reopenFlag = true
+	reopenComment = message
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
+
+func runCommentCommand(message string, file string, state string) (string, error) {
+	cmd := NewUpdatePRsCmd()
+	comment = message
+	commentFile = file
+	onlyState = state
+	yesFlag = true
+	outBuffer := bytes.NewBufferString("")
+	cmd.SetOut(outBuffer)
+	err := cmd.Execute()
+	return outBuffer.String(), err
+}
@@ -22,6 +22,8 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+
+	"github.com/skyscanner/turbolift/internal/state"
 )
 
 const CampaignPrefix = "turbolift-"
@@ -38,6 +40,11 @@ type Campaign struct {
 	Repos   []Repo
 	PrTitle string
 	PrBody  string
+	// PrOptions are the settings given in the front matter of the PR description file
+	PrOptions PrOptions
+	State     *state.State
+	// Metadata holds any per-repo values that the PR title and description templates can refer to
+	Metadata map[string]map[string]interface{}
 }
 
 func (r Repo) FullRepoPath() string {
@@ -47,12 +54,16 @@ func (r Repo) FullRepoPath() string {
 type CampaignOptions struct {
 	RepoFilename          string
 	PrDescriptionFilename string
+	StateFilename         string
+	MetadataFilename      string
 }
 
 func NewCampaignOptions() *CampaignOptions {
 	return &CampaignOptions{
 		RepoFilename:          "repos.txt",
 		PrDescriptionFilename: "README.md",
+		StateFilename:         state.DefaultFilename,
+		MetadataFilename:      "metadata.json",
 	}
 }
 
@@ -72,16 +83,30 @@ func OpenCampaign(options *CampaignOptions) (*Campaign, error) {
 		return nil, err
 	}
 
-	prTitle, prBody, err := readPrDescriptionFile(options.PrDescriptionFilename)
+	prTitle, prBody, prOptions, err := readPrDescriptionFile(options.PrDescriptionFilename)
+	if err != nil {
+		return nil, err
+	}
+
+	name := ApplyCampaignNamePrefix(dirBasename)
+	campaignState, err := state.Load(options.StateFilename, name)
+	if err != nil {
+		return nil, err
+	}
+
+	metadata, err := readMetadataFile(options.MetadataFilename)
 	if err != nil {
 		return nil, err
 	}
 
 	return &Campaign{
-		Name:    ApplyCampaignNamePrefix(dirBasename),
-		Repos:   repos,
-		PrTitle: prTitle,
-		PrBody:  prBody,
+		Name:      name,
+		Repos:     repos,
+		PrTitle:   prTitle,
+		PrBody:    prBody,
+		PrOptions: prOptions,
+		State:     campaignState,
+		Metadata:  metadata,
 	}, nil
 }
 
@@ -115,18 +140,19 @@ func readReposTxtFile(filename string) ([]Repo, error) {
 			numParts := len(splitLine)
 
 			var repo Repo
-			switch numParts {
-			case 2:
+			switch {
+			case numParts == 2:
 				repo = Repo{
 					OrgName:      splitLine[0],
 					RepoName:     splitLine[1],
 					FullRepoName: line,
 				}
-			case 3:
+			case numParts >= 3:
+				// the org of a GitLab project may be nested in subgroups, i.e. host/group/subgroup/repo
 				repo = Repo{
 					Host:         splitLine[0],
-					OrgName:      splitLine[1],
-					RepoName:     splitLine[2],
+					OrgName:      strings.Join(splitLine[1:numParts-1], "/"),
+					RepoName:     splitLine[numParts-1],
 					FullRepoName: line,
 				}
 			default:
@@ -143,13 +169,13 @@ func readReposTxtFile(filename string) ([]Repo, error) {
 	return repos, nil
 }
 
-func readPrDescriptionFile(filename string) (string, string, error) {
+func readPrDescriptionFile(filename string) (string, string, PrOptions, error) {
 	if filename == "" {
-		return "", "", errors.New("no PR description file to open")
+		return "", "", PrOptions{}, errors.New("no PR description file to open")
 	}
 	file, err := os.Open(filename)
 	if err != nil {
-		return "", "", fmt.Errorf("unable to open PR description file: %s", filename)
+		return "", "", PrOptions{}, fmt.Errorf("unable to open PR description file: %s", filename)
 	}
 	defer func() {
 		closeErr := file.Close()
@@ -161,10 +187,21 @@ func readPrDescriptionFile(filename string) (string, string, error) {
 	scanner := bufio.NewScanner(file)
 	prTitle := ""
 	prBodyLines := []string{}
-	for scanner.Scan() {
+	var frontMatterLines []string
+	inFrontMatter := false
+	for lineNumber := 0; scanner.Scan(); lineNumber++ {
 		line := scanner.Text()
 
-		if prTitle == "" {
+		if lineNumber == 0 && line == frontMatterDelimiter {
+			inFrontMatter = true
+			frontMatterLines = []string{}
+		} else if inFrontMatter {
+			if line == frontMatterDelimiter {
+				inFrontMatter = false
+			} else {
+				frontMatterLines = append(frontMatterLines, line)
+			}
+		} else if prTitle == "" {
 			trimmedFirstLine := strings.TrimLeft(line, "# ")
 			prTitle = trimmedFirstLine
 		} else {
@@ -173,8 +210,16 @@ func readPrDescriptionFile(filename string) (string, string, error) {
 	}
 
 	if err := scanner.Err(); err != nil {
-		return "", "", fmt.Errorf("unable to read PR description file: %s", filename)
+		return "", "", PrOptions{}, fmt.Errorf("unable to read PR description file: %s", filename)
+	}
+	if inFrontMatter {
+		return "", "", PrOptions{}, fmt.Errorf("unterminated front matter in PR description file: %s", filename)
+	}
+
+	prOptions, err := parseFrontMatter(frontMatterLines)
+	if err != nil {
+		return "", "", PrOptions{}, fmt.Errorf("unable to parse front matter in PR description file %s: %w", filename, err)
 	}
 
-	return prTitle, strings.Join(prBodyLines, "\n"), nil
+	return prTitle, strings.Join(prBodyLines, "\n"), prOptions, nil
 }
@@ -15,8 +15,11 @@
 package campaign
 
 import (
+	"os"
+	"strings"
 	"testing"
 
+	"github.com/skyscanner/turbolift/internal/git"
 	"github.com/skyscanner/turbolift/internal/testsupport"
 	"github.com/stretchr/testify/assert"
 )
@@ -73,6 +76,23 @@ func TestItReadsRepoNamesWithOtherHostsFromReposFile(t *testing.T) {
 	assert.Equal(t, "PR body", campaign.PrBody)
 }
 
+func TestItReadsRepoNamesInSubgroupsFromReposFile(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "gitlab.example.com/group/sub/repo1")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Repo{
+		{
+			Host:         "gitlab.example.com",
+			OrgName:      "group/sub",
+			RepoName:     "repo1",
+			FullRepoName: "gitlab.example.com/group/sub/repo1",
+		},
+	}, campaign.Repos)
+	assert.Equal(t, "work/group/sub/repo1", campaign.Repos[0].FullRepoPath())
+}
+
 func TestItIgnoresCommentedLines(t *testing.T) {
 	testsupport.PrepareTempCampaign(false, "org/repo1", "#org/repo2")
 
@@ -253,6 +273,144 @@ func TestItShouldErrorWhenPrDescriptionFileNameIsEmpty(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestItRendersThePrDescriptionForARepo(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	_ = os.WriteFile("README.md", []byte("---\ntemplate: true\n---\n# Update {{.Repo.RepoName}} to {{.Metadata.version}}\n"+
+		"Part of {{.Campaign}}, targeting {{.DefaultBranch}}\n\n```\n{{.Diffstat}}\n```"), 0o644)
+	_ = os.WriteFile("metadata.json", []byte(`{"org/repo1": {"version": "1.2.3"}}`), 0o644)
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	data := campaign.NewPrTemplateData(campaign.Repos[0], func() (string, error) {
+		return "main", nil
+	}, func() (string, error) {
+		return " go.mod | 2 +-", nil
+	})
+	title, body, err := campaign.RenderPrDescription(data)
+	assert.NoError(t, err)
+	assert.Equal(t, "Update repo1 to 1.2.3", title)
+	assert.Equal(t, "Part of "+campaign.Name+", targeting main\n\n```\n go.mod | 2 +-\n```", body)
+}
+
+func TestItRendersThePrDescriptionAgainstTheBaseFromTheFrontMatter(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	_ = os.WriteFile("README.md", []byte("---\ntemplate: true\nbase: develop\n---\n# PR title\nTargeting {{.DefaultBranch}}\n{{.Diffstat}}"), 0o644)
+	fakeGit := git.NewAlwaysSucceedsFakeGit()
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	_, body, err := campaign.RenderPrDescriptionFor(&strings.Builder{}, fakeGit, campaign.Repos[0])
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(body, "Targeting develop\n"))
+	fakeGit.AssertCalledWith(t, [][]string{
+		{"diffstat", "work/org/repo1", "origin/develop"},
+	})
+}
+
+func TestItLeavesThePrDescriptionAsWrittenUnlessTemplatingIsTurnedOn(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	testsupport.CreateOrUpdatePrDescriptionFile("README.md", "Update {{.Repo.RepoName}}", "Uses ${{ secrets.TOKEN }}")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	title, body, err := campaign.RenderPrDescription(campaign.NewPrTemplateData(campaign.Repos[0], nil, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "Update {{.Repo.RepoName}}", title)
+	assert.Equal(t, "Uses ${{ secrets.TOKEN }}", body)
+}
+
+func TestItRendersThePrDescriptionForReposWithoutMetadata(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1", "org/repo2")
+	_ = os.WriteFile("README.md", []byte("---\ntemplate: true\n---\n# Update {{.Repo.RepoName}}\n{{with .Metadata.version}}Bumps from {{.}}{{end}}"), 0o644)
+	_ = os.WriteFile("metadata.json", []byte(`{"org/repo1": {"version": "1.2.3"}}`), 0o644)
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	_, body, err := campaign.RenderPrDescription(campaign.NewPrTemplateData(campaign.Repos[0], nil, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "Bumps from 1.2.3", body)
+
+	title, body, err := campaign.RenderPrDescription(campaign.NewPrTemplateData(campaign.Repos[1], nil, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "Update repo2", title)
+	assert.Equal(t, "", body)
+}
+
+func TestItRendersCommentsWithTheSameDataAsThePrDescription(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	comment, err := campaign.RenderComment("{{.Repo.RepoName}} is part of {{.Campaign}}", campaign.NewPrTemplateData(campaign.Repos[0], nil, nil))
+	assert.NoError(t, err)
+	assert.Equal(t, "repo1 is part of "+campaign.Name, comment)
+
+	_, err = campaign.RenderComment("{{.Diffstat}}", campaign.NewPrTemplateData(campaign.Repos[0], nil, nil))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to render comment for org/repo1")
+}
+
+func TestItShouldErrorWhenMetadataFileIsInvalid(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	_ = os.WriteFile("metadata.json", []byte("not json"), 0o644)
+
+	_, err := OpenCampaign(NewCampaignOptions())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to parse metadata file")
+}
+
+func TestItReadsPrOptionsFromFrontMatter(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	_ = os.WriteFile("README.md", []byte(`---
+labels: [dependencies, automated]
+reviewers:
+  - octocat
+team_reviewers: [platform]
+assignees: [hubot]
+milestone: Q3
+base: develop
+---
+# PR title
+PR body`), 0o644)
+
+	campaign, err := OpenCampaign(NewCampaignOptions())
+	assert.NoError(t, err)
+
+	assert.Equal(t, "PR title", campaign.PrTitle)
+	assert.Equal(t, "PR body", campaign.PrBody)
+	assert.Equal(t, PrOptions{
+		Labels:        []string{"dependencies", "automated"},
+		Reviewers:     []string{"octocat"},
+		TeamReviewers: []string{"platform"},
+		Assignees:     []string{"hubot"},
+		Milestone:     "Q3",
+		Base:          "develop",
+	}, campaign.PrOptions)
+}
+
+func TestItShouldErrorOnUnknownFrontMatterSettings(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	_ = os.WriteFile("README.md", []byte("---\nlabel: [dependencies]\n---\n# PR title\nPR body"), 0o644)
+
+	_, err := OpenCampaign(NewCampaignOptions())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to parse front matter")
+}
+
+func TestItShouldErrorOnUnterminatedFrontMatter(t *testing.T) {
+	testsupport.PrepareTempCampaign(false, "org/repo1")
+	_ = os.WriteFile("README.md", []byte("---\nlabels: [dependencies]\n# PR title\nPR body"), 0o644)
+
+	_, err := OpenCampaign(NewCampaignOptions())
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unterminated front matter")
+}
+
 func TestBranchNamePrefixLogic(t *testing.T) {
 	cases := []struct {
 		input    string
@@ -0,0 +1,58 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package campaign
+
+import (
+	"errors"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const frontMatterDelimiter = "---"
+
+// PrOptions are the settings that can be given in a YAML front matter block at the start of the PR description
+// file, e.g.
+//
+//	---
+//	labels: [dependencies]
+//	reviewers: [octocat]
+//	---
+//	# PR title
+type PrOptions struct {
+	Labels        []string `yaml:"labels"`
+	Reviewers     []string `yaml:"reviewers"`
+	TeamReviewers []string `yaml:"team_reviewers"`
+	Assignees     []string `yaml:"assignees"`
+	Milestone     string   `yaml:"milestone"`
+	Base          string   `yaml:"base"`
+	// Template turns on rendering of the PR title and description as Go templates for each repo
+	Template bool `yaml:"template"`
+}
+
+func parseFrontMatter(lines []string) (PrOptions, error) {
+	var options PrOptions
+	if len(lines) == 0 {
+		return options, nil
+	}
+
+	decoder := yaml.NewDecoder(strings.NewReader(strings.Join(lines, "\n")))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&options); err != nil && !errors.Is(err, io.EOF) {
+		return PrOptions{}, err
+	}
+	return options, nil
+}
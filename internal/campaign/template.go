@@ -0,0 +1,152 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package campaign
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/template"
+
+	"github.com/skyscanner/turbolift/internal/git"
+)
+
+// PrTemplateData is the data available to the PR title and description when they are rendered for a repo, e.g.
+// {{.Repo.RepoName}} or {{.Metadata.version}}.
+type PrTemplateData struct {
+	Repo     Repo
+	Campaign string
+	Metadata map[string]interface{}
+
+	defaultBranch func() (string, error)
+	diffstat      func() (string, error)
+}
+
+// DefaultBranch is the branch that the PR will be merged into: the base given in the front matter, or else the repo's
+// default branch. It is only looked up if the template refers to it.
+func (d PrTemplateData) DefaultBranch() (string, error) {
+	if d.defaultBranch == nil {
+		return "", errors.New("the default branch is not known")
+	}
+	return d.defaultBranch()
+}
+
+// Diffstat summarises the changes made in the repo, as shown by `git diff --stat`. It is only computed if the
+// template refers to it.
+func (d PrTemplateData) Diffstat() (string, error) {
+	if d.diffstat == nil {
+		return "", errors.New("the diffstat is not known")
+	}
+	return d.diffstat()
+}
+
+// NewPrTemplateData prepares the data for rendering the PR title and description for a repo. Details that have to
+// be read from the working copy are supplied as functions, so that they are only computed when needed.
+func (c *Campaign) NewPrTemplateData(repo Repo, defaultBranch func() (string, error), diffstat func() (string, error)) PrTemplateData {
+	return PrTemplateData{
+		Repo:          repo,
+		Campaign:      c.Name,
+		Metadata:      c.Metadata[repo.FullRepoName],
+		defaultBranch: defaultBranch,
+		diffstat:      diffstat,
+	}
+}
+
+// PrTemplateDataFor prepares the data for rendering the PR description and comments for a repo, reading the default
+// branch and diffstat from its working copy if they are needed. The front matter's base, if given, is used in place of
+// the default branch.
+func (c *Campaign) PrTemplateDataFor(output io.Writer, g git.Git, repo Repo) PrTemplateData {
+	repoState := c.State.Get(repo.FullRepoName)
+	defaultBranch := func() (string, error) {
+		if c.PrOptions.Base != "" {
+			return c.PrOptions.Base, nil
+		}
+		if repoState.DefaultBranch != "" {
+			return repoState.DefaultBranch, nil
+		}
+		return g.DefaultBranch(output, repo.FullRepoPath(), repoState.UpstreamRemote())
+	}
+	diffstat := func() (string, error) {
+		branch, err := defaultBranch()
+		if err != nil {
+			return "", err
+		}
+		return g.Diffstat(output, repo.FullRepoPath(), repoState.UpstreamRemote()+"/"+branch)
+	}
+	return c.NewPrTemplateData(repo, defaultBranch, diffstat)
+}
+
+// RenderPrDescriptionFor renders the PR title and body for a repo, using the working copy of the repo for any details
+// that the templates refer to.
+func (c *Campaign) RenderPrDescriptionFor(output io.Writer, g git.Git, repo Repo) (string, string, error) {
+	return c.RenderPrDescription(c.PrTemplateDataFor(output, g, repo))
+}
+
+// RenderPrDescription renders the PR title and body as Go templates with the given data, if templating has been
+// turned on in the front matter. Otherwise they are used as they are written.
+func (c *Campaign) RenderPrDescription(data PrTemplateData) (string, string, error) {
+	if !c.PrOptions.Template {
+		return c.PrTitle, c.PrBody, nil
+	}
+	title, err := render("PR title", c.PrTitle, data)
+	if err != nil {
+		return "", "", err
+	}
+	body, err := render("PR description", c.PrBody, data)
+	if err != nil {
+		return "", "", err
+	}
+	return title, body, nil
+}
+
+// RenderComment renders a comment to be posted on PRs as a Go template with the same data as the PR description.
+func (c *Campaign) RenderComment(comment string, data PrTemplateData) (string, error) {
+	return render("comment", comment, data)
+}
+
+func render(name string, text string, data PrTemplateData) (string, error) {
+	tmpl, err := template.New(name).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse %s template: %w", name, err)
+	}
+
+	var sb strings.Builder
+	if err := tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("unable to render %s for %s: %w", name, data.Repo.FullRepoName, err)
+	}
+	return sb.String(), nil
+}
+
+func readMetadataFile(filename string) (map[string]map[string]interface{}, error) {
+	metadata := map[string]map[string]interface{}{}
+	if filename == "" {
+		return metadata, nil
+	}
+
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return metadata, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read metadata file %s: %w", filename, err)
+	}
+
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		return nil, fmt.Errorf("unable to parse metadata file %s: %w", filename, err)
+	}
+	return metadata, nil
+}
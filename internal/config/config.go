@@ -0,0 +1,89 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package config reads the optional turbolift configuration file, which describes how to talk to the forges that
+// host a campaign's repositories.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const DefaultFilename = "turbolift.yml"
+
+// DefaultForge is the key of the forge used for repositories without a host, and for hosts that have no forge of
+// their own
+const DefaultForge = "default"
+
+type Forge struct {
+	// Type identifies the implementation used to talk to the forge, e.g. gh or github
+	Type string `yaml:"type"`
+	// Url is the base URL of the forge's API
+	Url string `yaml:"url"`
+	// TokenEnv is the name of an environment variable holding the API token
+	TokenEnv string `yaml:"token_env"`
+}
+
+type Config struct {
+	// Forges are keyed by the host given in repos.txt, or DefaultForge
+	Forges map[string]Forge `yaml:"forges"`
+}
+
+// Load reads the configuration from the campaign directory if it has a turbolift.yml file, and otherwise from
+// turbolift/config.yml in the user's configuration directory. It is not an error for neither to exist.
+func Load() (*Config, error) {
+	if _, err := os.Stat(DefaultFilename); err == nil {
+		return LoadFile(DefaultFilename)
+	}
+	if userConfigDir, err := os.UserConfigDir(); err == nil {
+		return LoadFile(filepath.Join(userConfigDir, "turbolift", "config.yml"))
+	}
+	return &Config{Forges: map[string]Forge{}}, nil
+}
+
+// LoadFile reads the configuration from the named file, returning an empty configuration if it does not exist.
+func LoadFile(filename string) (*Config, error) {
+	c := &Config{Forges: map[string]Forge{}}
+
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read config file %s: %w", filename, err)
+	}
+
+	if err := yaml.Unmarshal(content, c); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", filename, err)
+	}
+	if c.Forges == nil {
+		c.Forges = map[string]Forge{}
+	}
+	return c, nil
+}
+
+// ForgeFor returns the forge for repositories on the given host, which is empty for repositories listed without one.
+// The second result is false if neither the host nor DefaultForge is configured.
+func (c *Config) ForgeFor(host string) (Forge, bool) {
+	if forge, ok := c.Forges[host]; ok && host != "" {
+		return forge, true
+	}
+	forge, ok := c.Forges[DefaultForge]
+	return forge, ok
+}
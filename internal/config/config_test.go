@@ -0,0 +1,73 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package config
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItLoadsAnEmptyConfigWhenNoFileExists(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	c, err := LoadFile(DefaultFilename)
+	assert.NoError(t, err)
+	assert.Empty(t, c.Forges)
+
+	_, ok := c.ForgeFor("github.com")
+	assert.False(t, ok)
+}
+
+func TestItSelectsForgesByHost(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	_ = os.WriteFile(DefaultFilename, []byte(`
+forges:
+  default:
+    type: github
+    url: https://github.example.com/api/v3
+  gitlab.example.com:
+    type: gitlab
+    token_env: GITLAB_TOKEN
+`), 0o644)
+
+	c, err := Load()
+	assert.NoError(t, err)
+
+	forge, ok := c.ForgeFor("gitlab.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, Forge{Type: "gitlab", TokenEnv: "GITLAB_TOKEN"}, forge)
+
+	forge, ok = c.ForgeFor("")
+	assert.True(t, ok)
+	assert.Equal(t, Forge{Type: "github", Url: "https://github.example.com/api/v3"}, forge)
+
+	forge, ok = c.ForgeFor("other.example.com")
+	assert.True(t, ok)
+	assert.Equal(t, "github", forge.Type)
+}
+
+func TestItRejectsAnInvalidConfigFile(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	_ = os.WriteFile(DefaultFilename, []byte("forges: [not, a, map]"), 0o644)
+
+	_, err := LoadFile(DefaultFilename)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to parse config file")
+}
@@ -18,6 +18,8 @@ package executor
 import (
 	"errors"
 	"io"
+	"sync"
+	"sync/atomic"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -27,26 +29,36 @@ type FakeExecutor struct {
 	Handler          func(workingDir string, name string, args ...string) error
 	ReturningHandler func(workingDir string, name string, args ...string) (string, error)
 	calls            [][]string
+	mu               sync.Mutex
 }
 
 func (e *FakeExecutor) Execute(_ io.Writer, workingDir string, name string, args ...string) error {
-	allArgs := append([]string{workingDir, name}, args...)
-	e.calls = append(e.calls, allArgs)
+	e.record(append([]string{workingDir, name}, args...))
 	return e.Handler(workingDir, name, args...)
 }
 
 func (e *FakeExecutor) ExecuteAndCapture(_ io.Writer, workingDir string, name string, args ...string) (string, error) {
-	allArgs := append([]string{workingDir, name}, args...)
-	e.calls = append(e.calls, allArgs)
+	e.record(append([]string{workingDir, name}, args...))
 	return e.ReturningHandler(workingDir, name, args...)
 }
 
+// record notes a call. Only the record is locked, so that the handlers of concurrent calls run concurrently.
+func (e *FakeExecutor) record(call []string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.calls = append(e.calls, call)
+}
+
 func (e *FakeExecutor) SetVerbose(_ bool) {}
 
 func (e *FakeExecutor) AssertCalledWith(t *testing.T, expected [][]string) {
 	assert.Equal(t, expected, e.calls)
 }
 
+func (e *FakeExecutor) AssertCalledWithInAnyOrder(t *testing.T, expected [][]string) {
+	assert.ElementsMatch(t, expected, e.calls)
+}
+
 func NewFakeExecutor(handler func(string, string, ...string) error, returningHandler func(string, string, ...string) (string, error)) *FakeExecutor {
 	return &FakeExecutor{
 		Handler:          handler,
@@ -72,19 +84,17 @@ func NewAlwaysFailsFakeExecutor() *FakeExecutor {
 }
 
 func NewAlternatingSuccessFakeExecutor() *FakeExecutor {
-	i := 0
+	var i atomic.Int64
 	return NewFakeExecutor(
 		func(s string, s2 string, s3 ...string) error {
-			i++
-			if i%2 == 1 {
+			if i.Add(1)%2 == 1 {
 				return nil
 			} else {
 				return errors.New("synthetic error")
 			}
 		},
 		func(s string, s2 string, s3 ...string) (string, error) {
-			i++
-			if i%2 == 1 {
+			if i.Add(1)%2 == 1 {
 				return "", nil
 			} else {
 				return "", errors.New("synthetic error")
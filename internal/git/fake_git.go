@@ -22,9 +22,17 @@ import (
 	"testing"
 )
 
+// FakeSHA is the commit SHA reported by FakeGit for every working copy
+const FakeSHA = "0123456789abcdef0123456789abcdef01234567"
+
+// FakeUpdatedSHA is the commit SHA reported by FakeGit for a working copy once a rebase or merge has moved its HEAD
+const FakeUpdatedSHA = "89abcdef0123456789abcdef0123456789abcdef"
+
 type FakeGit struct {
 	handler func(output io.Writer, call []string) (bool, error)
 	calls   [][]string
+	// updated holds the working copies whose HEAD has been moved by a rebase or merge
+	updated map[string]bool
 }
 
 func (f *FakeGit) Checkout(output io.Writer, workingDir string, branch string) error {
@@ -62,6 +70,112 @@ func (f *FakeGit) Pull(output io.Writer, workingDir string, remote string, branc
 	return err
 }
 
+func (f *FakeGit) GetHeadSHA(output io.Writer, workingDir string) (string, error) {
+	call := []string{"getHeadSHA", workingDir}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	if err != nil {
+		return "", err
+	}
+	if f.updated[workingDir] {
+		return FakeUpdatedSHA, nil
+	}
+	return FakeSHA, nil
+}
+
+func (f *FakeGit) CommitsAhead(output io.Writer, workingDir string, base string) (int, error) {
+	call := []string{"commitsAhead", workingDir, base}
+	f.calls = append(f.calls, call)
+	ahead, err := f.handler(output, call)
+	if ahead {
+		return 1, err
+	}
+	return 0, err
+}
+
+func (f *FakeGit) DefaultBranch(output io.Writer, workingDir string, remote string) (string, error) {
+	call := []string{"defaultBranch", workingDir, remote}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	if err != nil {
+		return "", err
+	}
+	return "main", nil
+}
+
+func (f *FakeGit) Diffstat(output io.Writer, workingDir string, base string) (string, error) {
+	call := []string{"diffstat", workingDir, base}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	if err != nil {
+		return "", err
+	}
+	return " README.md | 2 +-\n 1 file changed, 1 insertion(+), 1 deletion(-)", nil
+}
+
+func (f *FakeGit) Fetch(output io.Writer, workingDir string, remote string, branchName string) error {
+	call := []string{"fetch", workingDir, remote, branchName}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+// Rebase moves the HEAD of the working copy when the handler returns true, and otherwise finds it already up to date
+func (f *FakeGit) Rebase(output io.Writer, workingDir string, onto string) error {
+	call := []string{"rebase", workingDir, onto}
+	f.calls = append(f.calls, call)
+	moved, err := f.handler(output, call)
+	f.updated[workingDir] = f.updated[workingDir] || (moved && err == nil)
+	return err
+}
+
+func (f *FakeGit) AbortRebase(output io.Writer, workingDir string) error {
+	call := []string{"abortRebase", workingDir}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+// Merge moves the HEAD of the working copy when the handler returns true, and otherwise finds it already up to date
+func (f *FakeGit) Merge(output io.Writer, workingDir string, ref string) error {
+	call := []string{"merge", workingDir, ref}
+	f.calls = append(f.calls, call)
+	moved, err := f.handler(output, call)
+	f.updated[workingDir] = f.updated[workingDir] || (moved && err == nil)
+	return err
+}
+
+func (f *FakeGit) AbortMerge(output io.Writer, workingDir string) error {
+	call := []string{"abortMerge", workingDir}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+// ConflictingFiles reports README.md as conflicting when the handler returns true
+func (f *FakeGit) ConflictingFiles(output io.Writer, workingDir string) ([]string, error) {
+	call := []string{"conflictingFiles", workingDir}
+	f.calls = append(f.calls, call)
+	conflicting, err := f.handler(output, call)
+	if err != nil || !conflicting {
+		return nil, err
+	}
+	return []string{"README.md"}, nil
+}
+
+func (f *FakeGit) ForcePushWithLease(output io.Writer, workingDir string, _ string, branchName string, expectedSHA string) error {
+	call := []string{"forcePushWithLease", workingDir, branchName, expectedSHA}
+	f.calls = append(f.calls, call)
+	_, err := f.handler(output, call)
+	return err
+}
+
+func (f *FakeGit) RemoteBranchExists(output io.Writer, workingDir string, _ string, branchName string) (bool, error) {
+	call := []string{"remoteBranchExists", workingDir, branchName}
+	f.calls = append(f.calls, call)
+	return f.handler(output, call)
+}
+
 func (f *FakeGit) AssertCalledWith(t *testing.T, expected [][]string) {
 	assert.Equal(t, expected, f.calls)
 }
@@ -70,6 +184,7 @@ func NewFakeGit(h func(io.Writer, []string) (bool, error)) *FakeGit {
 	return &FakeGit{
 		handler: h,
 		calls:   [][]string{},
+		updated: map[string]bool{},
 	}
 }
 
@@ -19,6 +19,7 @@ import (
 	"io"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/skyscanner/turbolift/internal/executor"
 )
@@ -31,6 +32,21 @@ type Git interface {
 	Commit(output io.Writer, workingDir string, message string) error
 	IsRepoChanged(output io.Writer, workingDir string) (bool, error)
 	Pull(output io.Writer, workingDir string, remote string, branchName string) error
+	GetHeadSHA(output io.Writer, workingDir string) (string, error)
+	CommitsAhead(output io.Writer, workingDir string, base string) (int, error)
+	DefaultBranch(output io.Writer, workingDir string, remote string) (string, error)
+	Diffstat(output io.Writer, workingDir string, base string) (string, error)
+	// Fetch updates the remote-tracking branch of a single branch of the remote, leaving those of other branches as
+	// they were
+	Fetch(output io.Writer, workingDir string, remote string, branchName string) error
+	Rebase(output io.Writer, workingDir string, onto string) error
+	AbortRebase(output io.Writer, workingDir string) error
+	Merge(output io.Writer, workingDir string, ref string) error
+	AbortMerge(output io.Writer, workingDir string) error
+	// ConflictingFiles lists the files left unmerged by a rebase or merge that stopped for conflicts
+	ConflictingFiles(output io.Writer, workingDir string) ([]string, error)
+	ForcePushWithLease(output io.Writer, workingDir string, remote string, branchName string, expectedSHA string) error
+	RemoteBranchExists(output io.Writer, workingDir string, remote string, branchName string) (bool, error)
 }
 
 type RealGit struct{}
@@ -72,6 +88,88 @@ func (r *RealGit) Pull(output io.Writer, workingDir string, remote string, branc
 	return execInstance.Execute(output, workingDir, "git", "pull", "--ff-only", remote, branchName)
 }
 
+func (r *RealGit) GetHeadSHA(output io.Writer, workingDir string) (string, error) {
+	sha, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-parse", "HEAD")
+	return strings.TrimSpace(sha), err
+}
+
+// CommitsAhead counts the commits on HEAD that are not reachable from base
+func (r *RealGit) CommitsAhead(output io.Writer, workingDir string, base string) (int, error) {
+	count, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-list", "--count", base+"..HEAD")
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(count))
+}
+
+// DefaultBranch returns the branch that the remote's HEAD points at, as recorded when the repo was cloned
+func (r *RealGit) DefaultBranch(output io.Writer, workingDir string, remote string) (string, error) {
+	ref, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-parse", "--abbrev-ref", remote+"/HEAD")
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimPrefix(strings.TrimSpace(ref), remote+"/"), nil
+}
+
+func (r *RealGit) Diffstat(output io.Writer, workingDir string, base string) (string, error) {
+	diffstat, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "diff", "--stat", base+"...HEAD")
+	return strings.TrimRight(diffstat, "\n"), err
+}
+
+func (r *RealGit) Fetch(output io.Writer, workingDir string, remote string, branchName string) error {
+	return execInstance.Execute(output, workingDir, "git", "fetch", remote, branchName)
+}
+
+func (r *RealGit) Rebase(output io.Writer, workingDir string, onto string) error {
+	return execInstance.Execute(output, workingDir, "git", "rebase", onto)
+}
+
+func (r *RealGit) AbortRebase(output io.Writer, workingDir string) error {
+	return execInstance.Execute(output, workingDir, "git", "rebase", "--abort")
+}
+
+func (r *RealGit) Merge(output io.Writer, workingDir string, ref string) error {
+	return execInstance.Execute(output, workingDir, "git", "merge", "--no-edit", ref)
+}
+
+func (r *RealGit) AbortMerge(output io.Writer, workingDir string) error {
+	return execInstance.Execute(output, workingDir, "git", "merge", "--abort")
+}
+
+func (r *RealGit) ConflictingFiles(output io.Writer, workingDir string) ([]string, error) {
+	// -z leaves paths unquoted and ends each with a NUL, so that paths with spaces or unusual characters come through
+	files, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "diff", "--name-only", "--diff-filter=U", "-z")
+	if err != nil {
+		return nil, err
+	}
+	var conflicting []string
+	for _, file := range strings.Split(files, "\x00") {
+		if file != "" {
+			conflicting = append(conflicting, file)
+		}
+	}
+	return conflicting, nil
+}
+
+// ForcePushWithLease pushes a branch whose history has been rewritten, unless the remote branch is no longer at
+// expectedSHA. If expectedSHA is empty, the remote branch must be where it was when it was last fetched.
+func (r *RealGit) ForcePushWithLease(output io.Writer, workingDir string, remote string, branchName string, expectedSHA string) error {
+	lease := "--force-with-lease=" + branchName
+	if expectedSHA != "" {
+		lease += ":" + expectedSHA
+	}
+	return execInstance.Execute(output, workingDir, "git", "push", lease, remote, branchName)
+}
+
+// RemoteBranchExists asks the remote whether it has a branch, rather than relying on what was last fetched
+func (r *RealGit) RemoteBranchExists(output io.Writer, workingDir string, remote string, branchName string) (bool, error) {
+	heads, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "ls-remote", "--heads", remote, branchName)
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(heads) != "", nil
+}
+
 func NewRealGit() *RealGit {
 	return &RealGit{}
 }
@@ -70,6 +70,106 @@ func TestItReturnsNilErrorOnSuccessfulPull(t *testing.T) {
 	})
 }
 
+func TestItReturnsTrimmedHeadSHA(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "0123456789abcdef0123456789abcdef01234567\n", nil
+	})
+	execInstance = fakeExecutor
+
+	sha, err := NewRealGit().GetHeadSHA(&strings.Builder{}, "work/org/repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, "0123456789abcdef0123456789abcdef01234567", sha)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "rev-parse", "HEAD"},
+	})
+}
+
+func TestItCountsCommitsAhead(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "3\n", nil
+	})
+	execInstance = fakeExecutor
+
+	ahead, err := NewRealGit().CommitsAhead(&strings.Builder{}, "work/org/repo1", "origin/main")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, ahead)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "rev-list", "--count", "origin/main..HEAD"},
+	})
+}
+
+func TestItFindsTheDefaultBranchOfARemote(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "upstream/develop\n", nil
+	})
+	execInstance = fakeExecutor
+
+	branch, err := NewRealGit().DefaultBranch(&strings.Builder{}, "work/org/repo1", "upstream")
+	assert.NoError(t, err)
+	assert.Equal(t, "develop", branch)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "rev-parse", "--abbrev-ref", "upstream/HEAD"},
+	})
+}
+
+func TestItListsConflictingFiles(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "go.mod\x00docs/release notes.md\x00", nil
+	})
+	execInstance = fakeExecutor
+
+	files, err := NewRealGit().ConflictingFiles(&strings.Builder{}, "work/org/repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"go.mod", "docs/release notes.md"}, files)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "diff", "--name-only", "--diff-filter=U", "-z"},
+	})
+}
+
+func TestItForcePushesWithLease(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	err := NewRealGit().ForcePushWithLease(&strings.Builder{}, "work/org/repo1", "origin", "some_branch", "abc123")
+	assert.NoError(t, err)
+	err = NewRealGit().ForcePushWithLease(&strings.Builder{}, "work/org/repo1", "origin", "some_branch", "")
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "push", "--force-with-lease=some_branch:abc123", "origin", "some_branch"},
+		{"work/org/repo1", "git", "push", "--force-with-lease=some_branch", "origin", "some_branch"},
+	})
+}
+
+func TestItChecksWhetherARemoteBranchExists(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "", nil
+	})
+	execInstance = fakeExecutor
+
+	exists, err := NewRealGit().RemoteBranchExists(&strings.Builder{}, "work/org/repo1", "origin", "some_branch")
+	assert.NoError(t, err)
+	assert.False(t, exists)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "git", "ls-remote", "--heads", "origin", "some_branch"},
+	})
+}
+
 func runCheckoutAndCaptureOutput() (string, error) {
 	sb := strings.Builder{}
 	err := NewRealGit().Checkout(&sb, "work/org/repo1", "some_branch")
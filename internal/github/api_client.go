@@ -0,0 +1,205 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sleep is replaced in tests so that waiting for rate limits to reset does not slow them down
+var sleep = time.Sleep
+
+const (
+	// maxRateLimitWait is the longest that a request will wait for a rate limit to reset before giving up
+	maxRateLimitWait = 2 * time.Minute
+	maxAttempts      = 3
+)
+
+// APIError is returned when a forge's API responds with an unsuccessful status
+type APIError struct {
+	Method     string
+	Url        string
+	StatusCode int
+	Message    string
+	// body is the raw response, for backends that need details that are not part of the message
+	body string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s %s returned %d: %s", e.Method, e.Url, e.StatusCode, e.Message)
+}
+
+// RateLimitError is returned when a forge's API rate limit is exhausted, and will not reset soon enough to wait for it
+type RateLimitError struct {
+	Url   string
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limit exceeded calling %s; it resets at %s", e.Url, e.Reset.Format(time.RFC3339))
+}
+
+// apiClient makes JSON requests to the HTTP API of a forge
+type apiClient struct {
+	baseUrl    string
+	token      string
+	headers    map[string]string
+	httpClient *http.Client
+}
+
+func newApiClient(baseUrl string, token string, headers map[string]string) *apiClient {
+	return &apiClient{
+		baseUrl:    strings.TrimSuffix(baseUrl, "/"),
+		token:      token,
+		headers:    headers,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// do sends a request to a path relative to the base URL, or to an absolute URL. The request body is marshalled
+// from in, if not nil, and the response body is unmarshalled into out, if not nil. If out is a *string, it is set to
+// the response body as is.
+func (c *apiClient) do(method string, path string, in interface{}, out interface{}) error {
+	url := path
+	if !strings.HasPrefix(path, "http://") && !strings.HasPrefix(path, "https://") {
+		url = c.baseUrl + path
+	}
+
+	var requestBody []byte
+	if in != nil {
+		var err error
+		if requestBody, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(method, url, bytes.NewReader(requestBody))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Accept", "application/json")
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.token)
+		}
+		for name, value := range c.headers {
+			req.Header.Set(name, value)
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return err
+		}
+		responseBody, err := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		if reset, limited := rateLimitReset(resp); limited {
+			wait := time.Until(reset)
+			if attempt >= maxAttempts || wait > maxRateLimitWait {
+				return &RateLimitError{Url: url, Reset: reset}
+			}
+			sleep(wait)
+			continue
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return &APIError{Method: method, Url: url, StatusCode: resp.StatusCode, Message: errorMessage(responseBody), body: string(responseBody)}
+		}
+
+		if text, ok := out.(*string); ok {
+			*text = string(responseBody)
+			return nil
+		}
+		if out == nil || len(responseBody) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(responseBody, out); err != nil {
+			return fmt.Errorf("unable to parse response from %s: %w", url, err)
+		}
+		return nil
+	}
+}
+
+// rateLimitReset reports whether a response was rejected because of rate limiting, and if so when the limit resets.
+// Forges signal this with a 429, or a 403 with no requests remaining, along with either a Retry-After header or a
+// header giving the reset time in seconds since the epoch.
+func rateLimitReset(resp *http.Response) (time.Time, bool) {
+	exhausted := resp.Header.Get("X-RateLimit-Remaining") == "0" || resp.Header.Get("RateLimit-Remaining") == "0"
+	if resp.StatusCode != http.StatusTooManyRequests && !(resp.StatusCode == http.StatusForbidden && exhausted) {
+		return time.Time{}, false
+	}
+
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		return time.Now().Add(time.Duration(seconds) * time.Second), true
+	}
+	for _, header := range []string{"X-RateLimit-Reset", "RateLimit-Reset"} {
+		if epoch, err := strconv.ParseInt(resp.Header.Get(header), 10, 64); err == nil {
+			return time.Unix(epoch, 0), true
+		}
+	}
+	// no indication of when to retry, so back off briefly
+	return time.Now().Add(time.Minute), true
+}
+
+// errorMessage extracts the explanation from an error response, which forges structure in a variety of ways
+func errorMessage(body []byte) string {
+	var response struct {
+		Message interface{} `json:"message"`
+		Error   string      `json:"error"`
+		Errors  []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+
+	var messages []string
+	switch message := response.Message.(type) {
+	case string:
+		messages = append(messages, message)
+	case nil:
+	default:
+		// GitLab reports validation failures as an object or list
+		encoded, _ := json.Marshal(message)
+		messages = append(messages, string(encoded))
+	}
+	if response.Error != "" {
+		messages = append(messages, response.Error)
+	}
+	for _, e := range response.Errors {
+		if e.Message != "" {
+			messages = append(messages, e.Message)
+		}
+	}
+	if len(messages) == 0 {
+		return strings.TrimSpace(string(body))
+	}
+	return strings.Join(messages, ": ")
+}
@@ -0,0 +1,490 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Bitbucket implements GitHub for Bitbucket Server and Data Center, using the REST API. Repos are identified by
+// project key and repository slug, which take the place of the org and repo names in repos.txt.
+type Bitbucket struct {
+	rootUrl string
+	client  *apiClient
+}
+
+// NewBitbucket creates a client for the Bitbucket instance at baseUrl, e.g. https://bitbucket.example.com
+func NewBitbucket(baseUrl string, token string) *Bitbucket {
+	rootUrl := strings.TrimSuffix(baseUrl, "/")
+	return &Bitbucket{
+		rootUrl: rootUrl,
+		client:  newApiClient(rootUrl+"/rest/api/1.0", token, nil),
+	}
+}
+
+type bitbucketRepo struct {
+	Slug    string `json:"slug"`
+	Project struct {
+		Key string `json:"key"`
+	} `json:"project"`
+	Links struct {
+		Clone []struct {
+			Href string `json:"href"`
+			Name string `json:"name"`
+		} `json:"clone"`
+	} `json:"links"`
+}
+
+func (b bitbucketRepo) httpCloneUrl() string {
+	for _, link := range b.Links.Clone {
+		if link.Name == "http" {
+			return link.Href
+		}
+	}
+	return ""
+}
+
+type bitbucketRef struct {
+	Id           string `json:"id"`
+	DisplayId    string `json:"displayId,omitempty"`
+	LatestCommit string `json:"latestCommit,omitempty"`
+	Repository   struct {
+		Slug    string `json:"slug"`
+		Project struct {
+			Key string `json:"key"`
+		} `json:"project"`
+	} `json:"repository"`
+}
+
+type bitbucketReviewer struct {
+	User struct {
+		Name string `json:"name"`
+	} `json:"user"`
+	Status string `json:"status,omitempty"`
+}
+
+type bitbucketPullRequest struct {
+	Id          int                 `json:"id"`
+	Version     int                 `json:"version"`
+	Title       string              `json:"title"`
+	Description string              `json:"description"`
+	State       string              `json:"state"`
+	Closed      bool                `json:"closed"`
+	Draft       bool                `json:"draft"`
+	FromRef     bitbucketRef        `json:"fromRef"`
+	ToRef       bitbucketRef        `json:"toRef"`
+	Reviewers   []bitbucketReviewer `json:"reviewers"`
+	CreatedDate int64               `json:"createdDate"`
+	ClosedDate  int64               `json:"closedDate"`
+	Links       struct {
+		Self []struct {
+			Href string `json:"href"`
+		} `json:"self"`
+	} `json:"links"`
+}
+
+func (pr bitbucketPullRequest) url() string {
+	if len(pr.Links.Self) == 0 {
+		return ""
+	}
+	return pr.Links.Self[0].Href
+}
+
+func repoPath(project string, slug string) string {
+	return fmt.Sprintf("/projects/%s/repos/%s", url.PathEscape(project), url.PathEscape(slug))
+}
+
+func newBitbucketRef(branch string, project string, slug string) bitbucketRef {
+	ref := bitbucketRef{Id: "refs/heads/" + branch}
+	ref.Repository.Slug = slug
+	ref.Repository.Project.Key = project
+	return ref
+}
+
+func (r *Bitbucket) getRepo(project string, slug string) (*bitbucketRepo, error) {
+	var repo bitbucketRepo
+	if err := r.client.do(http.MethodGet, repoPath(project, slug), nil, &repo); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+func (r *Bitbucket) ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error {
+	project, slug := splitRepoName(fullRepoName)
+	upstream, err := r.getRepo(project, slug)
+	if err != nil {
+		return err
+	}
+
+	// forks are created in the user's personal project
+	var fork bitbucketRepo
+	err = r.client.do(http.MethodPost, repoPath(project, slug), map[string]interface{}{}, &fork)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		// the repo has already been forked
+		var username string
+		if err := r.client.do(http.MethodGet, r.rootUrl+"/plugins/servlet/applinks/whoami", nil, &username); err != nil {
+			return err
+		}
+		existing, err := r.getRepo("~"+strings.TrimSpace(username), slug)
+		if err != nil {
+			return err
+		}
+		fork = *existing
+	} else if err != nil {
+		return err
+	}
+
+	return cloneRepo(output, workingDir, fork.httpCloneUrl(), slug, upstream.httpCloneUrl())
+}
+
+func (r *Bitbucket) Clone(output io.Writer, workingDir string, fullRepoName string) error {
+	project, slug := splitRepoName(fullRepoName)
+	repo, err := r.getRepo(project, slug)
+	if err != nil {
+		return err
+	}
+	return cloneRepo(output, workingDir, repo.httpCloneUrl(), slug, "")
+}
+
+func (r *Bitbucket) CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (didCreate bool, prUrl string, err error) {
+	project, slug := splitRepoName(pr.UpstreamRepo)
+
+	branch, err := currentBranch(output, workingDir)
+	if err != nil {
+		return false, "", err
+	}
+	sourceProject, err := originOwner(output, workingDir)
+	if err != nil {
+		return false, "", err
+	}
+
+	base := pr.Base
+	if base == "" {
+		if base, err = r.GetDefaultBranchName(output, workingDir, pr.UpstreamRepo); err != nil {
+			return false, "", err
+		}
+	}
+
+	reviewers := []bitbucketReviewer{}
+	for _, name := range pr.Reviewers {
+		reviewer := bitbucketReviewer{}
+		reviewer.User.Name = name
+		reviewers = append(reviewers, reviewer)
+	}
+	r.warnOfUnsupportedOptions(output, pr)
+
+	request := map[string]interface{}{
+		"title":       pr.Title,
+		"description": pr.Body,
+		"fromRef":     newBitbucketRef(branch, sourceProject, slug),
+		"toRef":       newBitbucketRef(base, project, slug),
+		"reviewers":   reviewers,
+	}
+	if pr.IsDraft {
+		request["draft"] = true
+	}
+
+	var created bitbucketPullRequest
+	err = r.client.do(http.MethodPost, repoPath(project, slug)+"/pull-requests", request, &created)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && strings.Contains(apiErr.body, "EmptyPullRequestException") {
+		// no PR was created because there are no differences between the branches
+		return false, "", nil
+	} else if err != nil {
+		return false, "", err
+	}
+
+	_, _ = fmt.Fprintln(output, created.url())
+	return true, created.url(), nil
+}
+
+// warnOfUnsupportedOptions notes any settings of a PR that Bitbucket has no equivalent for
+func (r *Bitbucket) warnOfUnsupportedOptions(output io.Writer, pr PullRequest) {
+	if len(pr.Labels) > 0 || len(pr.TeamReviewers) > 0 || len(pr.Assignees) > 0 || pr.Milestone != "" {
+		_, _ = fmt.Fprintln(output, "Bitbucket does not support labels, team reviewers, assignees or milestones; ignoring them")
+	}
+}
+
+// findPullRequest returns the most relevant PR raised from a branch of a working copy, preferring one that is open.
+// PRs are looked up as outgoing from the repo the working copy pushes to, so that PRs raised from forks are found.
+// Repos that have not been cloned are looked up in their upstream repo, which finds only PRs raised from it.
+func (r *Bitbucket) findPullRequest(output io.Writer, workingDir string, fullRepoName string, branchName string) (*bitbucketPullRequest, error) {
+	sourceProject, slug := splitRepoName(fullRepoName)
+	if _, err := os.Stat(workingDir); err == nil {
+		if sourceProject, err = originOwner(output, workingDir); err != nil {
+			return nil, err
+		}
+	}
+
+	var response struct {
+		Values []bitbucketPullRequest `json:"values"`
+	}
+	query := url.Values{
+		"at":        {"refs/heads/" + branchName},
+		"direction": {"OUTGOING"},
+		"state":     {"ALL"},
+		"order":     {"NEWEST"},
+		"limit":     {"100"},
+	}
+	if err := r.client.do(http.MethodGet, repoPath(sourceProject, slug)+"/pull-requests?"+query.Encode(), nil, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Values) == 0 {
+		return nil, &NoPRFoundError{Path: workingDir, BranchName: branchName}
+	}
+
+	for i, pr := range response.Values {
+		if pr.State == "OPEN" {
+			return &response.Values[i], nil
+		}
+	}
+	return &response.Values[0], nil
+}
+
+func (r *Bitbucket) ClosePullRequest(output io.Writer, workingDir string, fullRepoName string, branchName string) error {
+	pr, err := r.findPullRequest(output, workingDir, fullRepoName, branchName)
+	if err != nil {
+		return err
+	}
+
+	project, slug := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/pull-requests/%d/decline?version=%d", repoPath(project, slug), pr.Id, pr.Version), map[string]interface{}{}, nil)
+}
+
+// ReopenPullRequest reopens a declined PR, which Bitbucket only allows at its current version
+func (r *Bitbucket) ReopenPullRequest(_ io.Writer, fullRepoName string, number int) error {
+	project, slug := splitRepoName(fullRepoName)
+	var pr bitbucketPullRequest
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/pull-requests/%d", repoPath(project, slug), number), nil, &pr); err != nil {
+		return err
+	}
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/pull-requests/%d/reopen?version=%d", repoPath(project, slug), number, pr.Version), map[string]interface{}{}, nil)
+}
+
+// bitbucketMergeStrategies maps merge strategies to the ids of the equivalent Bitbucket strategies
+var bitbucketMergeStrategies = map[string]string{
+	MergeStrategyMerge:  "no-ff",
+	MergeStrategySquash: "squash",
+	MergeStrategyRebase: "rebase-ff-only",
+}
+
+func (r *Bitbucket) MergePullRequest(output io.Writer, fullRepoName string, number int, strategy string, deleteBranch bool) error {
+	project, slug := splitRepoName(fullRepoName)
+	var pr bitbucketPullRequest
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/pull-requests/%d", repoPath(project, slug), number), nil, &pr); err != nil {
+		return err
+	}
+
+	if err := r.client.do(http.MethodPost, fmt.Sprintf("%s/pull-requests/%d/merge?version=%d", repoPath(project, slug), number, pr.Version), map[string]interface{}{
+		"strategyId": bitbucketMergeStrategies[strategy],
+	}, nil); err != nil {
+		return err
+	}
+
+	if deleteBranch {
+		_, _ = fmt.Fprintf(output, "Bitbucket does not delete branches when merging; leaving %s in place\n", pr.FromRef.DisplayId)
+	}
+	return nil
+}
+
+func (r *Bitbucket) EnableAutoMerge(_ io.Writer, fullRepoName string, _ int, _ string) error {
+	return &AutoMergeNotAllowedError{Repo: fullRepoName, Reason: "turbolift does not support auto-merge on Bitbucket"}
+}
+
+func (r *Bitbucket) DisableAutoMerge(_ io.Writer, fullRepoName string, _ int) error {
+	return &AutoMergeNotAllowedError{Repo: fullRepoName, Reason: "turbolift does not support auto-merge on Bitbucket"}
+}
+
+func (r *Bitbucket) UpdatePRDescription(output io.Writer, workingDir string, pr PullRequest) error {
+	branchName, err := currentBranch(output, workingDir)
+	if err != nil {
+		return err
+	}
+	existing, err := r.findPullRequest(output, workingDir, pr.UpstreamRepo, branchName)
+	if err != nil {
+		return err
+	}
+
+	reviewers := []bitbucketReviewer{}
+	known := map[string]bool{}
+	for _, reviewer := range existing.Reviewers {
+		reviewers = append(reviewers, bitbucketReviewer{User: reviewer.User})
+		known[reviewer.User.Name] = true
+	}
+	for _, name := range pr.Reviewers {
+		if !known[name] {
+			reviewer := bitbucketReviewer{}
+			reviewer.User.Name = name
+			reviewers = append(reviewers, reviewer)
+		}
+	}
+	r.warnOfUnsupportedOptions(output, pr)
+
+	project, slug := splitRepoName(pr.UpstreamRepo)
+	request := map[string]interface{}{
+		"version":     existing.Version,
+		"title":       pr.Title,
+		"description": pr.Body,
+		"reviewers":   reviewers,
+	}
+	if pr.Base != "" {
+		request["toRef"] = newBitbucketRef(pr.Base, project, slug)
+	}
+	return r.client.do(http.MethodPut, fmt.Sprintf("%s/pull-requests/%d", repoPath(project, slug), existing.Id), request, nil)
+}
+
+func (r *Bitbucket) GetPR(output io.Writer, workingDir string, fullRepoName string, branchName string) (*PrStatus, error) {
+	pr, err := r.findPullRequest(output, workingDir, fullRepoName, branchName)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PrStatus{
+		Closed:            pr.Closed,
+		HeadRefName:       pr.FromRef.DisplayId,
+		IsDraft:           pr.Draft,
+		Mergeable:         "UNKNOWN",
+		Number:            pr.Id,
+		ReactionGroups:    []ReactionGroup{},
+		ReviewDecision:    bitbucketReviewDecision(pr.Reviewers),
+		StatusCheckRollup: []StatusCheckRollup{},
+		Title:             pr.Title,
+		Url:               pr.url(),
+		CreatedAt:         bitbucketTime(pr.CreatedDate),
+		ClosedAt:          bitbucketTime(pr.ClosedDate),
+	}
+	switch pr.State {
+	case "MERGED":
+		status.State = "MERGED"
+		status.MergedAt = status.ClosedAt
+	case "DECLINED":
+		status.State = "CLOSED"
+	default:
+		status.State = "OPEN"
+	}
+
+	project, slug := splitRepoName(fullRepoName)
+	if status.State == "OPEN" {
+		var merge struct {
+			CanMerge   bool `json:"canMerge"`
+			Conflicted bool `json:"conflicted"`
+		}
+		if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/pull-requests/%d/merge", repoPath(project, slug), pr.Id), nil, &merge); err != nil {
+			return nil, err
+		}
+		if merge.Conflicted {
+			status.Mergeable = "CONFLICTING"
+		} else if merge.CanMerge {
+			status.Mergeable = "MERGEABLE"
+		}
+	}
+
+	if pr.FromRef.LatestCommit != "" {
+		var builds struct {
+			Values []struct {
+				State string `json:"state"`
+				Key   string `json:"key"`
+				Name  string `json:"name"`
+				Url   string `json:"url"`
+			} `json:"values"`
+		}
+		if err := r.client.do(http.MethodGet, r.rootUrl+"/rest/build-status/1.0/commits/"+pr.FromRef.LatestCommit, nil, &builds); err != nil {
+			return nil, err
+		}
+		for _, build := range builds.Values {
+			if build.Name == "" {
+				build.Name = build.Key
+			}
+			status.StatusCheckRollup = append(status.StatusCheckRollup, StatusCheckRollup{
+				State: bitbucketBuildState(build.State),
+				Name:  build.Name,
+				Url:   build.Url,
+			})
+		}
+	}
+
+	return status, nil
+}
+
+// bitbucketTime converts a time in milliseconds since the epoch, as Bitbucket gives them, leaving zero as unknown
+func bitbucketTime(millis int64) time.Time {
+	if millis == 0 {
+		return time.Time{}
+	}
+	return time.UnixMilli(millis).UTC()
+}
+
+// bitbucketReviewDecision summarises the statuses of the reviewers of a PR in the same way as GitHub
+func bitbucketReviewDecision(reviewers []bitbucketReviewer) string {
+	decision := "REVIEW_REQUIRED"
+	for _, reviewer := range reviewers {
+		switch reviewer.Status {
+		case "NEEDS_WORK":
+			return "CHANGES_REQUESTED"
+		case "APPROVED":
+			decision = "APPROVED"
+		}
+	}
+	return decision
+}
+
+// bitbucketBuildState translates the state of a Bitbucket build into the equivalent GitHub check state
+func bitbucketBuildState(state string) string {
+	switch state {
+	case "SUCCESSFUL":
+		return "SUCCESS"
+	case "FAILED":
+		return "FAILURE"
+	default:
+		return "PENDING"
+	}
+}
+
+func (r *Bitbucket) GetDefaultBranchName(_ io.Writer, _ string, fullRepoName string) (string, error) {
+	project, slug := splitRepoName(fullRepoName)
+	var branch struct {
+		DisplayId string `json:"displayId"`
+	}
+	if err := r.client.do(http.MethodGet, repoPath(project, slug)+"/branches/default", nil, &branch); err != nil {
+		return "", err
+	}
+	return branch.DisplayId, nil
+}
+
+func (r *Bitbucket) IsPushable(_ io.Writer, repo string) (bool, error) {
+	project, slug := splitRepoName(repo)
+	var response struct {
+		Values []bitbucketRepo `json:"values"`
+	}
+	query := url.Values{"name": {slug}, "permission": {"REPO_WRITE"}, "limit": {"100"}}
+	if err := r.client.do(http.MethodGet, "/repos?"+query.Encode(), nil, &response); err != nil {
+		return false, err
+	}
+	for _, writable := range response.Values {
+		if strings.EqualFold(writable.Project.Key, project) && writable.Slug == slug {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,236 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestItCreatesAPullRequestFromAForkOnBitbucket(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /rest/api/1.0/projects/ORG/repos/repo1/branches/default":
+			_, _ = fmt.Fprint(w, `{"id": "refs/heads/main", "displayId": "main"}`)
+		case "POST /rest/api/1.0/projects/ORG/repos/repo1/pull-requests":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprint(w, `{"id": 5, "links": {"self": [{"href": "https://bitbucket.example.com/projects/ORG/repos/repo1/pull-requests/5"}]}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	sb := strings.Builder{}
+	didCreate, prUrl, err := NewBitbucket(server.URL, "some-token").CreatePullRequest(&sb, "work/ORG/repo1", PullRequest{
+		Title:        "some title",
+		Body:         "some body",
+		UpstreamRepo: "bitbucket.example.com/ORG/repo1",
+		IsDraft:      true,
+		Labels:       []string{"dependencies"},
+		Reviewers:    []string{"octocat"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, didCreate)
+	assert.Equal(t, "https://bitbucket.example.com/projects/ORG/repos/repo1/pull-requests/5", prUrl)
+	assert.Contains(t, sb.String(), "does not support labels")
+
+	created := (*requests)[len(*requests)-1]
+	assert.Equal(t, map[string]interface{}{
+		"title":       "some title",
+		"description": "some body",
+		"draft":       true,
+		"fromRef": map[string]interface{}{
+			"id":         "refs/heads/turbolift-campaign",
+			"repository": map[string]interface{}{"slug": "repo1", "project": map[string]interface{}{"key": "me"}},
+		},
+		"toRef": map[string]interface{}{
+			"id":         "refs/heads/main",
+			"repository": map[string]interface{}{"slug": "repo1", "project": map[string]interface{}{"key": "ORG"}},
+		},
+		"reviewers": []interface{}{map[string]interface{}{"user": map[string]interface{}{"name": "octocat"}}},
+	}, created.body)
+}
+
+func TestItDoesNotCreateAnEmptyPullRequestOnBitbucket(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "POST":
+			w.WriteHeader(http.StatusConflict)
+			_, _ = fmt.Fprint(w, `{"errors": [{"message": "There are no changes", "exceptionName": "com.atlassian.bitbucket.pull.EmptyPullRequestException"}]}`)
+		default:
+			_, _ = fmt.Fprint(w, `{"displayId": "main"}`)
+		}
+	})
+
+	didCreate, _, err := NewBitbucket(server.URL, "some-token").CreatePullRequest(&strings.Builder{}, "work/ORG/repo1", PullRequest{
+		Title:        "some title",
+		UpstreamRepo: "ORG/repo1",
+	})
+	assert.NoError(t, err)
+	assert.False(t, didCreate)
+}
+
+func TestItGetsPullRequestStatusFromBitbucket(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/rest/api/1.0/projects/ORG/repos/repo1/pull-requests":
+			assert.Equal(t, "refs/heads/turbolift-campaign", r.URL.Query().Get("at"))
+			assert.Equal(t, "OUTGOING", r.URL.Query().Get("direction"))
+			assert.Equal(t, "ALL", r.URL.Query().Get("state"))
+			_, _ = fmt.Fprint(w, `{"isLastPage": true, "values": [
+				{"id": 3, "state": "DECLINED", "closed": true, "fromRef": {"displayId": "turbolift-campaign"}},
+				{"id": 2, "state": "OPEN", "title": "some title", "createdDate": 1709283600000, "fromRef": {"displayId": "turbolift-campaign", "latestCommit": "abc123"},
+					"reviewers": [{"user": {"name": "a"}, "status": "APPROVED"}, {"user": {"name": "b"}, "status": "UNAPPROVED"}],
+					"links": {"self": [{"href": "https://bitbucket.example.com/projects/ORG/repos/repo1/pull-requests/2"}]}}]}`)
+		case "/rest/api/1.0/projects/ORG/repos/repo1/pull-requests/2/merge":
+			_, _ = fmt.Fprint(w, `{"canMerge": false, "conflicted": true}`)
+		case "/rest/build-status/1.0/commits/abc123":
+			_, _ = fmt.Fprint(w, `{"values": [{"state": "SUCCESSFUL", "key": "build"}, {"state": "INPROGRESS", "name": "Deploy", "url": "https://ci.example.com/2"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	pr, err := NewBitbucket(server.URL, "some-token").GetPR(&strings.Builder{}, "work/ORG/repo1", "ORG/repo1", "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, &PrStatus{
+		HeadRefName:       "turbolift-campaign",
+		Mergeable:         "CONFLICTING",
+		Number:            2,
+		ReactionGroups:    []ReactionGroup{},
+		ReviewDecision:    "APPROVED",
+		State:             "OPEN",
+		StatusCheckRollup: []StatusCheckRollup{{State: "SUCCESS", Name: "build"}, {State: "PENDING", Name: "Deploy", Url: "https://ci.example.com/2"}},
+		Title:             "some title",
+		Url:               "https://bitbucket.example.com/projects/ORG/repos/repo1/pull-requests/2",
+		CreatedAt:         time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+	}, pr)
+}
+
+func TestItFindsPullRequestsRaisedFromForksOnBitbucket(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	workingDir := filepath.Join(t.TempDir(), "ORG", "repo1")
+	assert.NoError(t, os.MkdirAll(workingDir, 0o755))
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"isLastPage": true, "values": [{"id": 2, "version": 3, "state": "OPEN", "fromRef": {"displayId": "turbolift-campaign"}}]}`)
+	})
+
+	err := NewBitbucket(server.URL, "some-token").ClosePullRequest(&strings.Builder{}, workingDir, "ORG/repo1", "turbolift-campaign")
+	assert.NoError(t, err)
+
+	// PRs are looked up as outgoing from the fork that the working copy pushes to
+	assert.Equal(t, "/rest/api/1.0/projects/me/repos/repo1/pull-requests?at=refs%2Fheads%2Fturbolift-campaign&direction=OUTGOING&limit=100&order=NEWEST&state=ALL", (*requests)[0].path)
+	assert.Equal(t, "/rest/api/1.0/projects/ORG/repos/repo1/pull-requests/2/decline?version=3", (*requests)[1].path)
+}
+
+func TestItDeclinesPullRequestsOnBitbucket(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"isLastPage": true, "values": [{"id": 2, "version": 3, "state": "OPEN", "fromRef": {"displayId": "turbolift-campaign"}}]}`)
+	})
+
+	err := NewBitbucket(server.URL, "some-token").ClosePullRequest(&strings.Builder{}, "work/ORG/repo1", "ORG/repo1", "turbolift-campaign")
+	assert.NoError(t, err)
+
+	declined := (*requests)[len(*requests)-1]
+	assert.Equal(t, "POST", declined.method)
+	assert.Equal(t, "/rest/api/1.0/projects/ORG/repos/repo1/pull-requests/2/decline?version=3", declined.path)
+}
+
+func TestItCommentsOnPullRequestsOnBitbucket(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		_, _ = fmt.Fprint(w, `{"id": 9}`)
+	})
+
+	err := NewBitbucket(server.URL, "some-token").CommentOnPR(&strings.Builder{}, "bitbucket.example.com/ORG/repo1", 2, "Please review")
+	assert.NoError(t, err)
+	assert.Equal(t, "/rest/api/1.0/projects/ORG/repos/repo1/pull-requests/2/comments", (*requests)[0].path)
+	assert.Equal(t, map[string]interface{}{"text": "Please review"}, (*requests)[0].body)
+}
+
+func TestItReopensDeclinedPullRequestsAtTheirCurrentVersionOnBitbucket(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"id": 2, "version": 4, "state": "DECLINED"}`)
+	})
+
+	err := NewBitbucket(server.URL, "some-token").ReopenPullRequest(&strings.Builder{}, "bitbucket.example.com/ORG/repo1", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, "POST", (*requests)[1].method)
+	assert.Equal(t, "/rest/api/1.0/projects/ORG/repos/repo1/pull-requests/2/reopen?version=4", (*requests)[1].path)
+}
+
+func TestItReturnsNoPRFoundErrorWhenBitbucketHasNoPullRequest(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"isLastPage": true, "values": []}`)
+	})
+
+	_, err := NewBitbucket(server.URL, "some-token").GetPR(&strings.Builder{}, "work/ORG/repo1", "ORG/repo1", "turbolift-campaign")
+	var noPrErr *NoPRFoundError
+	assert.True(t, errors.As(err, &noPrErr))
+}
+
+func TestItKeepsExistingReviewersWhenUpdatingABitbucketPullRequest(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"isLastPage": true, "values": [{"id": 2, "version": 1, "state": "OPEN",
+			"fromRef": {"displayId": "turbolift-campaign"}, "reviewers": [{"user": {"name": "a"}, "status": "APPROVED"}]}]}`)
+	})
+
+	err := NewBitbucket(server.URL, "some-token").UpdatePRDescription(&strings.Builder{}, "work/ORG/repo1", PullRequest{
+		Title:     "new title",
+		Body:      "new body",
+		Reviewers: []string{"a", "b"},
+	})
+	assert.NoError(t, err)
+
+	updated := (*requests)[len(*requests)-1]
+	assert.Equal(t, "PUT", updated.method)
+	assert.Equal(t, map[string]interface{}{
+		"version":     float64(1),
+		"title":       "new title",
+		"description": "new body",
+		"reviewers": []interface{}{
+			map[string]interface{}{"user": map[string]interface{}{"name": "a"}},
+			map[string]interface{}{"user": map[string]interface{}{"name": "b"}},
+		},
+	}, updated.body)
+}
+
+func TestItChecksPushPermissionOnBitbucket(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "REPO_WRITE", r.URL.Query().Get("permission"))
+		_, _ = fmt.Fprint(w, `{"values": [{"slug": "repo1", "project": {"key": "OTHER"}}, {"slug": "repo1", "project": {"key": "ORG"}}]}`)
+	})
+	bitbucket := NewBitbucket(server.URL, "some-token")
+
+	pushable, err := bitbucket.IsPushable(&strings.Builder{}, "ORG/repo1")
+	assert.NoError(t, err)
+	assert.True(t, pushable)
+
+	pushable, err = bitbucket.IsPushable(&strings.Builder{}, "ELSEWHERE/repo1")
+	assert.NoError(t, err)
+	assert.False(t, pushable)
+}
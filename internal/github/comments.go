@@ -0,0 +1,72 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+// Comments on PRs, which are posted to the conversation of a PR identified by its number within a repo named as in
+// repos.txt, i.e. [host/]owner/repo.
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+func (r *RealGitHub) CommentOnPR(output io.Writer, fullRepoName string, number int, body string) error {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return execInstance.Execute(output, currentDir, "gh", "pr", "comment", fmt.Sprint(number), "--repo", fullRepoName, "--body", body)
+}
+
+// CommentOnPR posts a comment through the issues API, as PR conversations are shared with issues
+func (r *GitHubAPI) CommentOnPR(_ io.Writer, fullRepoName string, number int, body string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues/%d/comments", owner, name, number), map[string]interface{}{
+		"body": body,
+	}, nil)
+}
+
+// CommentOnPR adds a note to a merge request
+func (r *GitLab) CommentOnPR(_ io.Writer, fullRepoName string, number int, body string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/merge_requests/%d/notes", projectPath(owner, name), number), map[string]interface{}{
+		"body": body,
+	}, nil)
+}
+
+func (r *Bitbucket) CommentOnPR(_ io.Writer, fullRepoName string, number int, body string) error {
+	project, slug := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/pull-requests/%d/comments", repoPath(project, slug), number), map[string]interface{}{
+		"text": body,
+	}, nil)
+}
+
+func (r *Gitea) CommentOnPR(_ io.Writer, fullRepoName string, number int, body string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/issues/%d/comments", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"body": body,
+	}, nil)
+}
+
+func (r *ForgeRouter) CommentOnPR(output io.Writer, fullRepoName string, number int, body string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.CommentOnPR(output, fullRepoName, number, body)
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+// Moving existing PRs in and out of draft. PRs are identified by their number within a repo named as in repos.txt,
+// i.e. [host/]owner/repo.
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+)
+
+func (r *RealGitHub) MarkPRReady(output io.Writer, fullRepoName string, number int) error {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return execInstance.Execute(output, currentDir, "gh", "pr", "ready", fmt.Sprint(number), "--repo", fullRepoName)
+}
+
+func (r *RealGitHub) ConvertPRToDraft(output io.Writer, fullRepoName string, number int) error {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return execInstance.Execute(output, currentDir, "gh", "pr", "ready", fmt.Sprint(number), "--repo", fullRepoName, "--undo")
+}
+
+func (r *GitHubAPI) MarkPRReady(_ io.Writer, fullRepoName string, number int) error {
+	id, err := r.pullRequestNodeId(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	return r.graphql(`mutation($id: ID!) {
+  markPullRequestReadyForReview(input: {pullRequestId: $id}) { clientMutationId }
+}`, map[string]interface{}{"id": id}, &struct{}{})
+}
+
+func (r *GitHubAPI) ConvertPRToDraft(_ io.Writer, fullRepoName string, number int) error {
+	id, err := r.pullRequestNodeId(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	return r.graphql(`mutation($id: ID!) {
+  convertPullRequestToDraft(input: {pullRequestId: $id}) { clientMutationId }
+}`, map[string]interface{}{"id": id}, &struct{}{})
+}
+
+// MarkPRReady drops the draft prefix from the title of a merge request
+func (r *GitLab) MarkPRReady(_ io.Writer, fullRepoName string, number int) error {
+	existing, err := r.getMergeRequest(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	title := strings.TrimPrefix(existing.Title, gitLabDraftPrefix)
+	return r.updateMergeRequest(fullRepoName, number, map[string]interface{}{"title": title})
+}
+
+// ConvertPRToDraft adds the draft prefix to the title of a merge request
+func (r *GitLab) ConvertPRToDraft(_ io.Writer, fullRepoName string, number int) error {
+	existing, err := r.getMergeRequest(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	if existing.Draft {
+		return nil
+	}
+	return r.updateMergeRequest(fullRepoName, number, map[string]interface{}{"title": gitLabDraftPrefix + existing.Title})
+}
+
+// setDraft updates a PR's draft flag, keeping its title, description and reviewers, which Bitbucket would otherwise
+// clear
+func (r *Bitbucket) setDraft(fullRepoName string, number int, draft bool) error {
+	project, slug := splitRepoName(fullRepoName)
+	var existing bitbucketPullRequest
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/pull-requests/%d", repoPath(project, slug), number), nil, &existing); err != nil {
+		return err
+	}
+
+	reviewers := []bitbucketReviewer{}
+	for _, reviewer := range existing.Reviewers {
+		reviewers = append(reviewers, bitbucketReviewer{User: reviewer.User})
+	}
+	return r.client.do(http.MethodPut, fmt.Sprintf("%s/pull-requests/%d", repoPath(project, slug), number), map[string]interface{}{
+		"version":     existing.Version,
+		"title":       existing.Title,
+		"description": existing.Description,
+		"reviewers":   reviewers,
+		"draft":       draft,
+	}, nil)
+}
+
+func (r *Bitbucket) MarkPRReady(_ io.Writer, fullRepoName string, number int) error {
+	return r.setDraft(fullRepoName, number, false)
+}
+
+func (r *Bitbucket) ConvertPRToDraft(_ io.Writer, fullRepoName string, number int) error {
+	return r.setDraft(fullRepoName, number, true)
+}
+
+// setTitle replaces the title of a PR with the result of retitle
+func (r *Gitea) setTitle(fullRepoName string, number int, retitle func(string) string) error {
+	owner, name := splitRepoName(fullRepoName)
+	var existing giteaPullRequest
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/pulls/%d", giteaRepoPath(owner, name), number), nil, &existing); err != nil {
+		return err
+	}
+	title := retitle(existing.Title)
+	if title == existing.Title {
+		return nil
+	}
+	return r.client.do(http.MethodPatch, fmt.Sprintf("%s/pulls/%d", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"title": title,
+	}, nil)
+}
+
+// MarkPRReady drops the work in progress prefix from the title of a PR
+func (r *Gitea) MarkPRReady(_ io.Writer, fullRepoName string, number int) error {
+	return r.setTitle(fullRepoName, number, func(title string) string {
+		return strings.TrimPrefix(title, giteaDraftPrefix)
+	})
+}
+
+// ConvertPRToDraft adds the work in progress prefix to the title of a PR
+func (r *Gitea) ConvertPRToDraft(_ io.Writer, fullRepoName string, number int) error {
+	return r.setTitle(fullRepoName, number, func(title string) string {
+		if strings.HasPrefix(title, giteaDraftPrefix) {
+			return title
+		}
+		return giteaDraftPrefix + title
+	})
+}
+
+func (r *ForgeRouter) MarkPRReady(output io.Writer, fullRepoName string, number int) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.MarkPRReady(output, fullRepoName, number)
+}
+
+func (r *ForgeRouter) ConvertPRToDraft(output io.Writer, fullRepoName string, number int) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.ConvertPRToDraft(output, fullRepoName, number)
+}
@@ -17,7 +17,10 @@ package github
 
 import (
 	"errors"
+	"fmt"
 	"io"
+	"path"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -33,18 +36,40 @@ const (
 	GetDefaultBranchName
 	UpdatePRDescription
 	IsPushable
+	MergePullRequest
+	ReopenPullRequest
+	EnableAutoMerge
+	DisableAutoMerge
+	MarkPRReady
+	ConvertPRToDraft
+	CommentOnPR
+	AddLabels
+	RemoveLabels
+	AddReviewers
+	RemoveReviewers
+	AddAssignees
+	RemoveAssignees
+	CreateIssue
+	GetIssue
+	UpdateIssueBody
 )
 
 type FakeGitHub struct {
 	handler          func(command Command, args []string) (bool, error)
 	returningHandler func(workingDir string) (interface{}, error)
 	calls            [][]string
+	// issues holds the bodies of the issues that have been created or updated, by repo and number
+	issues map[string]string
 }
 
-func (f *FakeGitHub) CreatePullRequest(_ io.Writer, workingDir string, metadata PullRequest) (didCreate bool, err error) {
-	args := []string{"create_pull_request", workingDir, metadata.Title}
+func (f *FakeGitHub) CreatePullRequest(_ io.Writer, workingDir string, metadata PullRequest) (didCreate bool, prUrl string, err error) {
+	args := append([]string{"create_pull_request", workingDir, metadata.Title}, fakePrOptionArgs(metadata)...)
 	f.calls = append(f.calls, args)
-	return f.handler(CreatePullRequest, args)
+	didCreate, err = f.handler(CreatePullRequest, args)
+	if didCreate {
+		prUrl = fmt.Sprintf("https://github.com/%s/pull/1", metadata.UpstreamRepo)
+	}
+	return didCreate, prUrl, err
 }
 
 func (f *FakeGitHub) ForkAndClone(_ io.Writer, workingDir string, fullRepoName string) error {
@@ -67,14 +92,59 @@ func (f *FakeGitHub) IsPushable(_ io.Writer, repo string) (bool, error) {
 	return f.handler(IsPushable, args)
 }
 
-func (f *FakeGitHub) ClosePullRequest(_ io.Writer, workingDir string, branchName string) error {
+func (f *FakeGitHub) ClosePullRequest(_ io.Writer, workingDir string, _ string, branchName string) error {
 	args := []string{"close_pull_request", workingDir, branchName}
 	f.calls = append(f.calls, args)
 	_, err := f.handler(ClosePullRequest, args)
 	return err
 }
 
-func (f *FakeGitHub) GetPR(_ io.Writer, workingDir string, _ string) (*PrStatus, error) {
+func (f *FakeGitHub) MergePullRequest(_ io.Writer, fullRepoName string, number int, strategy string, deleteBranch bool) error {
+	args := []string{"merge_pull_request", fullRepoName, fmt.Sprint(number), strategy}
+	if deleteBranch {
+		args = append(args, "delete_branch")
+	}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(MergePullRequest, args)
+	return err
+}
+
+func (f *FakeGitHub) ReopenPullRequest(_ io.Writer, fullRepoName string, number int) error {
+	args := []string{"reopen_pull_request", fullRepoName, fmt.Sprint(number)}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(ReopenPullRequest, args)
+	return err
+}
+
+func (f *FakeGitHub) EnableAutoMerge(_ io.Writer, fullRepoName string, number int, strategy string) error {
+	args := []string{"enable_auto_merge", fullRepoName, fmt.Sprint(number), strategy}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(EnableAutoMerge, args)
+	return err
+}
+
+func (f *FakeGitHub) DisableAutoMerge(_ io.Writer, fullRepoName string, number int) error {
+	args := []string{"disable_auto_merge", fullRepoName, fmt.Sprint(number)}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(DisableAutoMerge, args)
+	return err
+}
+
+func (f *FakeGitHub) MarkPRReady(_ io.Writer, fullRepoName string, number int) error {
+	args := []string{"mark_pr_ready", fullRepoName, fmt.Sprint(number)}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(MarkPRReady, args)
+	return err
+}
+
+func (f *FakeGitHub) ConvertPRToDraft(_ io.Writer, fullRepoName string, number int) error {
+	args := []string{"convert_pr_to_draft", fullRepoName, fmt.Sprint(number)}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(ConvertPRToDraft, args)
+	return err
+}
+
+func (f *FakeGitHub) GetPR(_ io.Writer, workingDir string, _ string, _ string) (*PrStatus, error) {
 	f.calls = append(f.calls, []string{"get_pr", workingDir})
 	result, err := f.returningHandler(workingDir)
 	if result == nil {
@@ -83,6 +153,72 @@ func (f *FakeGitHub) GetPR(_ io.Writer, workingDir string, _ string) (*PrStatus,
 	return result.(*PrStatus), err
 }
 
+func (f *FakeGitHub) CommentOnPR(_ io.Writer, fullRepoName string, number int, body string) error {
+	args := []string{"comment_on_pr", fullRepoName, fmt.Sprint(number), body}
+	f.calls = append(f.calls, args)
+	_, err := f.handler(CommentOnPR, args)
+	return err
+}
+
+func (f *FakeGitHub) AddLabels(_ io.Writer, fullRepoName string, number int, values []string) error {
+	args := append([]string{"add_labels", fullRepoName, fmt.Sprint(number)}, values...)
+	f.calls = append(f.calls, args)
+	_, err := f.handler(AddLabels, args)
+	return err
+}
+
+func (f *FakeGitHub) RemoveLabels(_ io.Writer, fullRepoName string, number int, values []string) error {
+	args := append([]string{"remove_labels", fullRepoName, fmt.Sprint(number)}, values...)
+	f.calls = append(f.calls, args)
+	_, err := f.handler(RemoveLabels, args)
+	return err
+}
+
+func (f *FakeGitHub) AddReviewers(_ io.Writer, fullRepoName string, number int, values []string) error {
+	args := append([]string{"add_reviewers", fullRepoName, fmt.Sprint(number)}, values...)
+	f.calls = append(f.calls, args)
+	_, err := f.handler(AddReviewers, args)
+	return err
+}
+
+func (f *FakeGitHub) RemoveReviewers(_ io.Writer, fullRepoName string, number int, values []string) error {
+	args := append([]string{"remove_reviewers", fullRepoName, fmt.Sprint(number)}, values...)
+	f.calls = append(f.calls, args)
+	_, err := f.handler(RemoveReviewers, args)
+	return err
+}
+
+func (f *FakeGitHub) AddAssignees(_ io.Writer, fullRepoName string, number int, values []string) error {
+	args := append([]string{"add_assignees", fullRepoName, fmt.Sprint(number)}, values...)
+	f.calls = append(f.calls, args)
+	_, err := f.handler(AddAssignees, args)
+	return err
+}
+
+func (f *FakeGitHub) RemoveAssignees(_ io.Writer, fullRepoName string, number int, values []string) error {
+	args := append([]string{"remove_assignees", fullRepoName, fmt.Sprint(number)}, values...)
+	f.calls = append(f.calls, args)
+	_, err := f.handler(RemoveAssignees, args)
+	return err
+}
+
+func (f *FakeGitHub) GetPRs(_ io.Writer, fullRepoNames []string, branchName string) (map[string]*PrStatus, map[string]error, error) {
+	f.calls = append(f.calls, append([]string{"get_prs", branchName}, fullRepoNames...))
+	results := map[string]*PrStatus{}
+	errs := map[string]error{}
+	for _, fullRepoName := range fullRepoNames {
+		owner, name := splitRepoName(fullRepoName)
+		result, err := f.returningHandler(path.Join("work", owner, name))
+		var noPrErr *NoPRFoundError
+		if err != nil && !errors.As(err, &noPrErr) {
+			errs[fullRepoName] = err
+		} else if pr, ok := result.(*PrStatus); ok && err == nil && pr != nil {
+			results[fullRepoName] = pr
+		}
+	}
+	return results, errs, nil
+}
+
 func (f *FakeGitHub) GetDefaultBranchName(_ io.Writer, workingDir string, fullRepoName string) (string, error) {
 	args := []string{"get_default_branch", workingDir, fullRepoName}
 	f.calls = append(f.calls, args)
@@ -90,13 +226,71 @@ func (f *FakeGitHub) GetDefaultBranchName(_ io.Writer, workingDir string, fullRe
 	return "main", err
 }
 
-func (f *FakeGitHub) UpdatePRDescription(_ io.Writer, workingDir string, title string, body string) error {
-	args := []string{"update_pr_description", workingDir, title, body}
+func (f *FakeGitHub) UpdatePRDescription(_ io.Writer, workingDir string, pr PullRequest) error {
+	args := append([]string{"update_pr_description", workingDir, pr.Title, pr.Body}, fakePrOptionArgs(pr)...)
 	f.calls = append(f.calls, args)
 	_, err := f.handler(UpdatePRDescription, args)
 	return err
 }
 
+func (f *FakeGitHub) CreateIssue(_ io.Writer, fullRepoName string, title string, body string) (*Issue, error) {
+	args := []string{"create_issue", fullRepoName, title, body}
+	f.calls = append(f.calls, args)
+	if _, err := f.handler(CreateIssue, args); err != nil {
+		return nil, err
+	}
+	f.issues[fullRepoName+"#1"] = body
+	return &Issue{Number: 1, Url: fmt.Sprintf("https://github.com/%s/issues/1", fullRepoName), Title: title, Body: body}, nil
+}
+
+func (f *FakeGitHub) GetIssue(_ io.Writer, fullRepoName string, number int) (*Issue, error) {
+	args := []string{"get_issue", fullRepoName, fmt.Sprint(number)}
+	f.calls = append(f.calls, args)
+	if _, err := f.handler(GetIssue, args); err != nil {
+		return nil, err
+	}
+	return &Issue{Number: number, Url: fmt.Sprintf("https://github.com/%s/issues/%d", fullRepoName, number), Body: f.issues[fmt.Sprintf("%s#%d", fullRepoName, number)]}, nil
+}
+
+func (f *FakeGitHub) UpdateIssueBody(_ io.Writer, fullRepoName string, number int, body string) error {
+	args := []string{"update_issue_body", fullRepoName, fmt.Sprint(number), body}
+	f.calls = append(f.calls, args)
+	if _, err := f.handler(UpdateIssueBody, args); err != nil {
+		return err
+	}
+	f.issues[fmt.Sprintf("%s#%d", fullRepoName, number)] = body
+	return nil
+}
+
+// SetIssueBody sets the body of an existing issue, for tests that reuse an issue
+func (f *FakeGitHub) SetIssueBody(fullRepoName string, number int, body string) {
+	f.issues[fmt.Sprintf("%s#%d", fullRepoName, number)] = body
+}
+
+// fakePrOptionArgs records the optional settings of a PR, when they are given, so that tests can assert on them
+func fakePrOptionArgs(pr PullRequest) []string {
+	var args []string
+	if len(pr.Labels) > 0 {
+		args = append(args, "labels="+strings.Join(pr.Labels, ","))
+	}
+	if len(pr.Reviewers) > 0 {
+		args = append(args, "reviewers="+strings.Join(pr.Reviewers, ","))
+	}
+	if len(pr.TeamReviewers) > 0 {
+		args = append(args, "team_reviewers="+strings.Join(pr.TeamReviewers, ","))
+	}
+	if len(pr.Assignees) > 0 {
+		args = append(args, "assignees="+strings.Join(pr.Assignees, ","))
+	}
+	if pr.Milestone != "" {
+		args = append(args, "milestone="+pr.Milestone)
+	}
+	if pr.Base != "" {
+		args = append(args, "base="+pr.Base)
+	}
+	return args
+}
+
 func (f *FakeGitHub) AssertCalledWith(t *testing.T, expected [][]string) {
 	assert.Equal(t, expected, f.calls)
 }
@@ -106,6 +300,7 @@ func NewFakeGitHub(h func(command Command, args []string) (bool, error), r func(
 		handler:          h,
 		returningHandler: r,
 		calls:            [][]string{},
+		issues:           map[string]string{},
 	}
 }
 
@@ -0,0 +1,297 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sync"
+
+	"github.com/skyscanner/turbolift/internal/config"
+)
+
+// Forge types that can be given in the turbolift configuration
+const (
+	ForgeTypeGh        = "gh"
+	ForgeTypeGitHub    = "github"
+	ForgeTypeGitLab    = "gitlab"
+	ForgeTypeBitbucket = "bitbucket"
+	ForgeTypeGitea     = "gitea"
+)
+
+// ForgeRouter implements GitHub by passing each call on to the implementation configured for the host of the repo
+// concerned. Hosts without any configuration are handled with the gh CLI.
+type ForgeRouter struct {
+	once     sync.Once
+	mu       sync.Mutex
+	err      error
+	config   *config.Config
+	backends map[backendKey]GitHub
+}
+
+// backendKey identifies a backend, which depends on the host as well as the forge when the forge has no url of its own
+type backendKey struct {
+	host  string
+	forge config.Forge
+}
+
+// NewGitHub creates a GitHub that uses the forges configured in turbolift.yml, if any. The configuration is read
+// when first needed.
+func NewGitHub() *ForgeRouter {
+	return &ForgeRouter{backends: map[backendKey]GitHub{}}
+}
+
+// NewForgeRouter creates a GitHub that uses the given configuration
+func NewForgeRouter(c *config.Config) *ForgeRouter {
+	r := NewGitHub()
+	r.once.Do(func() {
+		r.config = c
+	})
+	return r
+}
+
+func (r *ForgeRouter) loadConfig() error {
+	r.once.Do(func() {
+		r.config, r.err = config.Load()
+	})
+	return r.err
+}
+
+// forHost returns the implementation for repos on a host, which is "" for repos listed without one
+func (r *ForgeRouter) forHost(output io.Writer, host string) (GitHub, error) {
+	if err := r.loadConfig(); err != nil {
+		return nil, err
+	}
+	forge, ok := r.config.ForgeFor(host)
+	if !ok {
+		forge = config.Forge{Type: ForgeTypeGh}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := backendKey{host: host, forge: forge}
+	if backend, ok := r.backends[key]; ok {
+		return backend, nil
+	}
+	backend, err := newBackend(output, host, forge)
+	if err != nil {
+		return nil, err
+	}
+	r.backends[key] = backend
+	return backend, nil
+}
+
+// forRepo returns the implementation for a repo named as in repos.txt
+func (r *ForgeRouter) forRepo(output io.Writer, fullRepoName string) (GitHub, error) {
+	return r.forHost(output, hostFromRepoName(fullRepoName))
+}
+
+func newBackend(output io.Writer, host string, forge config.Forge) (GitHub, error) {
+	switch forge.Type {
+	case "", ForgeTypeGh:
+		return NewRealGitHub(), nil
+	case ForgeTypeGitHub:
+		apiUrl := forge.Url
+		if apiUrl == "" {
+			apiUrl = DefaultGitHubApiUrl
+		}
+		host := "github.com"
+		if apiUrl != DefaultGitHubApiUrl {
+			parsed, err := url.Parse(apiUrl)
+			if err != nil {
+				return nil, fmt.Errorf("invalid url for forge: %w", err)
+			}
+			host = parsed.Hostname()
+		}
+		token, err := gitHubToken(output, host, forge.TokenEnv)
+		if err != nil {
+			return nil, err
+		}
+		return NewGitHubAPI(apiUrl, token), nil
+	case ForgeTypeGitLab:
+		token, err := envToken(forge.TokenEnv, "GITLAB_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		baseUrl, err := forgeUrl(host, forge)
+		if err != nil {
+			return nil, err
+		}
+		return NewGitLab(baseUrl, token), nil
+	case ForgeTypeBitbucket:
+		token, err := envToken(forge.TokenEnv, "BITBUCKET_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		baseUrl, err := forgeUrl(host, forge)
+		if err != nil {
+			return nil, err
+		}
+		return NewBitbucket(baseUrl, token), nil
+	case ForgeTypeGitea:
+		token, err := envToken(forge.TokenEnv, "GITEA_TOKEN")
+		if err != nil {
+			return nil, err
+		}
+		baseUrl, err := forgeUrl(host, forge)
+		if err != nil {
+			return nil, err
+		}
+		return NewGitea(baseUrl, token), nil
+	default:
+		return nil, fmt.Errorf("unknown forge type %s", forge.Type)
+	}
+}
+
+// forgeUrl returns the configured URL of a self-hosted forge, which defaults to the root of its host. Repos listed
+// without a host have no host to default to, so the default forge must be given a url.
+func forgeUrl(host string, forge config.Forge) (string, error) {
+	if forge.Url != "" {
+		return forge.Url, nil
+	}
+	if host == "" {
+		return "", fmt.Errorf("the %s forge of type %s needs a url", config.DefaultForge, forge.Type)
+	}
+	return "https://" + host, nil
+}
+
+func (r *ForgeRouter) ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.ForkAndClone(output, workingDir, fullRepoName)
+}
+
+func (r *ForgeRouter) Clone(output io.Writer, workingDir string, fullRepoName string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.Clone(output, workingDir, fullRepoName)
+}
+
+func (r *ForgeRouter) CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (bool, string, error) {
+	backend, err := r.forRepo(output, pr.UpstreamRepo)
+	if err != nil {
+		return false, "", err
+	}
+	return backend.CreatePullRequest(output, workingDir, pr)
+}
+
+func (r *ForgeRouter) ClosePullRequest(output io.Writer, workingDir string, fullRepoName string, branchName string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.ClosePullRequest(output, workingDir, fullRepoName, branchName)
+}
+
+func (r *ForgeRouter) MergePullRequest(output io.Writer, fullRepoName string, number int, strategy string, deleteBranch bool) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.MergePullRequest(output, fullRepoName, number, strategy, deleteBranch)
+}
+
+func (r *ForgeRouter) ReopenPullRequest(output io.Writer, fullRepoName string, number int) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.ReopenPullRequest(output, fullRepoName, number)
+}
+
+func (r *ForgeRouter) EnableAutoMerge(output io.Writer, fullRepoName string, number int, strategy string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.EnableAutoMerge(output, fullRepoName, number, strategy)
+}
+
+func (r *ForgeRouter) DisableAutoMerge(output io.Writer, fullRepoName string, number int) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.DisableAutoMerge(output, fullRepoName, number)
+}
+
+func (r *ForgeRouter) UpdatePRDescription(output io.Writer, workingDir string, pr PullRequest) error {
+	backend, err := r.forRepo(output, pr.UpstreamRepo)
+	if err != nil {
+		return err
+	}
+	return backend.UpdatePRDescription(output, workingDir, pr)
+}
+
+func (r *ForgeRouter) GetPR(output io.Writer, workingDir string, fullRepoName string, branchName string) (*PrStatus, error) {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetPR(output, workingDir, fullRepoName, branchName)
+}
+
+func (r *ForgeRouter) GetPRs(output io.Writer, fullRepoNames []string, branchName string) (map[string]*PrStatus, map[string]error, error) {
+	var backends []GitHub
+	reposByBackend := map[GitHub][]string{}
+	for _, fullRepoName := range fullRepoNames {
+		backend, err := r.forRepo(output, fullRepoName)
+		if err != nil {
+			return nil, nil, err
+		}
+		if _, ok := reposByBackend[backend]; !ok {
+			backends = append(backends, backend)
+		}
+		reposByBackend[backend] = append(reposByBackend[backend], fullRepoName)
+	}
+
+	results := map[string]*PrStatus{}
+	errs := map[string]error{}
+	for _, backend := range backends {
+		found, backendErrs, err := backend.GetPRs(output, reposByBackend[backend], branchName)
+		if err != nil {
+			return nil, nil, err
+		}
+		for repo, pr := range found {
+			results[repo] = pr
+		}
+		for repo, err := range backendErrs {
+			errs[repo] = err
+		}
+	}
+	return results, errs, nil
+}
+
+func (r *ForgeRouter) GetDefaultBranchName(output io.Writer, workingDir string, fullRepoName string) (string, error) {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return "", err
+	}
+	return backend.GetDefaultBranchName(output, workingDir, fullRepoName)
+}
+
+func (r *ForgeRouter) IsPushable(output io.Writer, repo string) (bool, error) {
+	backend, err := r.forRepo(output, repo)
+	if err != nil {
+		return false, err
+	}
+	return backend.IsPushable(output, repo)
+}
@@ -0,0 +1,514 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Gitea implements GitHub for Gitea and Forgejo, using the v1 REST API
+type Gitea struct {
+	client *apiClient
+}
+
+// NewGitea creates a client for the Gitea or Forgejo instance at baseUrl, e.g. https://gitea.example.com
+func NewGitea(baseUrl string, token string) *Gitea {
+	return &Gitea{
+		client: newApiClient(strings.TrimSuffix(baseUrl, "/")+"/api/v1", token, nil),
+	}
+}
+
+const (
+	// giteaDraftPrefix marks a PR as a work in progress, which Gitea recognises by its title
+	giteaDraftPrefix = "WIP: "
+	// giteaPageSize is the largest page that Gitea returns by default
+	giteaPageSize = 50
+	// maxGiteaPages limits how far back through a repo's PRs to look for one raised from the campaign branch
+	maxGiteaPages = 10
+)
+
+type giteaRepo struct {
+	FullName      string `json:"full_name"`
+	CloneUrl      string `json:"clone_url"`
+	DefaultBranch string `json:"default_branch"`
+	Permissions   struct {
+		Push bool `json:"push"`
+	} `json:"permissions"`
+}
+
+type giteaUser struct {
+	Login string `json:"login"`
+}
+
+type giteaPullRequest struct {
+	Number    int         `json:"number"`
+	Title     string      `json:"title"`
+	State     string      `json:"state"`
+	Merged    bool        `json:"merged"`
+	Mergeable bool        `json:"mergeable"`
+	HtmlUrl   string      `json:"html_url"`
+	Assignees []giteaUser `json:"assignees"`
+	CreatedAt time.Time   `json:"created_at"`
+	MergedAt  time.Time   `json:"merged_at"`
+	ClosedAt  time.Time   `json:"closed_at"`
+	Head      struct {
+		Ref string `json:"ref"`
+		Sha string `json:"sha"`
+	} `json:"head"`
+}
+
+func giteaRepoPath(owner string, name string) string {
+	return fmt.Sprintf("/repos/%s/%s", url.PathEscape(owner), url.PathEscape(name))
+}
+
+func (r *Gitea) getRepo(owner string, name string) (*giteaRepo, error) {
+	var repo giteaRepo
+	if err := r.client.do(http.MethodGet, giteaRepoPath(owner, name), nil, &repo); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+func (r *Gitea) ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error {
+	owner, name := splitRepoName(fullRepoName)
+	upstream, err := r.getRepo(owner, name)
+	if err != nil {
+		return err
+	}
+
+	var fork giteaRepo
+	err = r.client.do(http.MethodPost, giteaRepoPath(owner, name)+"/forks", map[string]interface{}{}, &fork)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		// the repo has already been forked by the user
+		var user giteaUser
+		if err := r.client.do(http.MethodGet, "/user", nil, &user); err != nil {
+			return err
+		}
+		existing, err := r.getRepo(user.Login, name)
+		if err != nil {
+			return err
+		}
+		fork = *existing
+	} else if err != nil {
+		return err
+	}
+
+	return cloneRepo(output, workingDir, fork.CloneUrl, name, upstream.CloneUrl)
+}
+
+func (r *Gitea) Clone(output io.Writer, workingDir string, fullRepoName string) error {
+	owner, name := splitRepoName(fullRepoName)
+	repo, err := r.getRepo(owner, name)
+	if err != nil {
+		return err
+	}
+	return cloneRepo(output, workingDir, repo.CloneUrl, name, "")
+}
+
+func (r *Gitea) CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (didCreate bool, prUrl string, err error) {
+	owner, name := splitRepoName(pr.UpstreamRepo)
+
+	branch, err := currentBranch(output, workingDir)
+	if err != nil {
+		return false, "", err
+	}
+	headOwner, err := originOwner(output, workingDir)
+	if err != nil {
+		return false, "", err
+	}
+	head := branch
+	if headOwner != owner {
+		head = headOwner + ":" + branch
+	}
+
+	base := pr.Base
+	if base == "" {
+		if base, err = r.GetDefaultBranchName(output, workingDir, pr.UpstreamRepo); err != nil {
+			return false, "", err
+		}
+	}
+
+	// check that there is something to merge first; versions of Gitea without the compare API will reject an empty
+	// PR themselves
+	var comparison struct {
+		TotalCommits int `json:"total_commits"`
+	}
+	err = r.client.do(http.MethodGet, fmt.Sprintf("%s/compare/%s...%s", giteaRepoPath(owner, name), url.PathEscape(base), url.PathEscape(head)), nil, &comparison)
+	var apiErr *APIError
+	if err == nil && comparison.TotalCommits == 0 {
+		return false, "", nil
+	} else if err != nil && !(errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound) {
+		return false, "", err
+	}
+
+	title := pr.Title
+	if pr.IsDraft {
+		title = giteaDraftPrefix + title
+	}
+	request := map[string]interface{}{
+		"title": title,
+		"body":  pr.Body,
+		"head":  head,
+		"base":  base,
+	}
+	if len(pr.Labels) > 0 {
+		ids, err := r.labelIds(owner, name, pr.Labels)
+		if err != nil {
+			return false, "", err
+		}
+		request["labels"] = ids
+	}
+	if len(pr.Assignees) > 0 {
+		request["assignees"] = pr.Assignees
+	}
+	if pr.Milestone != "" {
+		id, err := r.milestoneId(owner, name, pr.Milestone)
+		if err != nil {
+			return false, "", err
+		}
+		request["milestone"] = id
+	}
+
+	var created giteaPullRequest
+	if err := r.client.do(http.MethodPost, giteaRepoPath(owner, name)+"/pulls", request, &created); err != nil {
+		return false, "", err
+	}
+	if err := r.requestReviews(owner, name, created.Number, pr); err != nil {
+		return false, "", err
+	}
+
+	_, _ = fmt.Fprintln(output, created.HtmlUrl)
+	return true, created.HtmlUrl, nil
+}
+
+// labelIds returns the ids of the named labels of a repo, which Gitea needs in place of their names
+func (r *Gitea) labelIds(owner string, name string, labels []string) ([]int, error) {
+	known := map[string]int{}
+	for page := 1; page <= maxGiteaPages; page++ {
+		var repoLabels []struct {
+			Id   int    `json:"id"`
+			Name string `json:"name"`
+		}
+		if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/labels?page=%d&limit=%d", giteaRepoPath(owner, name), page, giteaPageSize), nil, &repoLabels); err != nil {
+			return nil, err
+		}
+		for _, label := range repoLabels {
+			known[label.Name] = label.Id
+		}
+		if len(repoLabels) < giteaPageSize {
+			break
+		}
+	}
+
+	ids := []int{}
+	for _, label := range labels {
+		id, ok := known[label]
+		if !ok {
+			return nil, fmt.Errorf("no label named %s in %s/%s", label, owner, name)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+func (r *Gitea) milestoneId(owner string, name string, milestone string) (int, error) {
+	var milestones []struct {
+		Id    int    `json:"id"`
+		Title string `json:"title"`
+	}
+	query := url.Values{"name": {milestone}, "state": {"open"}}
+	if err := r.client.do(http.MethodGet, giteaRepoPath(owner, name)+"/milestones?"+query.Encode(), nil, &milestones); err != nil {
+		return 0, err
+	}
+	for _, m := range milestones {
+		if m.Title == milestone {
+			return m.Id, nil
+		}
+	}
+	return 0, fmt.Errorf("no open milestone named %s", milestone)
+}
+
+// requestReviews asks the reviewers and team reviewers of pr to review a PR, if there are any
+func (r *Gitea) requestReviews(owner string, name string, number int, pr PullRequest) error {
+	if len(pr.Reviewers) == 0 && len(pr.TeamReviewers) == 0 {
+		return nil
+	}
+	request := map[string]interface{}{
+		"reviewers":      append([]string{}, pr.Reviewers...),
+		"team_reviewers": append([]string{}, pr.TeamReviewers...),
+	}
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/pulls/%d/requested_reviewers", giteaRepoPath(owner, name), number), request, nil)
+}
+
+// findPullRequest returns the most relevant PR raised from a branch into the upstream repo of a working copy,
+// preferring one that is open
+func (r *Gitea) findPullRequest(workingDir string, fullRepoName string, branchName string) (*giteaPullRequest, error) {
+	owner, name := splitRepoName(fullRepoName)
+
+	var found *giteaPullRequest
+	for page := 1; page <= maxGiteaPages; page++ {
+		var pulls []giteaPullRequest
+		query := url.Values{"state": {"all"}, "sort": {"recentupdate"}, "page": {fmt.Sprint(page)}, "limit": {fmt.Sprint(giteaPageSize)}}
+		if err := r.client.do(http.MethodGet, giteaRepoPath(owner, name)+"/pulls?"+query.Encode(), nil, &pulls); err != nil {
+			return nil, err
+		}
+
+		for i, pr := range pulls {
+			if pr.Head.Ref != branchName {
+				continue
+			}
+			if pr.State == "open" {
+				return &pulls[i], nil
+			}
+			if found == nil {
+				found = &pulls[i]
+			}
+		}
+
+		if len(pulls) < giteaPageSize {
+			break
+		}
+	}
+
+	if found == nil {
+		return nil, &NoPRFoundError{Path: workingDir, BranchName: branchName}
+	}
+	return found, nil
+}
+
+func (r *Gitea) ClosePullRequest(_ io.Writer, workingDir string, fullRepoName string, branchName string) error {
+	pr, err := r.findPullRequest(workingDir, fullRepoName, branchName)
+	if err != nil {
+		return err
+	}
+
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPatch, fmt.Sprintf("%s/pulls/%d", giteaRepoPath(owner, name), pr.Number), map[string]interface{}{
+		"state": "closed",
+	}, nil)
+}
+
+func (r *Gitea) ReopenPullRequest(_ io.Writer, fullRepoName string, number int) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPatch, fmt.Sprintf("%s/pulls/%d", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"state": "open",
+	}, nil)
+}
+
+func (r *Gitea) MergePullRequest(_ io.Writer, fullRepoName string, number int, strategy string, deleteBranch bool) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/pulls/%d/merge", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"Do":                        strategy,
+		"delete_branch_after_merge": deleteBranch,
+	}, nil)
+}
+
+// EnableAutoMerge schedules a PR to be merged once its commit statuses succeed
+func (r *Gitea) EnableAutoMerge(_ io.Writer, fullRepoName string, number int, strategy string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/pulls/%d/merge", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"Do":                        strategy,
+		"merge_when_checks_succeed": true,
+	}, nil)
+}
+
+func (r *Gitea) DisableAutoMerge(_ io.Writer, fullRepoName string, number int) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodDelete, fmt.Sprintf("%s/pulls/%d/merge", giteaRepoPath(owner, name), number), nil, nil)
+}
+
+func (r *Gitea) UpdatePRDescription(output io.Writer, workingDir string, pr PullRequest) error {
+	branchName, err := currentBranch(output, workingDir)
+	if err != nil {
+		return err
+	}
+	existing, err := r.findPullRequest(workingDir, pr.UpstreamRepo, branchName)
+	if err != nil {
+		return err
+	}
+
+	// Gitea marks PRs as drafts by the prefix of their title, so keep it while they are still drafts
+	title := pr.Title
+	if strings.HasPrefix(existing.Title, giteaDraftPrefix) && !strings.HasPrefix(title, giteaDraftPrefix) {
+		title = giteaDraftPrefix + title
+	}
+
+	owner, name := splitRepoName(pr.UpstreamRepo)
+	request := map[string]interface{}{
+		"title": title,
+		"body":  pr.Body,
+	}
+	if pr.Base != "" {
+		request["base"] = pr.Base
+	}
+	if len(pr.Assignees) > 0 {
+		// assignees given when editing a PR replace the existing ones
+		assignees := []string{}
+		known := map[string]bool{}
+		for _, user := range existing.Assignees {
+			assignees = append(assignees, user.Login)
+			known[user.Login] = true
+		}
+		for _, assignee := range pr.Assignees {
+			if !known[assignee] {
+				assignees = append(assignees, assignee)
+			}
+		}
+		request["assignees"] = assignees
+	}
+	if pr.Milestone != "" {
+		id, err := r.milestoneId(owner, name, pr.Milestone)
+		if err != nil {
+			return err
+		}
+		request["milestone"] = id
+	}
+	if err := r.client.do(http.MethodPatch, fmt.Sprintf("%s/pulls/%d", giteaRepoPath(owner, name), existing.Number), request, nil); err != nil {
+		return err
+	}
+
+	if len(pr.Labels) > 0 {
+		ids, err := r.labelIds(owner, name, pr.Labels)
+		if err != nil {
+			return err
+		}
+		if err := r.client.do(http.MethodPost, fmt.Sprintf("%s/issues/%d/labels", giteaRepoPath(owner, name), existing.Number), map[string]interface{}{"labels": ids}, nil); err != nil {
+			return err
+		}
+	}
+	return r.requestReviews(owner, name, existing.Number, pr)
+}
+
+func (r *Gitea) GetPR(_ io.Writer, workingDir string, fullRepoName string, branchName string) (*PrStatus, error) {
+	pr, err := r.findPullRequest(workingDir, fullRepoName, branchName)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &PrStatus{
+		Closed:            pr.State == "closed",
+		HeadRefName:       pr.Head.Ref,
+		IsDraft:           strings.HasPrefix(pr.Title, giteaDraftPrefix),
+		Mergeable:         "UNKNOWN",
+		Number:            pr.Number,
+		ReactionGroups:    []ReactionGroup{},
+		ReviewDecision:    "REVIEW_REQUIRED",
+		StatusCheckRollup: []StatusCheckRollup{},
+		Title:             pr.Title,
+		Url:               pr.HtmlUrl,
+		CreatedAt:         pr.CreatedAt,
+		MergedAt:          pr.MergedAt,
+		ClosedAt:          pr.ClosedAt,
+	}
+	switch {
+	case pr.Merged:
+		status.State = "MERGED"
+	case pr.State == "closed":
+		status.State = "CLOSED"
+	default:
+		status.State = "OPEN"
+		if pr.Mergeable {
+			status.Mergeable = "MERGEABLE"
+		} else {
+			status.Mergeable = "CONFLICTING"
+		}
+	}
+
+	owner, name := splitRepoName(fullRepoName)
+	var reviews []struct {
+		State       string    `json:"state"`
+		User        giteaUser `json:"user"`
+		Dismissed   bool      `json:"dismissed"`
+		SubmittedAt time.Time `json:"submitted_at"`
+	}
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/pulls/%d/reviews", giteaRepoPath(owner, name), pr.Number), nil, &reviews); err != nil {
+		return nil, err
+	}
+	// reviews are listed oldest first, and only the latest decision of each reviewer counts
+	decisions := map[string]string{}
+	for _, review := range reviews {
+		if review.State != "PENDING" && review.State != "REQUEST_REVIEW" {
+			status.Reviews = append(status.Reviews, Review{State: review.State, SubmittedAt: review.SubmittedAt})
+		}
+		if !review.Dismissed && (review.State == "APPROVED" || review.State == "REQUEST_CHANGES") {
+			decisions[review.User.Login] = review.State
+		}
+	}
+	for _, decision := range decisions {
+		if decision == "REQUEST_CHANGES" {
+			status.ReviewDecision = "CHANGES_REQUESTED"
+			break
+		}
+		status.ReviewDecision = "APPROVED"
+	}
+
+	if pr.Head.Sha != "" {
+		var combined struct {
+			Statuses []struct {
+				Status    string `json:"status"`
+				Context   string `json:"context"`
+				TargetUrl string `json:"target_url"`
+			} `json:"statuses"`
+		}
+		if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/commits/%s/status", giteaRepoPath(owner, name), pr.Head.Sha), nil, &combined); err != nil {
+			return nil, err
+		}
+		for _, commitStatus := range combined.Statuses {
+			status.StatusCheckRollup = append(status.StatusCheckRollup, StatusCheckRollup{
+				State: giteaStatusState(commitStatus.Status),
+				Name:  commitStatus.Context,
+				Url:   commitStatus.TargetUrl,
+			})
+		}
+	}
+
+	return status, nil
+}
+
+// giteaStatusState translates the state of a Gitea commit status into the equivalent GitHub check state
+func giteaStatusState(state string) string {
+	switch state {
+	case "success":
+		return "SUCCESS"
+	case "failure", "error":
+		return "FAILURE"
+	default:
+		return "PENDING"
+	}
+}
+
+func (r *Gitea) GetDefaultBranchName(_ io.Writer, _ string, fullRepoName string) (string, error) {
+	repo, err := r.getRepo(splitRepoName(fullRepoName))
+	if err != nil {
+		return "", err
+	}
+	return repo.DefaultBranch, nil
+}
+
+func (r *Gitea) IsPushable(_ io.Writer, repo string) (bool, error) {
+	details, err := r.getRepo(splitRepoName(repo))
+	if err != nil {
+		return false, err
+	}
+	return details.Permissions.Push, nil
+}
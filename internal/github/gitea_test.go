@@ -0,0 +1,236 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/config"
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItCreatesAPullRequestFromAForkOnGitea(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/org/repo1":
+			_, _ = fmt.Fprint(w, `{"full_name": "org/repo1", "default_branch": "main"}`)
+		case "GET /api/v1/repos/org/repo1/compare/main...me:turbolift-campaign":
+			_, _ = fmt.Fprint(w, `{"total_commits": 1}`)
+		case "GET /api/v1/repos/org/repo1/labels":
+			_, _ = fmt.Fprint(w, `[{"id": 3, "name": "dependencies"}, {"id": 4, "name": "bug"}]`)
+		case "POST /api/v1/repos/org/repo1/pulls":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprint(w, `{"number": 7, "html_url": "https://gitea.example.com/org/repo1/pulls/7"}`)
+		case "POST /api/v1/repos/org/repo1/pulls/7/requested_reviewers":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprint(w, `[]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	didCreate, prUrl, err := NewGitea(server.URL, "some-token").CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:         "some title",
+		Body:          "some body",
+		UpstreamRepo:  "gitea.example.com/org/repo1",
+		IsDraft:       true,
+		Labels:        []string{"dependencies"},
+		Reviewers:     []string{"octocat"},
+		TeamReviewers: []string{"platform"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, didCreate)
+	assert.Equal(t, "https://gitea.example.com/org/repo1/pulls/7", prUrl)
+
+	created := (*requests)[len(*requests)-2]
+	assert.Equal(t, "/api/v1/repos/org/repo1/pulls", created.path)
+	assert.Equal(t, map[string]interface{}{
+		"title":  "WIP: some title",
+		"body":   "some body",
+		"head":   "me:turbolift-campaign",
+		"base":   "main",
+		"labels": []interface{}{float64(3)},
+	}, created.body)
+
+	reviewers := (*requests)[len(*requests)-1]
+	assert.Equal(t, map[string]interface{}{
+		"reviewers":      []interface{}{"octocat"},
+		"team_reviewers": []interface{}{"platform"},
+	}, reviewers.body)
+}
+
+func TestItDoesNotCreateAnEmptyPullRequestOnGitea(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.Contains(r.URL.Path, "/compare/"):
+			_, _ = fmt.Fprint(w, `{"total_commits": 0}`)
+		default:
+			_, _ = fmt.Fprint(w, `{"default_branch": "main"}`)
+		}
+	})
+
+	didCreate, _, err := NewGitea(server.URL, "some-token").CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "some title",
+		UpstreamRepo: "org/repo1",
+	})
+	assert.NoError(t, err)
+	assert.False(t, didCreate)
+	for _, request := range *requests {
+		assert.NotEqual(t, "POST", request.method)
+	}
+}
+
+func TestItGetsPullRequestStatusFromGitea(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/repos/org/repo1/pulls":
+			assert.Equal(t, "all", r.URL.Query().Get("state"))
+			_, _ = fmt.Fprint(w, `[
+				{"number": 4, "state": "open", "head": {"ref": "other-branch"}},
+				{"number": 3, "state": "closed", "head": {"ref": "turbolift-campaign"}},
+				{"number": 2, "state": "open", "title": "some title", "mergeable": true, "html_url": "https://gitea.example.com/org/repo1/pulls/2",
+					"created_at": "2024-03-01T09:00:00Z", "merged_at": null,
+					"head": {"ref": "turbolift-campaign", "sha": "abc123"}}]`)
+		case "/api/v1/repos/org/repo1/pulls/2/reviews":
+			_, _ = fmt.Fprint(w, `[{"state": "REQUEST_CHANGES", "user": {"login": "a"}, "submitted_at": "2024-03-02T10:00:00Z"},
+				{"state": "APPROVED", "user": {"login": "a"}, "submitted_at": "2024-03-03T10:00:00Z"},
+				{"state": "COMMENT", "user": {"login": "b"}, "submitted_at": "2024-03-04T10:00:00Z"}]`)
+		case "/api/v1/repos/org/repo1/commits/abc123/status":
+			_, _ = fmt.Fprint(w, `{"state": "failure", "statuses": [{"status": "success", "context": "build"}, {"status": "failure", "context": "test", "target_url": "https://ci.example.com/3"}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	pr, err := NewGitea(server.URL, "some-token").GetPR(&strings.Builder{}, "work/org/repo1", "org/repo1", "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, &PrStatus{
+		HeadRefName:       "turbolift-campaign",
+		Mergeable:         "MERGEABLE",
+		Number:            2,
+		ReactionGroups:    []ReactionGroup{},
+		ReviewDecision:    "APPROVED",
+		State:             "OPEN",
+		StatusCheckRollup: []StatusCheckRollup{{State: "SUCCESS", Name: "build"}, {State: "FAILURE", Name: "test", Url: "https://ci.example.com/3"}},
+		Title:             "some title",
+		Url:               "https://gitea.example.com/org/repo1/pulls/2",
+		CreatedAt:         time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		Reviews: []Review{
+			{State: "REQUEST_CHANGES", SubmittedAt: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)},
+			{State: "APPROVED", SubmittedAt: time.Date(2024, 3, 3, 10, 0, 0, 0, time.UTC)},
+			{State: "COMMENT", SubmittedAt: time.Date(2024, 3, 4, 10, 0, 0, 0, time.UTC)},
+		},
+	}, pr)
+}
+
+func TestItReturnsNoPRFoundErrorWhenGiteaHasNoPullRequest(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `[]`)
+	})
+
+	err := NewGitea(server.URL, "some-token").ClosePullRequest(&strings.Builder{}, "work/org/repo1", "org/repo1", "turbolift-campaign")
+	var noPrErr *NoPRFoundError
+	assert.True(t, errors.As(err, &noPrErr))
+}
+
+func TestItKeepsGiteaDraftsAndAssigneesWhenUpdatingTheDescription(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /api/v1/repos/org/repo1/pulls":
+			_, _ = fmt.Fprint(w, `[{"number": 2, "state": "open", "title": "WIP: old title", "head": {"ref": "turbolift-campaign"},
+				"assignees": [{"login": "a"}]}]`)
+		default:
+			_, _ = fmt.Fprint(w, `{}`)
+		}
+	})
+
+	err := NewGitea(server.URL, "some-token").UpdatePRDescription(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "new title",
+		Body:         "new body",
+		UpstreamRepo: "org/repo1",
+		Assignees:    []string{"b"},
+	})
+	assert.NoError(t, err)
+
+	updated := (*requests)[len(*requests)-1]
+	assert.Equal(t, "PATCH", updated.method)
+	assert.Equal(t, "/api/v1/repos/org/repo1/pulls/2", updated.path)
+	assert.Equal(t, map[string]interface{}{
+		"title":     "WIP: new title",
+		"body":      "new body",
+		"assignees": []interface{}{"a", "b"},
+	}, updated.body)
+}
+
+func TestItChecksPushPermissionOnGitea(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v1/repos/org/writable":
+			_, _ = fmt.Fprint(w, `{"permissions": {"pull": true, "push": true}}`)
+		default:
+			_, _ = fmt.Fprint(w, `{"permissions": {"pull": true, "push": false}}`)
+		}
+	})
+	gitea := NewGitea(server.URL, "some-token")
+
+	pushable, err := gitea.IsPushable(&strings.Builder{}, "org/writable")
+	assert.NoError(t, err)
+	assert.True(t, pushable)
+
+	pushable, err = gitea.IsPushable(&strings.Builder{}, "org/readonly")
+	assert.NoError(t, err)
+	assert.False(t, pushable)
+}
+
+func TestItRoutesPrsToGiteaByTheHostOfTheirRepo(t *testing.T) {
+	t.Setenv("GITEA_TOKEN", "some-token")
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `[{"number": 2, "state": "closed", "merged": true, "head": {"ref": "turbolift-campaign"}}]`)
+	})
+	// the working copy is pushed to a host with no configuration of its own
+	execInstance = executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		if strings.Join(args, " ") == "rev-parse --abbrev-ref HEAD" {
+			return "turbolift-campaign\n", nil
+		}
+		return "git@ssh.gitea.example.com:me/repo1.git\n", nil
+	})
+
+	router := NewForgeRouter(&config.Config{Forges: map[string]config.Forge{
+		"gitea.example.com": {Type: ForgeTypeGitea, Url: server.URL},
+	}})
+
+	pr, err := router.GetPR(&strings.Builder{}, "work/org/repo1", "gitea.example.com/org/repo1", "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, "MERGED", pr.State)
+
+	err = router.UpdatePRDescription(&strings.Builder{}, "work/org/repo1", PullRequest{Title: "new title", UpstreamRepo: "gitea.example.com/org/repo1"})
+	assert.NoError(t, err)
+	for _, request := range *requests {
+		assert.True(t, strings.HasPrefix(request.path, "/api/v1/repos/org/repo1/"), request.path)
+	}
+}
@@ -20,7 +20,9 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/skyscanner/turbolift/internal/executor"
 )
@@ -33,22 +35,77 @@ type PullRequest struct {
 	UpstreamRepo   string
 	IsDraft        bool
 	ReviewDecision string
+	Labels         []string
+	Reviewers      []string
+	TeamReviewers  []string
+	Assignees      []string
+	Milestone      string
+	Base           string
+}
+
+// AllReviewers lists the users and teams asked to review a PR, with teams named as org/team
+func (pr PullRequest) AllReviewers() []string {
+	reviewers := append([]string{}, pr.Reviewers...)
+	for _, team := range pr.TeamReviewers {
+		reviewers = append(reviewers, qualifiedTeamName(pr.UpstreamRepo, team))
+	}
+	return reviewers
 }
 
 type GitHub interface {
 	ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error
 	Clone(output io.Writer, workingDir string, fullRepoName string) error
-	CreatePullRequest(output io.Writer, workingDir string, metadata PullRequest) (didCreate bool, err error)
-	ClosePullRequest(output io.Writer, workingDir string, branchName string) error
-	UpdatePRDescription(output io.Writer, workingDir string, title string, body string) error
-	GetPR(output io.Writer, workingDir string, branchName string) (*PrStatus, error)
+	CreatePullRequest(output io.Writer, workingDir string, metadata PullRequest) (didCreate bool, prUrl string, err error)
+	ClosePullRequest(output io.Writer, workingDir string, fullRepoName string, branchName string) error
+	// MergePullRequest merges a repo's PR with the given strategy, and deletes the branch it was raised from if asked
+	MergePullRequest(output io.Writer, fullRepoName string, number int, strategy string, deleteBranch bool) error
+	// ReopenPullRequest reopens a repo's PR that was closed without being merged
+	ReopenPullRequest(output io.Writer, fullRepoName string, number int) error
+	// EnableAutoMerge has a repo's PR merged with the given strategy once its requirements are met. It returns an
+	// AutoMergeNotAllowedError if the repo does not allow auto-merge.
+	EnableAutoMerge(output io.Writer, fullRepoName string, number int, strategy string) error
+	DisableAutoMerge(output io.Writer, fullRepoName string, number int) error
+	// MarkPRReady takes a repo's PR out of draft so that it can be reviewed and merged
+	MarkPRReady(output io.Writer, fullRepoName string, number int) error
+	ConvertPRToDraft(output io.Writer, fullRepoName string, number int) error
+	UpdatePRDescription(output io.Writer, workingDir string, pr PullRequest) error
+	GetPR(output io.Writer, workingDir string, fullRepoName string, branchName string) (*PrStatus, error)
+	CommentOnPR(output io.Writer, fullRepoName string, number int, body string) error
+	AddLabels(output io.Writer, fullRepoName string, number int, labels []string) error
+	RemoveLabels(output io.Writer, fullRepoName string, number int, labels []string) error
+	// AddReviewers requests reviews of a PR. Reviewers named as org/team are teams.
+	AddReviewers(output io.Writer, fullRepoName string, number int, reviewers []string) error
+	RemoveReviewers(output io.Writer, fullRepoName string, number int, reviewers []string) error
+	AddAssignees(output io.Writer, fullRepoName string, number int, assignees []string) error
+	RemoveAssignees(output io.Writer, fullRepoName string, number int, assignees []string) error
+	// GetPRs looks up the PRs raised from a branch in a number of repos at once, without needing working copies. The
+	// results are keyed by repo name as given, and repos without a PR are left out. Repos whose PRs could not be looked
+	// up are given with their errors.
+	GetPRs(output io.Writer, fullRepoNames []string, branchName string) (map[string]*PrStatus, map[string]error, error)
 	GetDefaultBranchName(output io.Writer, workingDir string, fullRepoName string) (string, error)
 	IsPushable(output io.Writer, repo string) (bool, error)
+	CreateIssue(output io.Writer, fullRepoName string, title string, body string) (*Issue, error)
+	GetIssue(output io.Writer, fullRepoName string, number int) (*Issue, error)
+	UpdateIssueBody(output io.Writer, fullRepoName string, number int, body string) error
+}
+
+// Strategies for merging PRs
+const (
+	MergeStrategyMerge  = "merge"
+	MergeStrategySquash = "squash"
+	MergeStrategyRebase = "rebase"
+)
+
+// MergeStrategies are the strategies that PRs can be merged with
+var MergeStrategies = map[string]bool{
+	MergeStrategyMerge:  true,
+	MergeStrategySquash: true,
+	MergeStrategyRebase: true,
 }
 
 type RealGitHub struct{}
 
-func (r *RealGitHub) CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (didCreate bool, err error) {
+func (r *RealGitHub) CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (didCreate bool, prUrl string, err error) {
 	gh_args := []string{
 		"pr",
 		"create",
@@ -63,15 +120,16 @@ func (r *RealGitHub) CreatePullRequest(output io.Writer, workingDir string, pr P
 	if pr.IsDraft {
 		gh_args = append(gh_args, "--draft")
 	}
+	gh_args = append(gh_args, prOptionArgs(pr, "--label", "--reviewer", "--assignee")...)
 
 	execOutput, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", gh_args...)
 	if strings.Contains(execOutput, "GraphQL error: No commits between") {
 		// no PR was created because there are no differences between remotes
-		return false, nil
+		return false, "", nil
 	} else if err != nil {
-		return false, err
+		return false, "", err
 	}
-	return true, nil
+	return true, lastLine(execOutput), nil
 }
 
 func (r *RealGitHub) ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error {
@@ -82,17 +140,84 @@ func (r *RealGitHub) Clone(output io.Writer, workingDir string, fullRepoName str
 	return execInstance.Execute(output, workingDir, "gh", "repo", "clone", fullRepoName)
 }
 
-func (r *RealGitHub) ClosePullRequest(output io.Writer, workingDir string, branchName string) error {
-	pr, err := r.GetPR(output, workingDir, branchName)
+func (r *RealGitHub) ClosePullRequest(output io.Writer, workingDir string, fullRepoName string, branchName string) error {
+	pr, err := r.GetPR(output, workingDir, fullRepoName, branchName)
 	if err != nil {
 		return err
 	}
 
-	return execInstance.Execute(output, workingDir, "gh", "pr", "close", fmt.Sprint(pr.Number))
+	return execInstance.Execute(output, workingDir, "gh", "pr", "close", fmt.Sprint(pr.Number), "--repo", fullRepoName)
 }
 
-func (r *RealGitHub) UpdatePRDescription(output io.Writer, workingDir string, title string, body string) error {
-	return execInstance.Execute(output, workingDir, "gh", "pr", "edit", "--title", title, "--body", body)
+func (r *RealGitHub) MergePullRequest(output io.Writer, fullRepoName string, number int, strategy string, deleteBranch bool) error {
+	// the command can be run from any directory, as the repo is given
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	gh_args := []string{"pr", "merge", fmt.Sprint(number), "--repo", fullRepoName, "--" + strategy}
+	if deleteBranch {
+		gh_args = append(gh_args, "--delete-branch")
+	}
+	return execInstance.Execute(output, currentDir, "gh", gh_args...)
+}
+
+func (r *RealGitHub) ReopenPullRequest(output io.Writer, fullRepoName string, number int) error {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return execInstance.Execute(output, currentDir, "gh", "pr", "reopen", fmt.Sprint(number), "--repo", fullRepoName)
+}
+
+func (r *RealGitHub) EnableAutoMerge(output io.Writer, fullRepoName string, number int, strategy string) error {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	execOutput, err := execInstance.ExecuteAndCapture(output, currentDir, "gh", "pr", "merge", fmt.Sprint(number), "--repo", fullRepoName, "--auto", "--"+strategy)
+	if strings.Contains(execOutput, "Auto merge is not allowed") {
+		return &AutoMergeNotAllowedError{Repo: fullRepoName, Reason: "it is not enabled in the repository settings"}
+	}
+	return err
+}
+
+func (r *RealGitHub) DisableAutoMerge(output io.Writer, fullRepoName string, number int) error {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return execInstance.Execute(output, currentDir, "gh", "pr", "merge", fmt.Sprint(number), "--repo", fullRepoName, "--disable-auto")
+}
+
+// UpdatePRDescription sets the title and body of the PR, and adds any labels, reviewers and assignees that it does not
+// already have. Labels, reviewers and assignees that are not listed are left in place, to be removed with
+// RemoveLabels, RemoveReviewers and RemoveAssignees.
+func (r *RealGitHub) UpdatePRDescription(output io.Writer, workingDir string, pr PullRequest) error {
+	gh_args := []string{"pr", "edit", "--title", pr.Title, "--body", pr.Body}
+	gh_args = append(gh_args, prOptionArgs(pr, "--add-label", "--add-reviewer", "--add-assignee")...)
+	return execInstance.Execute(output, workingDir, "gh", gh_args...)
+}
+
+// prOptionArgs builds the arguments of `gh pr create` or `gh pr edit` that apply the optional settings of a PR
+func prOptionArgs(pr PullRequest, labelFlag string, reviewerFlag string, assigneeFlag string) []string {
+	var args []string
+	for _, label := range pr.Labels {
+		args = append(args, labelFlag, label)
+	}
+	for _, reviewer := range pr.AllReviewers() {
+		args = append(args, reviewerFlag, reviewer)
+	}
+	for _, assignee := range pr.Assignees {
+		args = append(args, assigneeFlag, assignee)
+	}
+	if pr.Milestone != "" {
+		args = append(args, "--milestone", pr.Milestone)
+	}
+	if pr.Base != "" {
+		args = append(args, "--base", pr.Base)
+	}
+	return args
 }
 
 func (r *RealGitHub) GetDefaultBranchName(output io.Writer, workingDir string, fullRepoName string) (string, error) {
@@ -112,6 +237,7 @@ type PrStatusResponse struct { // https://github.com/cli/cli/blob/4b415f80d79e57
 type PrStatus struct {
 	Closed            bool                `json:"closed"`
 	HeadRefName       string              `json:"headRefName"`
+	IsDraft           bool                `json:"isDraft"`
 	Mergeable         string              `json:"mergeable"`
 	Number            int                 `json:"number"`
 	ReactionGroups    []ReactionGroup     `json:"reactionGroups"`
@@ -120,6 +246,28 @@ type PrStatus struct {
 	StatusCheckRollup []StatusCheckRollup `json:"statusCheckRollup"`
 	Title             string              `json:"title"`
 	Url               string              `json:"url"`
+	// CreatedAt, MergedAt and ClosedAt are zero when unknown, or when the PR has not been merged or closed
+	CreatedAt time.Time `json:"createdAt"`
+	MergedAt  time.Time `json:"mergedAt"`
+	ClosedAt  time.Time `json:"closedAt"`
+	// Reviews holds at least the first review of the PR, where the forge reports when reviews were submitted
+	Reviews []Review `json:"reviews"`
+}
+
+type Review struct {
+	State       string    `json:"state"`
+	SubmittedAt time.Time `json:"submittedAt"`
+}
+
+// FirstReviewedAt is when the PR was first reviewed, or zero if it has not been reviewed or the time is unknown
+func (p *PrStatus) FirstReviewedAt() time.Time {
+	var first time.Time
+	for _, review := range p.Reviews {
+		if !review.SubmittedAt.IsZero() && (first.IsZero() || review.SubmittedAt.Before(first)) {
+			first = review.SubmittedAt
+		}
+	}
+	return first
 }
 
 type ReactionGroupUsers struct {
@@ -131,8 +279,85 @@ type ReactionGroup struct {
 	Users   ReactionGroupUsers
 }
 
+// ReactionsOrder is the order in which the contents of reaction groups are shown
+var ReactionsOrder = []string{
+	"THUMBS_UP",
+	"THUMBS_DOWN",
+	"LAUGH",
+	"HOORAY",
+	"CONFUSED",
+	"HEART",
+	"ROCKET",
+	"EYES",
+}
+
+// ReactionEmoji maps the contents of reaction groups to the emoji that they stand for
+var ReactionEmoji = map[string]string{
+	"THUMBS_UP":   "👍",
+	"THUMBS_DOWN": "👎",
+	"LAUGH":       "😆",
+	"HOORAY":      "🎉",
+	"CONFUSED":    "😕",
+	"HEART":       "❤️",
+	"ROCKET":      "🚀",
+	"EYES":        "👀",
+}
+
+// StatusCheckRollup is a check of a PR's latest commit. State is SUCCESS, FAILURE or PENDING, or another conclusion
+// such as SKIPPED.
 type StatusCheckRollup struct {
 	State string
+	Name  string
+	Url   string
+}
+
+// passingCheckStates are the states of checks that count as having passed. Any other state of a finished check, such
+// as TIMED_OUT or CANCELLED, counts as having failed.
+var passingCheckStates = map[string]bool{
+	"SUCCESS": true,
+	"NEUTRAL": true,
+	"SKIPPED": true,
+}
+
+// Passed is whether the check has finished without standing in the way of merging the PR
+func (s StatusCheckRollup) Passed() bool {
+	return passingCheckStates[s.State]
+}
+
+// Pending is whether the check is yet to finish
+func (s StatusCheckRollup) Pending() bool {
+	return s.State == "PENDING" || s.State == "EXPECTED" || s.State == ""
+}
+
+// UnmarshalJSON reads a check as reported by gh, which gives check runs and commit statuses in different shapes
+func (s *StatusCheckRollup) UnmarshalJSON(data []byte) error {
+	var check struct {
+		TypeName   string `json:"__typename"`
+		Name       string `json:"name"`
+		Context    string `json:"context"`
+		State      string `json:"state"`
+		Status     string `json:"status"`
+		Conclusion string `json:"conclusion"`
+		DetailsUrl string `json:"detailsUrl"`
+		TargetUrl  string `json:"targetUrl"`
+		Url        string `json:"url"`
+	}
+	if err := json.Unmarshal(data, &check); err != nil {
+		return err
+	}
+
+	*s = StatusCheckRollup{State: check.State, Name: check.Name, Url: check.Url}
+	if check.TypeName == "CheckRun" {
+		s.State = check.Conclusion
+		if check.Status != "COMPLETED" {
+			s.State = "PENDING"
+		}
+		s.Url = check.DetailsUrl
+	} else if check.TypeName == "StatusContext" {
+		s.Name = check.Context
+		s.Url = check.TargetUrl
+	}
+	return nil
 }
 
 // GetPR is a helper function to retrieve the PR associated with the branch Name
@@ -145,8 +370,29 @@ func (e *NoPRFoundError) Error() string {
 	return fmt.Sprintf("no PR found for %s and branch %s", e.Path, e.BranchName)
 }
 
-func (r *RealGitHub) GetPR(output io.Writer, workingDir string, branchName string) (*PrStatus, error) {
-	s, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "pr", "status", "--json", "closed,headRefName,mergeable,number,reactionGroups,reviewDecision,state,statusCheckRollup,title,url")
+// AutoMergeNotAllowedError is returned when auto-merge cannot be enabled because a repo does not allow it
+type AutoMergeNotAllowedError struct {
+	Repo   string
+	Reason string
+}
+
+func (e *AutoMergeNotAllowedError) Error() string {
+	return fmt.Sprintf("auto-merge is not allowed for %s: %s", e.Repo, e.Reason)
+}
+
+// PrNumberFromUrl finds the number of a PR from its URL, which is the last number in the path on every forge
+func PrNumberFromUrl(prUrl string) (int, bool) {
+	parts := strings.Split(strings.TrimSuffix(prUrl, "/"), "/")
+	for i := len(parts) - 1; i >= 0; i-- {
+		if number, err := strconv.Atoi(parts[i]); err == nil {
+			return number, true
+		}
+	}
+	return 0, false
+}
+
+func (r *RealGitHub) GetPR(output io.Writer, workingDir string, fullRepoName string, branchName string) (*PrStatus, error) {
+	s, err := execInstance.ExecuteAndCapture(output, workingDir, "gh", "pr", "status", "--repo", fullRepoName, "--json", "closed,closedAt,createdAt,headRefName,isDraft,mergeable,mergedAt,number,reactionGroups,reviewDecision,reviews,state,statusCheckRollup,title,url")
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,541 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const DefaultGitHubApiUrl = "https://api.github.com"
+
+// GitHubAPI implements GitHub using the REST and GraphQL APIs directly, rather than the gh CLI
+type GitHubAPI struct {
+	client     *apiClient
+	graphqlUrl string
+}
+
+// NewGitHubAPI creates a client for the GitHub API at baseUrl, e.g. https://api.github.com or
+// https://github.example.com/api/v3 for GitHub Enterprise Server.
+func NewGitHubAPI(baseUrl string, token string) *GitHubAPI {
+	if baseUrl == "" {
+		baseUrl = DefaultGitHubApiUrl
+	}
+	baseUrl = strings.TrimSuffix(baseUrl, "/")
+
+	graphqlUrl := baseUrl + "/graphql"
+	if strings.HasSuffix(baseUrl, "/api/v3") {
+		graphqlUrl = strings.TrimSuffix(baseUrl, "/v3") + "/graphql"
+	}
+
+	return &GitHubAPI{
+		client: newApiClient(baseUrl, token, map[string]string{
+			"Accept":               "application/vnd.github+json",
+			"X-GitHub-Api-Version": "2022-11-28",
+		}),
+		graphqlUrl: graphqlUrl,
+	}
+}
+
+type gitHubRepo struct {
+	FullName      string `json:"full_name"`
+	CloneUrl      string `json:"clone_url"`
+	DefaultBranch string `json:"default_branch"`
+	Permissions   struct {
+		Push bool `json:"push"`
+	} `json:"permissions"`
+}
+
+type gitHubPull struct {
+	Number  int    `json:"number"`
+	HtmlUrl string `json:"html_url"`
+}
+
+func (r *GitHubAPI) getRepo(fullRepoName string) (*gitHubRepo, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var repo gitHubRepo
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("/repos/%s/%s", owner, name), nil, &repo); err != nil {
+		return nil, err
+	}
+	return &repo, nil
+}
+
+func (r *GitHubAPI) ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error {
+	upstream, err := r.getRepo(fullRepoName)
+	if err != nil {
+		return err
+	}
+
+	owner, name := splitRepoName(fullRepoName)
+	var fork gitHubRepo
+	if err := r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/forks", owner, name), nil, &fork); err != nil {
+		return err
+	}
+
+	// forks are created asynchronously, so wait until the new fork can be found
+	for attempt := 1; ; attempt++ {
+		_, err := r.getRepo(fork.FullName)
+		var apiErr *APIError
+		if err == nil {
+			break
+		} else if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || attempt == 10 {
+			return err
+		}
+		sleep(time.Duration(attempt) * time.Second)
+	}
+
+	return cloneRepo(output, workingDir, fork.CloneUrl, name, upstream.CloneUrl)
+}
+
+func (r *GitHubAPI) Clone(output io.Writer, workingDir string, fullRepoName string) error {
+	repo, err := r.getRepo(fullRepoName)
+	if err != nil {
+		return err
+	}
+	_, name := splitRepoName(fullRepoName)
+	return cloneRepo(output, workingDir, repo.CloneUrl, name, "")
+}
+
+func (r *GitHubAPI) CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (didCreate bool, prUrl string, err error) {
+	owner, name := splitRepoName(pr.UpstreamRepo)
+
+	head, err := currentBranch(output, workingDir)
+	if err != nil {
+		return false, "", err
+	}
+	headOwner, err := originOwner(output, workingDir)
+	if err != nil {
+		return false, "", err
+	}
+	if headOwner != owner {
+		head = headOwner + ":" + head
+	}
+
+	base := pr.Base
+	if base == "" {
+		repo, err := r.getRepo(pr.UpstreamRepo)
+		if err != nil {
+			return false, "", err
+		}
+		base = repo.DefaultBranch
+	}
+
+	var created gitHubPull
+	err = r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/pulls", owner, name), map[string]interface{}{
+		"title": pr.Title,
+		"body":  pr.Body,
+		"head":  head,
+		"base":  base,
+		"draft": pr.IsDraft,
+	}, &created)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnprocessableEntity && strings.Contains(apiErr.Message, "No commits between") {
+		// no PR was created because there are no differences between the branches
+		return false, "", nil
+	} else if err != nil {
+		return false, "", err
+	}
+
+	if err := r.applyPrOptions(owner, name, created.Number, pr); err != nil {
+		return true, created.HtmlUrl, err
+	}
+
+	_, _ = fmt.Fprintln(output, created.HtmlUrl)
+	return true, created.HtmlUrl, nil
+}
+
+// applyPrOptions adds the labels, reviewers and assignees of pr to an existing PR, and sets its milestone
+func (r *GitHubAPI) applyPrOptions(owner string, name string, number int, pr PullRequest) error {
+	if len(pr.Labels) > 0 {
+		if err := r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues/%d/labels", owner, name, number), map[string]interface{}{
+			"labels": pr.Labels,
+		}, nil); err != nil {
+			return err
+		}
+	}
+
+	if len(pr.Reviewers) > 0 || len(pr.TeamReviewers) > 0 {
+		teams := []string{}
+		for _, team := range pr.TeamReviewers {
+			_, slug := splitRepoName(team)
+			teams = append(teams, slug)
+		}
+		reviewers := pr.Reviewers
+		if reviewers == nil {
+			reviewers = []string{}
+		}
+		if err := r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/pulls/%d/requested_reviewers", owner, name, number), map[string]interface{}{
+			"reviewers":      reviewers,
+			"team_reviewers": teams,
+		}, nil); err != nil {
+			return err
+		}
+	}
+
+	if len(pr.Assignees) > 0 {
+		if err := r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues/%d/assignees", owner, name, number), map[string]interface{}{
+			"assignees": pr.Assignees,
+		}, nil); err != nil {
+			return err
+		}
+	}
+
+	if pr.Milestone != "" {
+		var milestones []struct {
+			Number int    `json:"number"`
+			Title  string `json:"title"`
+		}
+		if err := r.client.do(http.MethodGet, fmt.Sprintf("/repos/%s/%s/milestones?state=open&per_page=100", owner, name), nil, &milestones); err != nil {
+			return err
+		}
+		milestoneNumber := 0
+		for _, milestone := range milestones {
+			if milestone.Title == pr.Milestone {
+				milestoneNumber = milestone.Number
+			}
+		}
+		if milestoneNumber == 0 {
+			return fmt.Errorf("no open milestone named %s in %s/%s", pr.Milestone, owner, name)
+		}
+		if err := r.client.do(http.MethodPatch, fmt.Sprintf("/repos/%s/%s/issues/%d", owner, name, number), map[string]interface{}{
+			"milestone": milestoneNumber,
+		}, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *GitHubAPI) ClosePullRequest(output io.Writer, workingDir string, fullRepoName string, branchName string) error {
+	pr, err := r.GetPR(output, workingDir, fullRepoName, branchName)
+	if err != nil {
+		return err
+	}
+
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPatch, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, pr.Number), map[string]interface{}{
+		"state": "closed",
+	}, nil)
+}
+
+func (r *GitHubAPI) MergePullRequest(_ io.Writer, fullRepoName string, number int, strategy string, deleteBranch bool) error {
+	owner, name := splitRepoName(fullRepoName)
+	pullPath := fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, number)
+
+	var pull struct {
+		Head struct {
+			Ref  string `json:"ref"`
+			Repo struct {
+				FullName string `json:"full_name"`
+			} `json:"repo"`
+		} `json:"head"`
+	}
+	if deleteBranch {
+		// the branch is looked up first, since it may be in a fork
+		if err := r.client.do(http.MethodGet, pullPath, nil, &pull); err != nil {
+			return err
+		}
+	}
+
+	if err := r.client.do(http.MethodPut, pullPath+"/merge", map[string]interface{}{
+		"merge_method": strategy,
+	}, nil); err != nil {
+		return err
+	}
+
+	if !deleteBranch {
+		return nil
+	}
+	return r.client.do(http.MethodDelete, fmt.Sprintf("/repos/%s/git/refs/heads/%s", pull.Head.Repo.FullName, pull.Head.Ref), nil, nil)
+}
+
+func (r *GitHubAPI) ReopenPullRequest(_ io.Writer, fullRepoName string, number int) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPatch, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, number), map[string]interface{}{
+		"state": "open",
+	}, nil)
+}
+
+// pullRequestNodeId looks up the GraphQL id of a PR, which the auto-merge mutations need
+func (r *GitHubAPI) pullRequestNodeId(fullRepoName string, number int) (string, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var pull struct {
+		NodeId string `json:"node_id"`
+	}
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, number), nil, &pull); err != nil {
+		return "", err
+	}
+	return pull.NodeId, nil
+}
+
+func (r *GitHubAPI) EnableAutoMerge(_ io.Writer, fullRepoName string, number int, strategy string) error {
+	id, err := r.pullRequestNodeId(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	err = r.graphql(`mutation($id: ID!, $method: PullRequestMergeMethod!) {
+  enablePullRequestAutoMerge(input: {pullRequestId: $id, mergeMethod: $method}) { clientMutationId }
+}`, map[string]interface{}{"id": id, "method": strings.ToUpper(strategy)}, &struct{}{})
+	if err != nil && strings.Contains(err.Error(), "Auto merge is not allowed") {
+		return &AutoMergeNotAllowedError{Repo: fullRepoName, Reason: "it is not enabled in the repository settings"}
+	}
+	return err
+}
+
+func (r *GitHubAPI) DisableAutoMerge(_ io.Writer, fullRepoName string, number int) error {
+	id, err := r.pullRequestNodeId(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	return r.graphql(`mutation($id: ID!) {
+  disablePullRequestAutoMerge(input: {pullRequestId: $id}) { clientMutationId }
+}`, map[string]interface{}{"id": id}, &struct{}{})
+}
+
+func (r *GitHubAPI) UpdatePRDescription(output io.Writer, workingDir string, pr PullRequest) error {
+	branchName, err := currentBranch(output, workingDir)
+	if err != nil {
+		return err
+	}
+	existing, err := r.GetPR(output, workingDir, pr.UpstreamRepo, branchName)
+	if err != nil {
+		return err
+	}
+
+	owner, name := splitRepoName(pr.UpstreamRepo)
+	update := map[string]interface{}{
+		"title": pr.Title,
+		"body":  pr.Body,
+	}
+	if pr.Base != "" {
+		update["base"] = pr.Base
+	}
+	if err := r.client.do(http.MethodPatch, fmt.Sprintf("/repos/%s/%s/pulls/%d", owner, name, existing.Number), update, nil); err != nil {
+		return err
+	}
+
+	return r.applyPrOptions(owner, name, existing.Number, pr)
+}
+
+const prQuery = `query($owner: String!, $name: String!, $branch: String!) {
+  repository(owner: $owner, name: $name) {
+    pullRequests(headRefName: $branch, first: 10, orderBy: {field: CREATED_AT, direction: DESC}) {
+      nodes {
+        ...prFields
+      }
+    }
+  }
+}
+` + prFieldsFragment
+
+const prFieldsFragment = `fragment prFields on PullRequest {
+  closed
+  headRefName
+  isDraft
+  mergeable
+  number
+  reviewDecision
+  state
+  title
+  url
+  createdAt
+  mergedAt
+  closedAt
+  reviews(first: 1) { nodes { state submittedAt } }
+  reactionGroups { content reactors { totalCount } }
+  commits(last: 1) {
+    nodes {
+      commit {
+        statusCheckRollup {
+          contexts(first: 100) {
+            nodes {
+              __typename
+              ... on CheckRun { name status conclusion detailsUrl }
+              ... on StatusContext { context state targetUrl }
+            }
+          }
+        }
+      }
+    }
+  }
+}`
+
+type graphqlPr struct {
+	Closed         bool      `json:"closed"`
+	HeadRefName    string    `json:"headRefName"`
+	IsDraft        bool      `json:"isDraft"`
+	Mergeable      string    `json:"mergeable"`
+	Number         int       `json:"number"`
+	ReviewDecision string    `json:"reviewDecision"`
+	State          string    `json:"state"`
+	Title          string    `json:"title"`
+	Url            string    `json:"url"`
+	CreatedAt      time.Time `json:"createdAt"`
+	MergedAt       time.Time `json:"mergedAt"`
+	ClosedAt       time.Time `json:"closedAt"`
+	Reviews        struct {
+		Nodes []Review `json:"nodes"`
+	} `json:"reviews"`
+	ReactionGroups []struct {
+		Content  string `json:"content"`
+		Reactors struct {
+			TotalCount int `json:"totalCount"`
+		} `json:"reactors"`
+	} `json:"reactionGroups"`
+	Commits struct {
+		Nodes []struct {
+			Commit struct {
+				StatusCheckRollup *struct {
+					Contexts struct {
+						Nodes []struct {
+							TypeName   string `json:"__typename"`
+							Name       string `json:"name"`
+							Status     string `json:"status"`
+							Conclusion string `json:"conclusion"`
+							Context    string `json:"context"`
+							State      string `json:"state"`
+							DetailsUrl string `json:"detailsUrl"`
+							TargetUrl  string `json:"targetUrl"`
+						} `json:"nodes"`
+					} `json:"contexts"`
+				} `json:"statusCheckRollup"`
+			} `json:"commit"`
+		} `json:"nodes"`
+	} `json:"commits"`
+}
+
+func (p graphqlPr) toPrStatus() *PrStatus {
+	status := &PrStatus{
+		Closed:            p.Closed,
+		HeadRefName:       p.HeadRefName,
+		IsDraft:           p.IsDraft,
+		Mergeable:         p.Mergeable,
+		Number:            p.Number,
+		ReviewDecision:    p.ReviewDecision,
+		State:             p.State,
+		Title:             p.Title,
+		Url:               p.Url,
+		CreatedAt:         p.CreatedAt,
+		MergedAt:          p.MergedAt,
+		ClosedAt:          p.ClosedAt,
+		Reviews:           p.Reviews.Nodes,
+		ReactionGroups:    []ReactionGroup{},
+		StatusCheckRollup: []StatusCheckRollup{},
+	}
+	for _, group := range p.ReactionGroups {
+		status.ReactionGroups = append(status.ReactionGroups, ReactionGroup{
+			Content: group.Content,
+			Users:   ReactionGroupUsers{TotalCount: group.Reactors.TotalCount},
+		})
+	}
+	for _, commit := range p.Commits.Nodes {
+		if commit.Commit.StatusCheckRollup == nil {
+			continue
+		}
+		for _, check := range commit.Commit.StatusCheckRollup.Contexts.Nodes {
+			rollup := StatusCheckRollup{State: check.State, Name: check.Context, Url: check.TargetUrl}
+			if check.TypeName == "CheckRun" {
+				rollup = StatusCheckRollup{State: check.Conclusion, Name: check.Name, Url: check.DetailsUrl}
+				if check.Status != "COMPLETED" {
+					rollup.State = "PENDING"
+				}
+			}
+			status.StatusCheckRollup = append(status.StatusCheckRollup, rollup)
+		}
+	}
+	return status
+}
+
+type graphqlError struct {
+	Message string `json:"message"`
+}
+
+func (r *GitHubAPI) graphql(query string, variables map[string]interface{}, data interface{}) error {
+	response := struct {
+		Data   interface{}    `json:"data"`
+		Errors []graphqlError `json:"errors"`
+	}{Data: data}
+	if err := r.client.do(http.MethodPost, r.graphqlUrl, map[string]interface{}{
+		"query":     query,
+		"variables": variables,
+	}, &response); err != nil {
+		return err
+	}
+	if len(response.Errors) > 0 {
+		var messages []string
+		for _, e := range response.Errors {
+			messages = append(messages, e.Message)
+		}
+		return fmt.Errorf("GraphQL error: %s", strings.Join(messages, "; "))
+	}
+	return nil
+}
+
+func (r *GitHubAPI) GetPR(_ io.Writer, workingDir string, fullRepoName string, branchName string) (*PrStatus, error) {
+	owner, name := splitRepoName(fullRepoName)
+
+	var data struct {
+		Repository struct {
+			PullRequests struct {
+				Nodes []graphqlPr `json:"nodes"`
+			} `json:"pullRequests"`
+		} `json:"repository"`
+	}
+	if err := r.graphql(prQuery, map[string]interface{}{
+		"owner":  owner,
+		"name":   name,
+		"branch": branchName,
+	}, &data); err != nil {
+		return nil, err
+	}
+
+	return latestPr(data.Repository.PullRequests.Nodes, workingDir, branchName)
+}
+
+// latestPr picks the PR to report from those raised from a branch, which are ordered from newest to oldest.
+// An open PR is preferred over any that have since been closed.
+func latestPr(prs []graphqlPr, workingDir string, branchName string) (*PrStatus, error) {
+	if len(prs) == 0 {
+		return nil, &NoPRFoundError{Path: workingDir, BranchName: branchName}
+	}
+	for _, pr := range prs {
+		if pr.State == "OPEN" {
+			return pr.toPrStatus(), nil
+		}
+	}
+	return prs[0].toPrStatus(), nil
+}
+
+func (r *GitHubAPI) GetDefaultBranchName(_ io.Writer, _ string, fullRepoName string) (string, error) {
+	repo, err := r.getRepo(fullRepoName)
+	if err != nil {
+		return "", err
+	}
+	return repo.DefaultBranch, nil
+}
+
+func (r *GitHubAPI) IsPushable(_ io.Writer, repo string) (bool, error) {
+	details, err := r.getRepo(repo)
+	if err != nil {
+		return false, err
+	}
+	return details.Permissions.Push, nil
+}
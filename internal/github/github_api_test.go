@@ -0,0 +1,402 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/config"
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+// fakeWorkingCopy answers the git commands that the API backends run in a working copy cloned from a fork
+func fakeWorkingCopy() *executor.FakeExecutor {
+	return executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		switch strings.Join(args, " ") {
+		case "rev-parse --abbrev-ref HEAD":
+			return "turbolift-campaign\n", nil
+		case "remote get-url origin":
+			return "git@github.com:me/repo1.git\n", nil
+		default:
+			return "", fmt.Errorf("unexpected command %v", args)
+		}
+	})
+}
+
+// recordedRequest is a request received by an httptest server
+type recordedRequest struct {
+	method string
+	path   string
+	body   map[string]interface{}
+}
+
+func newApiServer(t *testing.T, handler func(w http.ResponseWriter, r *http.Request)) (*httptest.Server, *[]recordedRequest) {
+	requests := &[]recordedRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer some-token", r.Header.Get("Authorization"))
+		body := map[string]interface{}{}
+		content, _ := io.ReadAll(r.Body)
+		_ = json.Unmarshal(content, &body)
+		*requests = append(*requests, recordedRequest{method: r.Method, path: r.URL.RequestURI(), body: body})
+		handler(w, r)
+	}))
+	t.Cleanup(server.Close)
+	return server, requests
+}
+
+func TestItCreatesAPrFromAForkThroughTheApi(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/org/repo1":
+			_, _ = fmt.Fprint(w, `{"full_name": "org/repo1", "default_branch": "main"}`)
+		case "POST /repos/org/repo1/pulls":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprint(w, `{"number": 7, "html_url": "https://github.com/org/repo1/pull/7"}`)
+		case "POST /repos/org/repo1/issues/7/labels":
+			_, _ = fmt.Fprint(w, `[]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	sb := strings.Builder{}
+	didCreate, prUrl, err := NewGitHubAPI(server.URL, "some-token").CreatePullRequest(&sb, "work/org/repo1", PullRequest{
+		Title:        "some title",
+		Body:         "some body",
+		UpstreamRepo: "org/repo1",
+		IsDraft:      true,
+		Labels:       []string{"dependencies"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, didCreate)
+	assert.Equal(t, "https://github.com/org/repo1/pull/7", prUrl)
+	assert.Contains(t, sb.String(), "https://github.com/org/repo1/pull/7")
+
+	assert.Equal(t, []recordedRequest{
+		{method: "GET", path: "/repos/org/repo1", body: map[string]interface{}{}},
+		{method: "POST", path: "/repos/org/repo1/pulls", body: map[string]interface{}{
+			"title": "some title",
+			"body":  "some body",
+			"head":  "me:turbolift-campaign",
+			"base":  "main",
+			"draft": true,
+		}},
+		{method: "POST", path: "/repos/org/repo1/issues/7/labels", body: map[string]interface{}{
+			"labels": []interface{}{"dependencies"},
+		}},
+	}, *requests)
+}
+
+func TestItReportsNoPrCreatedWhenThereAreNoCommitsBetweenBranches(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		_, _ = fmt.Fprint(w, `{"message": "Validation Failed", "errors": [{"message": "No commits between org:main and me:turbolift-campaign"}]}`)
+	})
+
+	didCreate, _, err := NewGitHubAPI(server.URL, "some-token").CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "some title",
+		UpstreamRepo: "org/repo1",
+		Base:         "main",
+	})
+	assert.NoError(t, err)
+	assert.False(t, didCreate)
+}
+
+func TestItGetsPrStatusThroughGraphQL(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"data": {"repository": {"pullRequests": {"nodes": [
+			{"number": 2, "state": "CLOSED", "url": "https://github.com/org/repo1/pull/2"},
+			{"number": 1, "state": "OPEN", "url": "https://github.com/org/repo1/pull/1", "reviewDecision": "APPROVED",
+			 "mergeable": "MERGEABLE", "headRefName": "turbolift-campaign", "createdAt": "2024-03-01T09:00:00Z", "mergedAt": null,
+			 "reviews": {"nodes": [{"state": "APPROVED", "submittedAt": "2024-03-02T10:00:00Z"}]},
+			 "reactionGroups": [{"content": "THUMBS_UP", "reactors": {"totalCount": 3}}],
+			 "commits": {"nodes": [{"commit": {"statusCheckRollup": {"contexts": {"nodes": [
+				{"__typename": "CheckRun", "name": "build", "status": "IN_PROGRESS", "conclusion": ""},
+				{"__typename": "CheckRun", "name": "lint", "status": "COMPLETED", "conclusion": "SUCCESS"},
+				{"__typename": "StatusContext", "context": "ci/legacy", "state": "FAILURE", "targetUrl": "https://ci.example.com/1"}
+			 ]}}}}]}}
+		]}}}}`)
+	})
+
+	pr, err := NewGitHubAPI(server.URL, "some-token").GetPR(&strings.Builder{}, "work/org/repo1", "org/repo1", "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, &PrStatus{
+		HeadRefName:    "turbolift-campaign",
+		Mergeable:      "MERGEABLE",
+		Number:         1,
+		ReactionGroups: []ReactionGroup{{Content: "THUMBS_UP", Users: ReactionGroupUsers{TotalCount: 3}}},
+		ReviewDecision: "APPROVED",
+		State:          "OPEN",
+		StatusCheckRollup: []StatusCheckRollup{
+			{State: "PENDING", Name: "build"},
+			{State: "SUCCESS", Name: "lint"},
+			{State: "FAILURE", Name: "ci/legacy", Url: "https://ci.example.com/1"},
+		},
+		Url:       "https://github.com/org/repo1/pull/1",
+		CreatedAt: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		Reviews:   []Review{{State: "APPROVED", SubmittedAt: time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)}},
+	}, pr)
+
+	assert.Equal(t, "/graphql", (*requests)[0].path)
+	assert.Equal(t, map[string]interface{}{
+		"owner":  "org",
+		"name":   "repo1",
+		"branch": "turbolift-campaign",
+	}, (*requests)[0].body["variables"])
+}
+
+func TestItMergesAPrAndDeletesItsBranchInTheForkThroughTheApi(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/org/repo1/pulls/12":
+			_, _ = fmt.Fprint(w, `{"head": {"ref": "turbolift-campaign", "repo": {"full_name": "me/repo1"}}}`)
+		case "PUT /repos/org/repo1/pulls/12/merge":
+			_, _ = fmt.Fprint(w, `{"merged": true}`)
+		case "DELETE /repos/me/repo1/git/refs/heads/turbolift-campaign":
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	err := NewGitHubAPI(server.URL, "some-token").MergePullRequest(&strings.Builder{}, "org/repo1", 12, MergeStrategyRebase, true)
+	assert.NoError(t, err)
+	assert.Len(t, *requests, 3)
+	assert.Equal(t, map[string]interface{}{"merge_method": "rebase"}, (*requests)[1].body)
+	assert.Equal(t, "/repos/me/repo1/git/refs/heads/turbolift-campaign", (*requests)[2].path)
+}
+
+func TestItEnablesAutoMergeThroughTheApi(t *testing.T) {
+	mutations := 0
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.Path {
+		case "GET /repos/org/repo1/pulls/12":
+			_, _ = fmt.Fprint(w, `{"node_id": "PR_kwDOA"}`)
+		case "GET /repos/org/repo2/pulls/3":
+			_, _ = fmt.Fprint(w, `{"node_id": "PR_kwDOB"}`)
+		case "POST /graphql":
+			mutations++
+			if mutations == 2 {
+				_, _ = fmt.Fprint(w, `{"data": null, "errors": [{"message": "Pull request Auto merge is not allowed for this repository"}]}`)
+				return
+			}
+			_, _ = fmt.Fprint(w, `{"data": {"enablePullRequestAutoMerge": {"clientMutationId": null}}}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	gitHubAPI := NewGitHubAPI(server.URL, "some-token")
+
+	err := gitHubAPI.EnableAutoMerge(&strings.Builder{}, "org/repo1", 12, MergeStrategySquash)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "PR_kwDOA", "method": "SQUASH"}, (*requests)[1].body["variables"])
+
+	err = gitHubAPI.EnableAutoMerge(&strings.Builder{}, "org/repo2", 3, MergeStrategyMerge)
+	var notAllowed *AutoMergeNotAllowedError
+	assert.True(t, errors.As(err, &notAllowed))
+	assert.Equal(t, "org/repo2", notAllowed.Repo)
+}
+
+func TestItEditsTheLabelsAndReviewersOfAPrThroughTheApi(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "DELETE /repos/org/repo1/issues/12/labels/needs%20review":
+			_, _ = fmt.Fprint(w, `[]`)
+		case "POST /repos/org/repo1/pulls/12/requested_reviewers":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprint(w, `{"number": 12}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = fmt.Fprint(w, `{"message": "Label does not exist"}`)
+		}
+	})
+	gitHubAPI := NewGitHubAPI(server.URL, "some-token")
+
+	err := gitHubAPI.RemoveLabels(&strings.Builder{}, "org/repo1", 12, []string{"needs review", "absent"})
+	assert.NoError(t, err)
+	assert.Len(t, *requests, 2)
+
+	err = gitHubAPI.AddReviewers(&strings.Builder{}, "org/repo1", 12, []string{"alice", "org/platform"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"reviewers":      []interface{}{"alice"},
+		"team_reviewers": []interface{}{"platform"},
+	}, (*requests)[2].body)
+}
+
+func TestItLooksUpPrsByTheRepoNameRatherThanTheWorkingDir(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"data": {"repository": {"pullRequests": {"nodes": [
+			{"number": 1, "state": "OPEN", "url": "https://github.example.com/org/repo1/pull/1", "headRefName": "turbolift-campaign"}
+		]}}}}`)
+	})
+
+	_, err := NewGitHubAPI(server.URL, "some-token").GetPR(&strings.Builder{}, "somewhere/else", "github.example.com/org/repo1", "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, "org", (*requests)[0].body["variables"].(map[string]interface{})["owner"])
+	assert.Equal(t, "repo1", (*requests)[0].body["variables"].(map[string]interface{})["name"])
+}
+
+func TestItReturnsNoPRFoundErrorWhenTheBranchHasNoPr(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"data": {"repository": {"pullRequests": {"nodes": []}}}}`)
+	})
+
+	_, err := NewGitHubAPI(server.URL, "some-token").GetPR(&strings.Builder{}, "work/org/repo1", "org/repo1", "turbolift-campaign")
+	var noPrErr *NoPRFoundError
+	assert.True(t, errors.As(err, &noPrErr))
+}
+
+func TestItReturnsGraphQLErrors(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"data": null, "errors": [{"message": "Could not resolve to a Repository"}]}`)
+	})
+
+	_, err := NewGitHubAPI(server.URL, "some-token").GetPR(&strings.Builder{}, "work/org/repo1", "org/repo1", "turbolift-campaign")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "Could not resolve to a Repository")
+}
+
+func TestItReturnsTypedErrorsForUnsuccessfulResponses(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = fmt.Fprint(w, `{"message": "Not Found"}`)
+	})
+
+	_, err := NewGitHubAPI(server.URL, "some-token").IsPushable(&strings.Builder{}, "org/repo1")
+	var apiErr *APIError
+	assert.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+	assert.Equal(t, "Not Found", apiErr.Message)
+}
+
+func TestItWaitsForTheRateLimitToReset(t *testing.T) {
+	var slept []time.Duration
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { sleep = time.Sleep }()
+
+	attempts := 0
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"permissions": {"push": true}}`)
+	})
+
+	pushable, err := NewGitHubAPI(server.URL, "some-token").IsPushable(&strings.Builder{}, "org/repo1")
+	assert.NoError(t, err)
+	assert.True(t, pushable)
+	assert.Equal(t, 2, attempts)
+	assert.Len(t, slept, 1)
+	assert.InDelta(t, 30*time.Second, slept[0], float64(time.Second))
+}
+
+func TestItGivesUpWhenTheRateLimitResetsTooLate(t *testing.T) {
+	sleep = func(d time.Duration) { t.Fatal("should not wait") }
+	defer func() { sleep = time.Sleep }()
+
+	reset := time.Now().Add(time.Hour).Truncate(time.Second)
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", fmt.Sprint(reset.Unix()))
+		w.WriteHeader(http.StatusForbidden)
+	})
+
+	_, err := NewGitHubAPI(server.URL, "some-token").IsPushable(&strings.Builder{}, "org/repo1")
+	var rateLimitErr *RateLimitError
+	assert.True(t, errors.As(err, &rateLimitErr))
+	assert.True(t, reset.Equal(rateLimitErr.Reset))
+}
+
+func TestItReadsTheTokenFromTheGhConfig(t *testing.T) {
+	configDir := t.TempDir()
+	t.Setenv("GH_CONFIG_DIR", configDir)
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv("GITHUB_TOKEN", "")
+	_ = os.WriteFile(filepath.Join(configDir, "hosts.yml"), []byte("github.com:\n  oauth_token: from-gh-config\n  user: me\n"), 0o644)
+
+	token, err := gitHubToken(&strings.Builder{}, "github.com", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-gh-config", token)
+
+	t.Setenv("GH_TOKEN", "from-env")
+	token, err = gitHubToken(&strings.Builder{}, "github.com", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "from-env", token)
+}
+
+func TestItRoutesCallsToTheConfiguredForge(t *testing.T) {
+	t.Setenv("SOME_TOKEN_VAR", "some-token")
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"permissions": {"push": false}}`)
+	})
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	router := NewForgeRouter(&config.Config{Forges: map[string]config.Forge{
+		"github.example.com": {Type: ForgeTypeGitHub, Url: server.URL, TokenEnv: "SOME_TOKEN_VAR"},
+	}})
+
+	pushable, err := router.IsPushable(&strings.Builder{}, "github.example.com/org/repo1")
+	assert.NoError(t, err)
+	assert.False(t, pushable)
+	assert.Equal(t, "/repos/org/repo1", (*requests)[0].path)
+
+	// repos on other hosts are left to the gh CLI
+	err = router.Clone(&strings.Builder{}, "work/org", "org/repo2")
+	assert.NoError(t, err)
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org", "gh", "repo", "clone", "org/repo2"},
+	})
+}
+
+func TestItParsesRemoteUrls(t *testing.T) {
+	cases := []struct {
+		remoteUrl string
+		host      string
+		path      string
+	}{
+		{"https://github.com/org/repo.git", "github.com", "org/repo"},
+		{"git@github.com:org/repo.git\n", "github.com", "org/repo"},
+		{"ssh://git@bitbucket.example.com:7999/proj/repo.git", "bitbucket.example.com", "proj/repo"},
+		{"https://user@gitlab.example.com/group/repo", "gitlab.example.com", "group/repo"},
+	}
+
+	for _, c := range cases {
+		host, path := parseRemoteUrl(c.remoteUrl)
+		assert.Equal(t, c.host, host, c.remoteUrl)
+		assert.Equal(t, c.path, path, c.remoteUrl)
+	}
+}
@@ -16,9 +16,12 @@
 package github
 
 import (
+	"encoding/json"
 	"errors"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 
@@ -129,6 +132,24 @@ func TestItReturnsTrueAndNilErrorOnSuccessfulCreatePr(t *testing.T) {
 	})
 }
 
+func TestItReturnsTheUrlOfACreatedPr(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return "\nCreating pull request for someone:branch into main in org/repo1\n\nhttps://github.com/org/repo1/pull/12\n", nil
+	})
+	execInstance = fakeExecutor
+
+	didCreatePr, prUrl, err := NewRealGitHub().CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "some title",
+		Body:         "some body",
+		UpstreamRepo: "org/repo1",
+	})
+	assert.NoError(t, err)
+	assert.True(t, didCreatePr)
+	assert.Equal(t, "https://github.com/org/repo1/pull/12", prUrl)
+}
+
 func TestItReturnsErrorOnFailedGetDefaultBranchName(t *testing.T) {
 	fakeExecutor := executor.NewAlwaysFailsFakeExecutor()
 	execInstance = fakeExecutor
@@ -177,6 +198,196 @@ func TestItReturnsNilErrorOnSuccessfulUpdatePrDescription(t *testing.T) {
 	})
 }
 
+func TestItAppliesPrOptionsWhenCreatingAPr(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	_, _, err := NewRealGitHub().CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:         "some title",
+		Body:          "some body",
+		UpstreamRepo:  "org/repo1",
+		Labels:        []string{"dependencies"},
+		Reviewers:     []string{"octocat"},
+		TeamReviewers: []string{"platform", "other-org/security"},
+		Assignees:     []string{"hubot"},
+		Milestone:     "Q3",
+		Base:          "develop",
+	})
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "create", "--title", "some title", "--body", "some body", "--repo", "org/repo1",
+			"--label", "dependencies", "--reviewer", "octocat", "--reviewer", "org/platform", "--reviewer", "other-org/security",
+			"--assignee", "hubot", "--milestone", "Q3", "--base", "develop"},
+	})
+}
+
+func TestItAddsPrOptionsWhenUpdatingAPr(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	err := NewRealGitHub().UpdatePRDescription(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:         "new title",
+		Body:          "new body",
+		UpstreamRepo:  "org/repo1",
+		Labels:        []string{"dependencies"},
+		TeamReviewers: []string{"platform"},
+		Milestone:     "Q3",
+	})
+	assert.NoError(t, err)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{"work/org/repo1", "gh", "pr", "edit", "--title", "new title", "--body", "new body",
+			"--add-label", "dependencies", "--add-reviewer", "org/platform", "--milestone", "Q3"},
+	})
+}
+
+func TestItMergesPrsWithGh(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	err := NewRealGitHub().MergePullRequest(&strings.Builder{}, "org/repo1", 12, MergeStrategySquash, true)
+	assert.NoError(t, err)
+
+	currentDir, _ := os.Getwd()
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{currentDir, "gh", "pr", "merge", "12", "--repo", "org/repo1", "--squash", "--delete-branch"},
+	})
+}
+
+func TestItCommentsOnPrsWithGh(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	err := NewRealGitHub().CommentOnPR(&strings.Builder{}, "org/repo1", 12, "Please review")
+	assert.NoError(t, err)
+
+	currentDir, _ := os.Getwd()
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{currentDir, "gh", "pr", "comment", "12", "--repo", "org/repo1", "--body", "Please review"},
+	})
+}
+
+func TestItReopensPrsWithGh(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	err := NewRealGitHub().ReopenPullRequest(&strings.Builder{}, "org/repo1", 12)
+	assert.NoError(t, err)
+
+	currentDir, _ := os.Getwd()
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{currentDir, "gh", "pr", "reopen", "12", "--repo", "org/repo1"},
+	})
+}
+
+func TestItMovesPrsInAndOutOfDraftWithGh(t *testing.T) {
+	fakeExecutor := executor.NewAlwaysSucceedsFakeExecutor()
+	execInstance = fakeExecutor
+
+	assert.NoError(t, NewRealGitHub().MarkPRReady(&strings.Builder{}, "org/repo1", 12))
+	assert.NoError(t, NewRealGitHub().ConvertPRToDraft(&strings.Builder{}, "org/repo1", 13))
+
+	currentDir, _ := os.Getwd()
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{currentDir, "gh", "pr", "ready", "12", "--repo", "org/repo1"},
+		{currentDir, "gh", "pr", "ready", "13", "--repo", "org/repo1", "--undo"},
+	})
+}
+
+func TestItReportsReposThatDoNotAllowAutoMergeWithGh(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		if args[4] == "org/repo2" {
+			return "GraphQL: Auto merge is not allowed for this repository (enablePullRequestAutoMerge)\n", errors.New("exit status 1")
+		}
+		return "", nil
+	})
+	execInstance = fakeExecutor
+
+	err := NewRealGitHub().EnableAutoMerge(&strings.Builder{}, "org/repo1", 12, MergeStrategySquash)
+	assert.NoError(t, err)
+
+	err = NewRealGitHub().EnableAutoMerge(&strings.Builder{}, "org/repo2", 3, MergeStrategyMerge)
+	var notAllowed *AutoMergeNotAllowedError
+	assert.True(t, errors.As(err, &notAllowed))
+	assert.Equal(t, "org/repo2", notAllowed.Repo)
+
+	currentDir, _ := os.Getwd()
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{currentDir, "gh", "pr", "merge", "12", "--repo", "org/repo1", "--auto", "--squash"},
+		{currentDir, "gh", "pr", "merge", "3", "--repo", "org/repo2", "--auto", "--merge"},
+	})
+}
+
+func TestItFindsPrNumbersInUrls(t *testing.T) {
+	for prUrl, expected := range map[string]int{
+		"https://github.com/org/repo1/pull/12":                                            12,
+		"https://gitlab.example.com/org/repo1/-/merge_requests/3":                         3,
+		"https://bitbucket.example.com/projects/ORG/repos/repo1/pull-requests/7/overview": 7,
+	} {
+		number, ok := PrNumberFromUrl(prUrl)
+		assert.True(t, ok, prUrl)
+		assert.Equal(t, expected, number, prUrl)
+	}
+
+	_, ok := PrNumberFromUrl("https://github.com/org/repo1/pull/")
+	assert.False(t, ok)
+}
+
+func TestItCreatesAndReadsIssuesWithGh(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		if args[1] == "create" {
+			return "\nCreating issue in org/tracking\n\nhttps://github.com/org/tracking/issues/12\n", nil
+		}
+		return `{"number": 12, "url": "https://github.com/org/tracking/issues/12", "title": "some title", "body": "some body"}`, nil
+	})
+	execInstance = fakeExecutor
+
+	issue, err := NewRealGitHub().CreateIssue(&strings.Builder{}, "org/tracking", "some title", "some body")
+	assert.NoError(t, err)
+	assert.Equal(t, &Issue{Number: 12, Url: "https://github.com/org/tracking/issues/12", Title: "some title", Body: "some body"}, issue)
+
+	issue, err = NewRealGitHub().GetIssue(&strings.Builder{}, "org/tracking", 12)
+	assert.NoError(t, err)
+	assert.Equal(t, "some body", issue.Body)
+
+	currentDir, _ := os.Getwd()
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{currentDir, "gh", "issue", "create", "--repo", "org/tracking", "--title", "some title", "--body", "some body"},
+		{currentDir, "gh", "issue", "view", "12", "--repo", "org/tracking", "--json", "number,url,title,body"},
+	})
+}
+
+func TestItReadsCheckRunsAndStatusContextsFromGh(t *testing.T) {
+	var checks []StatusCheckRollup
+	err := json.Unmarshal([]byte(`[
+		{"__typename": "CheckRun", "name": "build", "status": "COMPLETED", "conclusion": "FAILURE", "detailsUrl": "https://ci.example.com/1"},
+		{"__typename": "CheckRun", "name": "lint", "status": "IN_PROGRESS", "conclusion": ""},
+		{"__typename": "StatusContext", "context": "ci/legacy", "state": "SUCCESS", "targetUrl": "https://ci.example.com/2"}
+	]`), &checks)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []StatusCheckRollup{
+		{State: "FAILURE", Name: "build", Url: "https://ci.example.com/1"},
+		{State: "PENDING", Name: "lint"},
+		{State: "SUCCESS", Name: "ci/legacy", Url: "https://ci.example.com/2"},
+	}, checks)
+}
+
+func TestItFindsWhenAPrWasFirstReviewed(t *testing.T) {
+	pr := &PrStatus{Reviews: []Review{
+		{State: "APPROVED", SubmittedAt: time.Date(2024, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{State: "PENDING"},
+		{State: "COMMENTED", SubmittedAt: time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC)},
+	}}
+	assert.Equal(t, time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), pr.FirstReviewedAt())
+	assert.True(t, (&PrStatus{}).FirstReviewedAt().IsZero())
+}
+
 func runForkAndCloneAndCaptureOutput() (string, error) {
 	sb := strings.Builder{}
 	err := NewRealGitHub().ForkAndClone(&sb, "work/org", "org/repo1")
@@ -193,7 +404,7 @@ func runCloneAndCaptureOutput() (string, error) {
 
 func runCreatePrAndCaptureOutput() (bool, string, error) {
 	sb := strings.Builder{}
-	didCreatePr, err := NewRealGitHub().CreatePullRequest(&sb, "work/org/repo1", PullRequest{
+	didCreatePr, _, err := NewRealGitHub().CreatePullRequest(&sb, "work/org/repo1", PullRequest{
 		Title:        "some title",
 		Body:         "some body",
 		UpstreamRepo: "org/repo1",
@@ -204,7 +415,7 @@ func runCreatePrAndCaptureOutput() (bool, string, error) {
 
 func runCreateDraftPrAndCaptureOutput() (bool, string, error) {
 	sb := strings.Builder{}
-	didCreatePr, err := NewRealGitHub().CreatePullRequest(&sb, "work/org/repo1", PullRequest{
+	didCreatePr, _, err := NewRealGitHub().CreatePullRequest(&sb, "work/org/repo1", PullRequest{
 		Title:        "some title",
 		Body:         "some body",
 		UpstreamRepo: "org/repo1",
@@ -222,6 +433,10 @@ func runGetDefaultBranchNameAndCaptureOutput() (string, string, error) {
 
 func runUpdatePrDescriptionAndCaptureOutput() (string, error) {
 	sb := strings.Builder{}
-	err := NewRealGitHub().UpdatePRDescription(&sb, "work/org/repo1", "new title", "new body")
+	err := NewRealGitHub().UpdatePRDescription(&sb, "work/org/repo1", PullRequest{
+		Title:        "new title",
+		Body:         "new body",
+		UpstreamRepo: "org/repo1",
+	})
 	return sb.String(), err
 }
@@ -0,0 +1,517 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// GitLab implements GitHub for GitLab, using the v4 REST API. Merge requests take the place of pull requests.
+type GitLab struct {
+	client *apiClient
+}
+
+// NewGitLab creates a client for the GitLab instance at baseUrl, e.g. https://gitlab.example.com
+func NewGitLab(baseUrl string, token string) *GitLab {
+	return &GitLab{
+		client: newApiClient(strings.TrimSuffix(baseUrl, "/")+"/api/v4", token, nil),
+	}
+}
+
+// gitLabDeveloperAccess is the lowest access level that allows pushing to a project
+const gitLabDeveloperAccess = 30
+
+// gitLabDraftPrefix marks a merge request as a draft, which GitLab recognises by its title
+const gitLabDraftPrefix = "Draft: "
+
+type gitLabProject struct {
+	Id                int    `json:"id"`
+	PathWithNamespace string `json:"path_with_namespace"`
+	HttpUrlToRepo     string `json:"http_url_to_repo"`
+	DefaultBranch     string `json:"default_branch"`
+	ImportStatus      string `json:"import_status"`
+	Permissions       struct {
+		ProjectAccess *struct {
+			AccessLevel int `json:"access_level"`
+		} `json:"project_access"`
+		GroupAccess *struct {
+			AccessLevel int `json:"access_level"`
+		} `json:"group_access"`
+	} `json:"permissions"`
+}
+
+type gitLabMergeRequest struct {
+	Iid           int             `json:"iid"`
+	Title         string          `json:"title"`
+	State         string          `json:"state"`
+	WebUrl        string          `json:"web_url"`
+	SourceBranch  string          `json:"source_branch"`
+	Draft         bool            `json:"draft"`
+	MergeStatus   string          `json:"merge_status"`
+	Upvotes       int             `json:"upvotes"`
+	Downvotes     int             `json:"downvotes"`
+	HasConflicts  bool            `json:"has_conflicts"`
+	HeadPipeline  *gitLabPipeline `json:"head_pipeline"`
+	Assignees     []gitLabUser    `json:"assignees"`
+	Reviewers     []gitLabUser    `json:"reviewers"`
+	TargetProject int             `json:"target_project_id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	MergedAt      time.Time       `json:"merged_at"`
+	ClosedAt      time.Time       `json:"closed_at"`
+}
+
+type gitLabPipeline struct {
+	Status string `json:"status"`
+	WebUrl string `json:"web_url"`
+}
+
+type gitLabUser struct {
+	Id       int    `json:"id"`
+	Username string `json:"username"`
+}
+
+// projectPath is the URL path of a project, which GitLab identifies by its URL-encoded full path
+func projectPath(owner string, name string) string {
+	return "/projects/" + url.PathEscape(owner+"/"+name)
+}
+
+func (r *GitLab) getProject(owner string, name string) (*gitLabProject, error) {
+	var project gitLabProject
+	if err := r.client.do(http.MethodGet, projectPath(owner, name), nil, &project); err != nil {
+		return nil, err
+	}
+	return &project, nil
+}
+
+func (r *GitLab) ForkAndClone(output io.Writer, workingDir string, fullRepoName string) error {
+	owner, name := splitRepoName(fullRepoName)
+	upstream, err := r.getProject(owner, name)
+	if err != nil {
+		return err
+	}
+
+	var fork gitLabProject
+	err = r.client.do(http.MethodPost, projectPath(owner, name)+"/fork", nil, &fork)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusConflict {
+		// the project has already been forked into the user's namespace
+		var user gitLabUser
+		if err := r.client.do(http.MethodGet, "/user", nil, &user); err != nil {
+			return err
+		}
+		existing, err := r.getProject(user.Username, name)
+		if err != nil {
+			return err
+		}
+		fork = *existing
+	} else if err != nil {
+		return err
+	}
+
+	// forks are created asynchronously, so wait until the repository has been copied
+	for attempt := 1; fork.ImportStatus != "" && fork.ImportStatus != "none" && fork.ImportStatus != "finished"; attempt++ {
+		if fork.ImportStatus == "failed" || attempt == 10 {
+			return fmt.Errorf("fork of %s was not ready: import status %s", fullRepoName, fork.ImportStatus)
+		}
+		sleep(time.Duration(attempt) * time.Second)
+		if err := r.client.do(http.MethodGet, fmt.Sprintf("/projects/%d", fork.Id), nil, &fork); err != nil {
+			return err
+		}
+	}
+
+	return cloneRepo(output, workingDir, fork.HttpUrlToRepo, name, upstream.HttpUrlToRepo)
+}
+
+func (r *GitLab) Clone(output io.Writer, workingDir string, fullRepoName string) error {
+	owner, name := splitRepoName(fullRepoName)
+	project, err := r.getProject(owner, name)
+	if err != nil {
+		return err
+	}
+	return cloneRepo(output, workingDir, project.HttpUrlToRepo, name, "")
+}
+
+func (r *GitLab) CreatePullRequest(output io.Writer, workingDir string, pr PullRequest) (didCreate bool, prUrl string, err error) {
+	owner, name := splitRepoName(pr.UpstreamRepo)
+	target, err := r.getProject(owner, name)
+	if err != nil {
+		return false, "", err
+	}
+
+	sourceBranch, err := currentBranch(output, workingDir)
+	if err != nil {
+		return false, "", err
+	}
+	sourceOwner, err := originOwner(output, workingDir)
+	if err != nil {
+		return false, "", err
+	}
+	source := target
+	if sourceOwner != owner {
+		if source, err = r.getProject(sourceOwner, name); err != nil {
+			return false, "", err
+		}
+	}
+
+	targetBranch := pr.Base
+	if targetBranch == "" {
+		targetBranch = target.DefaultBranch
+	}
+
+	// GitLab will happily create a merge request with no changes, so check that there is something to merge first
+	var comparison struct {
+		Commits []interface{} `json:"commits"`
+	}
+	compareQuery := url.Values{"from": {targetBranch}, "to": {sourceBranch}, "from_project_id": {fmt.Sprint(target.Id)}}
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("/projects/%d/repository/compare?%s", source.Id, compareQuery.Encode()), nil, &comparison); err != nil {
+		return false, "", err
+	}
+	if len(comparison.Commits) == 0 {
+		return false, "", nil
+	}
+
+	title := pr.Title
+	if pr.IsDraft {
+		title = gitLabDraftPrefix + title
+	}
+	request := map[string]interface{}{
+		"title":             title,
+		"description":       pr.Body,
+		"source_branch":     sourceBranch,
+		"target_branch":     targetBranch,
+		"target_project_id": target.Id,
+	}
+	if err := r.addPrOptions(output, target.Id, request, pr, nil); err != nil {
+		return false, "", err
+	}
+
+	var created gitLabMergeRequest
+	if err := r.client.do(http.MethodPost, fmt.Sprintf("/projects/%d/merge_requests", source.Id), request, &created); err != nil {
+		return false, "", err
+	}
+
+	_, _ = fmt.Fprintln(output, created.WebUrl)
+	return true, created.WebUrl, nil
+}
+
+// addPrOptions adds the labels, reviewers, assignees and milestone of pr to a request to create or update a merge
+// request. Reviewers and assignees are added to those of the existing merge request, if there is one.
+func (r *GitLab) addPrOptions(output io.Writer, projectId int, request map[string]interface{}, pr PullRequest, existing *gitLabMergeRequest) error {
+	if len(pr.Labels) > 0 {
+		if existing == nil {
+			request["labels"] = strings.Join(pr.Labels, ",")
+		} else {
+			request["add_labels"] = strings.Join(pr.Labels, ",")
+		}
+	}
+
+	if len(pr.TeamReviewers) > 0 {
+		_, _ = fmt.Fprintln(output, "GitLab does not support team reviewers; ignoring", strings.Join(pr.TeamReviewers, ", "))
+	}
+
+	var existingReviewers, existingAssignees []gitLabUser
+	if existing != nil {
+		existingReviewers, existingAssignees = existing.Reviewers, existing.Assignees
+	}
+	if len(pr.Reviewers) > 0 {
+		ids, err := r.userIds(existingReviewers, pr.Reviewers)
+		if err != nil {
+			return err
+		}
+		request["reviewer_ids"] = ids
+	}
+	if len(pr.Assignees) > 0 {
+		ids, err := r.userIds(existingAssignees, pr.Assignees)
+		if err != nil {
+			return err
+		}
+		request["assignee_ids"] = ids
+	}
+
+	if pr.Milestone != "" {
+		var milestones []struct {
+			Id int `json:"id"`
+		}
+		query := url.Values{"title": {pr.Milestone}, "state": {"active"}, "include_ancestors": {"true"}}
+		if err := r.client.do(http.MethodGet, fmt.Sprintf("/projects/%d/milestones?%s", projectId, query.Encode()), nil, &milestones); err != nil {
+			return err
+		}
+		if len(milestones) == 0 {
+			return fmt.Errorf("no active milestone named %s", pr.Milestone)
+		}
+		request["milestone_id"] = milestones[0].Id
+	}
+
+	return nil
+}
+
+// userIds returns the ids of existing users along with those of the named users, which GitLab needs in place of
+// usernames
+func (r *GitLab) userIds(existing []gitLabUser, usernames []string) ([]int, error) {
+	ids := []int{}
+	known := map[string]bool{}
+	for _, user := range existing {
+		ids = append(ids, user.Id)
+		known[user.Username] = true
+	}
+	for _, username := range usernames {
+		if known[username] {
+			continue
+		}
+		var users []gitLabUser
+		if err := r.client.do(http.MethodGet, "/users?username="+url.QueryEscape(username), nil, &users); err != nil {
+			return nil, err
+		}
+		if len(users) == 0 {
+			return nil, fmt.Errorf("no GitLab user named %s", username)
+		}
+		ids = append(ids, users[0].Id)
+		known[username] = true
+	}
+	return ids, nil
+}
+
+// findMergeRequest returns the most relevant merge request raised from a branch into the upstream project of a
+// working copy, preferring one that is open
+func (r *GitLab) findMergeRequest(workingDir string, fullRepoName string, branchName string) (*gitLabMergeRequest, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var mergeRequests []gitLabMergeRequest
+	query := url.Values{"source_branch": {branchName}, "order_by": {"created_at"}, "sort": {"desc"}}
+	if err := r.client.do(http.MethodGet, projectPath(owner, name)+"/merge_requests?"+query.Encode(), nil, &mergeRequests); err != nil {
+		return nil, err
+	}
+	if len(mergeRequests) == 0 {
+		return nil, &NoPRFoundError{Path: workingDir, BranchName: branchName}
+	}
+
+	found := mergeRequests[0]
+	for _, mr := range mergeRequests {
+		if mr.State == "opened" {
+			found = mr
+			break
+		}
+	}
+
+	// pipeline and reviewer details are only included when fetching a single merge request
+	var detailed gitLabMergeRequest
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, name), found.Iid), nil, &detailed); err != nil {
+		return nil, err
+	}
+	return &detailed, nil
+}
+
+func (r *GitLab) ClosePullRequest(_ io.Writer, workingDir string, fullRepoName string, branchName string) error {
+	mr, err := r.findMergeRequest(workingDir, fullRepoName, branchName)
+	if err != nil {
+		return err
+	}
+
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, name), mr.Iid), map[string]interface{}{
+		"state_event": "close",
+	}, nil)
+}
+
+func (r *GitLab) ReopenPullRequest(_ io.Writer, fullRepoName string, number int) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, name), number), map[string]interface{}{
+		"state_event": "reopen",
+	}, nil)
+}
+
+// MergePullRequest merges a merge request, squashing it if asked. GitLab decides whether to rebase by the merge method
+// of the project, so the rebase strategy is not supported.
+func (r *GitLab) MergePullRequest(_ io.Writer, fullRepoName string, number int, strategy string, deleteBranch bool) error {
+	if strategy == MergeStrategyRebase {
+		return errors.New("GitLab merges with the merge method set for the project: use the merge or squash strategy")
+	}
+
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPut, fmt.Sprintf("%s/merge_requests/%d/merge", projectPath(owner, name), number), map[string]interface{}{
+		"squash":                      strategy == MergeStrategySquash,
+		"should_remove_source_branch": deleteBranch,
+	}, nil)
+}
+
+// EnableAutoMerge has a merge request merged once its pipeline succeeds
+func (r *GitLab) EnableAutoMerge(_ io.Writer, fullRepoName string, number int, strategy string) error {
+	if strategy == MergeStrategyRebase {
+		return errors.New("GitLab merges with the merge method set for the project: use the merge or squash strategy")
+	}
+
+	owner, name := splitRepoName(fullRepoName)
+	err := r.client.do(http.MethodPut, fmt.Sprintf("%s/merge_requests/%d/merge", projectPath(owner, name), number), map[string]interface{}{
+		"squash":                       strategy == MergeStrategySquash,
+		"merge_when_pipeline_succeeds": true,
+	}, nil)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusMethodNotAllowed {
+		return &AutoMergeNotAllowedError{Repo: fullRepoName, Reason: apiErr.Message}
+	}
+	return err
+}
+
+func (r *GitLab) DisableAutoMerge(_ io.Writer, fullRepoName string, number int) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/merge_requests/%d/cancel_merge_when_pipeline_succeeds", projectPath(owner, name), number), nil, nil)
+}
+
+func (r *GitLab) UpdatePRDescription(output io.Writer, workingDir string, pr PullRequest) error {
+	branchName, err := currentBranch(output, workingDir)
+	if err != nil {
+		return err
+	}
+	mr, err := r.findMergeRequest(workingDir, pr.UpstreamRepo, branchName)
+	if err != nil {
+		return err
+	}
+
+	// GitLab marks merge requests as drafts by the prefix of their title, so keep it while they are still drafts
+	title := pr.Title
+	if strings.HasPrefix(mr.Title, gitLabDraftPrefix) && !strings.HasPrefix(title, gitLabDraftPrefix) {
+		title = gitLabDraftPrefix + title
+	}
+	request := map[string]interface{}{
+		"title":       title,
+		"description": pr.Body,
+	}
+	if pr.Base != "" {
+		request["target_branch"] = pr.Base
+	}
+	if err := r.addPrOptions(output, mr.TargetProject, request, pr, mr); err != nil {
+		return err
+	}
+
+	owner, name := splitRepoName(pr.UpstreamRepo)
+	return r.client.do(http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, name), mr.Iid), request, nil)
+}
+
+func (r *GitLab) GetPR(_ io.Writer, workingDir string, fullRepoName string, branchName string) (*PrStatus, error) {
+	mr, err := r.findMergeRequest(workingDir, fullRepoName, branchName)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, name := splitRepoName(fullRepoName)
+	var approvals struct {
+		Approved bool `json:"approved"`
+	}
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/merge_requests/%d/approvals", projectPath(owner, name), mr.Iid), nil, &approvals); err != nil {
+		return nil, err
+	}
+
+	return mr.toPrStatus(approvals.Approved), nil
+}
+
+func (mr *gitLabMergeRequest) toPrStatus(approved bool) *PrStatus {
+	status := &PrStatus{
+		Closed:            mr.State == "closed" || mr.State == "merged",
+		HeadRefName:       mr.SourceBranch,
+		IsDraft:           mr.Draft,
+		Mergeable:         "UNKNOWN",
+		Number:            mr.Iid,
+		ReactionGroups:    []ReactionGroup{},
+		ReviewDecision:    "REVIEW_REQUIRED",
+		StatusCheckRollup: []StatusCheckRollup{},
+		Title:             mr.Title,
+		Url:               mr.WebUrl,
+		CreatedAt:         mr.CreatedAt,
+		MergedAt:          mr.MergedAt,
+		ClosedAt:          mr.ClosedAt,
+	}
+
+	switch mr.State {
+	case "merged":
+		status.State = "MERGED"
+	case "closed":
+		status.State = "CLOSED"
+	default:
+		status.State = "OPEN"
+	}
+
+	if mr.HasConflicts {
+		status.Mergeable = "CONFLICTING"
+	} else if mr.MergeStatus == "can_be_merged" {
+		status.Mergeable = "MERGEABLE"
+	}
+
+	if approved {
+		status.ReviewDecision = "APPROVED"
+	}
+
+	if mr.Upvotes > 0 {
+		status.ReactionGroups = append(status.ReactionGroups, ReactionGroup{Content: "THUMBS_UP", Users: ReactionGroupUsers{TotalCount: mr.Upvotes}})
+	}
+	if mr.Downvotes > 0 {
+		status.ReactionGroups = append(status.ReactionGroups, ReactionGroup{Content: "THUMBS_DOWN", Users: ReactionGroupUsers{TotalCount: mr.Downvotes}})
+	}
+
+	if mr.HeadPipeline != nil {
+		status.StatusCheckRollup = append(status.StatusCheckRollup, StatusCheckRollup{
+			State: gitLabPipelineState(mr.HeadPipeline.Status),
+			Name:  "pipeline",
+			Url:   mr.HeadPipeline.WebUrl,
+		})
+	}
+
+	return status
+}
+
+// gitLabPipelineState translates the status of a GitLab pipeline into the equivalent GitHub check state
+func gitLabPipelineState(status string) string {
+	switch status {
+	case "success":
+		return "SUCCESS"
+	case "failed":
+		return "FAILURE"
+	case "canceled":
+		return "CANCELLED"
+	case "skipped":
+		return "SKIPPED"
+	default:
+		return "PENDING"
+	}
+}
+
+func (r *GitLab) GetDefaultBranchName(_ io.Writer, _ string, fullRepoName string) (string, error) {
+	project, err := r.getProject(splitRepoName(fullRepoName))
+	if err != nil {
+		return "", err
+	}
+	return project.DefaultBranch, nil
+}
+
+func (r *GitLab) IsPushable(_ io.Writer, repo string) (bool, error) {
+	project, err := r.getProject(splitRepoName(repo))
+	if err != nil {
+		return false, err
+	}
+
+	permissions := project.Permissions
+	if permissions.ProjectAccess != nil && permissions.ProjectAccess.AccessLevel >= gitLabDeveloperAccess {
+		return true, nil
+	}
+	if permissions.GroupAccess != nil && permissions.GroupAccess.AccessLevel >= gitLabDeveloperAccess {
+		return true, nil
+	}
+	return false, nil
+}
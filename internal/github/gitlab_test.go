@@ -0,0 +1,364 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/config"
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItCreatesAMergeRequestFromAForkOnGitLab(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /api/v4/projects/org%2Frepo1":
+			_, _ = fmt.Fprint(w, `{"id": 1, "default_branch": "main"}`)
+		case "GET /api/v4/projects/me%2Frepo1":
+			_, _ = fmt.Fprint(w, `{"id": 2, "default_branch": "main"}`)
+		case "GET /api/v4/projects/2/repository/compare":
+			_, _ = fmt.Fprint(w, `{"commits": [{"id": "abc"}]}`)
+		case "GET /api/v4/users":
+			_, _ = fmt.Fprint(w, `[{"id": 42, "username": "octocat"}]`)
+		case "POST /api/v4/projects/2/merge_requests":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprint(w, `{"iid": 5, "web_url": "https://gitlab.example.com/org/repo1/-/merge_requests/5"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	didCreate, prUrl, err := NewGitLab(server.URL, "some-token").CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "some title",
+		Body:         "some body",
+		UpstreamRepo: "gitlab.example.com/org/repo1",
+		IsDraft:      true,
+		Labels:       []string{"dependencies", "automated"},
+		Reviewers:    []string{"octocat"},
+	})
+	assert.NoError(t, err)
+	assert.True(t, didCreate)
+	assert.Equal(t, "https://gitlab.example.com/org/repo1/-/merge_requests/5", prUrl)
+
+	created := (*requests)[len(*requests)-1]
+	assert.Equal(t, "/api/v4/projects/2/merge_requests", created.path)
+	assert.Equal(t, map[string]interface{}{
+		"title":             "Draft: some title",
+		"description":       "some body",
+		"source_branch":     "turbolift-campaign",
+		"target_branch":     "main",
+		"target_project_id": float64(1),
+		"labels":            "dependencies,automated",
+		"reviewer_ids":      []interface{}{float64(42)},
+	}, created.body)
+}
+
+func TestItDoesNotCreateAnEmptyMergeRequestOnGitLab(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/2/repository/compare":
+			_, _ = fmt.Fprint(w, `{"commits": []}`)
+		default:
+			_, _ = fmt.Fprint(w, `{"id": 2, "default_branch": "main"}`)
+		}
+	})
+
+	didCreate, _, err := NewGitLab(server.URL, "some-token").CreatePullRequest(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "some title",
+		UpstreamRepo: "org/repo1",
+	})
+	assert.NoError(t, err)
+	assert.False(t, didCreate)
+	for _, request := range *requests {
+		assert.NotEqual(t, "POST", request.method)
+	}
+}
+
+func TestItGetsMergeRequestStatusFromGitLab(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/org%2Frepo1/merge_requests":
+			assert.Equal(t, "turbolift-campaign", r.URL.Query().Get("source_branch"))
+			_, _ = fmt.Fprint(w, `[{"iid": 4, "state": "closed"}, {"iid": 3, "state": "opened"}]`)
+		case "/api/v4/projects/org%2Frepo1/merge_requests/3":
+			_, _ = fmt.Fprint(w, `{"iid": 3, "state": "opened", "title": "some title", "source_branch": "turbolift-campaign", "created_at": "2024-03-01T09:00:00.000Z",
+				"web_url": "https://gitlab.example.com/org/repo1/-/merge_requests/3", "merge_status": "can_be_merged",
+				"upvotes": 2, "head_pipeline": {"status": "failed", "web_url": "https://gitlab.example.com/org/repo1/-/pipelines/9"}}`)
+		case "/api/v4/projects/org%2Frepo1/merge_requests/3/approvals":
+			_, _ = fmt.Fprint(w, `{"approved": true}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	pr, err := NewGitLab(server.URL, "some-token").GetPR(&strings.Builder{}, "work/org/repo1", "org/repo1", "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, &PrStatus{
+		HeadRefName:       "turbolift-campaign",
+		Mergeable:         "MERGEABLE",
+		Number:            3,
+		ReactionGroups:    []ReactionGroup{{Content: "THUMBS_UP", Users: ReactionGroupUsers{TotalCount: 2}}},
+		ReviewDecision:    "APPROVED",
+		State:             "OPEN",
+		StatusCheckRollup: []StatusCheckRollup{{State: "FAILURE", Name: "pipeline", Url: "https://gitlab.example.com/org/repo1/-/pipelines/9"}},
+		Title:             "some title",
+		Url:               "https://gitlab.example.com/org/repo1/-/merge_requests/3",
+		CreatedAt:         time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+	}, pr)
+}
+
+func TestItMergesMergeRequestsOnGitLab(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"iid": 3, "state": "merged"}`)
+	})
+	gitLab := NewGitLab(server.URL, "some-token")
+
+	err := gitLab.MergePullRequest(&strings.Builder{}, "gitlab.example.com/org/repo1", 3, MergeStrategySquash, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v4/projects/org%2Frepo1/merge_requests/3/merge", (*requests)[0].path)
+	assert.Equal(t, map[string]interface{}{"squash": true, "should_remove_source_branch": true}, (*requests)[0].body)
+
+	err = gitLab.MergePullRequest(&strings.Builder{}, "gitlab.example.com/org/repo1", 3, MergeStrategyRebase, false)
+	assert.Error(t, err)
+	assert.Len(t, *requests, 1)
+}
+
+func TestItSetsMergeRequestsToMergeWhenThePipelineSucceedsOnGitLab(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() == "/api/v4/projects/org%2Frepo2/merge_requests/4/merge" {
+			w.WriteHeader(http.StatusMethodNotAllowed)
+			_, _ = fmt.Fprint(w, `{"message": "405 Method Not Allowed"}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"iid": 3, "merge_when_pipeline_succeeds": true}`)
+	})
+	gitLab := NewGitLab(server.URL, "some-token")
+
+	err := gitLab.EnableAutoMerge(&strings.Builder{}, "gitlab.example.com/org/repo1", 3, MergeStrategyMerge)
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v4/projects/org%2Frepo1/merge_requests/3/merge", (*requests)[0].path)
+	assert.Equal(t, map[string]interface{}{"squash": false, "merge_when_pipeline_succeeds": true}, (*requests)[0].body)
+
+	err = gitLab.DisableAutoMerge(&strings.Builder{}, "gitlab.example.com/org/repo1", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "/api/v4/projects/org%2Frepo1/merge_requests/3/cancel_merge_when_pipeline_succeeds", (*requests)[1].path)
+
+	err = gitLab.EnableAutoMerge(&strings.Builder{}, "gitlab.example.com/org/repo2", 4, MergeStrategySquash)
+	var notAllowed *AutoMergeNotAllowedError
+	assert.True(t, errors.As(err, &notAllowed))
+}
+
+func TestItRemovesReviewersFromMergeRequestsOnGitLab(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"iid": 3, "reviewers": [{"id": 1, "username": "alice"}, {"id": 2, "username": "bob"}]}`)
+	})
+	gitLab := NewGitLab(server.URL, "some-token")
+
+	err := gitLab.RemoveReviewers(&strings.Builder{}, "gitlab.example.com/org/repo1", 3, []string{"alice"})
+	assert.NoError(t, err)
+	assert.Equal(t, "PUT", (*requests)[1].method)
+	assert.Equal(t, "/api/v4/projects/org%2Frepo1/merge_requests/3", (*requests)[1].path)
+	assert.Equal(t, map[string]interface{}{"reviewer_ids": []interface{}{float64(2)}}, (*requests)[1].body)
+}
+
+func TestItRemovesAssigneesFromMergeRequestsOnGitLab(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"iid": 3, "assignees": [{"id": 1, "username": "alice"}, {"id": 2, "username": "bob"}]}`)
+	})
+	gitLab := NewGitLab(server.URL, "some-token")
+
+	err := gitLab.RemoveAssignees(&strings.Builder{}, "gitlab.example.com/org/repo1", 3, []string{"bob"})
+	assert.NoError(t, err)
+	assert.Equal(t, "PUT", (*requests)[1].method)
+	assert.Equal(t, map[string]interface{}{"assignee_ids": []interface{}{float64(1)}}, (*requests)[1].body)
+}
+
+func TestItMarksMergeRequestsAsReadyByTheirTitleOnGitLab(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"iid": 3, "title": "Draft: some title", "draft": true}`)
+	})
+	gitLab := NewGitLab(server.URL, "some-token")
+
+	err := gitLab.MarkPRReady(&strings.Builder{}, "gitlab.example.com/org/repo1", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "PUT", (*requests)[1].method)
+	assert.Equal(t, "/api/v4/projects/org%2Frepo1/merge_requests/3", (*requests)[1].path)
+	assert.Equal(t, map[string]interface{}{"title": "some title"}, (*requests)[1].body)
+
+	err = gitLab.ConvertPRToDraft(&strings.Builder{}, "gitlab.example.com/org/repo1", 3)
+	assert.NoError(t, err)
+	assert.Len(t, *requests, 3, "a merge request that is already a draft is left alone")
+}
+
+func TestItKeepsATrackingIssueOnGitLab(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "POST /api/v4/projects/org%2Ftracking/issues":
+			w.WriteHeader(http.StatusCreated)
+			_, _ = fmt.Fprint(w, `{"iid": 8, "title": "some title", "description": "some body", "web_url": "https://gitlab.example.com/org/tracking/-/issues/8"}`)
+		case "PUT /api/v4/projects/org%2Ftracking/issues/8":
+			_, _ = fmt.Fprint(w, `{"iid": 8}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	gitLab := NewGitLab(server.URL, "some-token")
+
+	issue, err := gitLab.CreateIssue(&strings.Builder{}, "gitlab.example.com/org/tracking", "some title", "some body")
+	assert.NoError(t, err)
+	assert.Equal(t, &Issue{Number: 8, Url: "https://gitlab.example.com/org/tracking/-/issues/8", Title: "some title", Body: "some body"}, issue)
+
+	err = gitLab.UpdateIssueBody(&strings.Builder{}, "gitlab.example.com/org/tracking", 8, "new body")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"description": "new body"}, (*requests)[1].body)
+}
+
+func TestItReturnsNoPRFoundErrorWhenGitLabHasNoMergeRequest(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `[]`)
+	})
+
+	err := NewGitLab(server.URL, "some-token").ClosePullRequest(&strings.Builder{}, "work/org/repo1", "org/repo1", "turbolift-campaign")
+	var noPrErr *NoPRFoundError
+	assert.True(t, errors.As(err, &noPrErr))
+}
+
+func TestItFindsProjectsInSubgroupsOnGitLab(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/group%2Fsub%2Frepo1":
+			_, _ = fmt.Fprint(w, `{"permissions": {"project_access": {"access_level": 30}, "group_access": null}}`)
+		case "/api/v4/projects/group%2Fsub%2Frepo1/merge_requests":
+			_, _ = fmt.Fprint(w, `[{"iid": 3, "state": "opened"}]`)
+		case "/api/v4/projects/group%2Fsub%2Frepo1/merge_requests/3":
+			_, _ = fmt.Fprint(w, `{"iid": 3, "state": "opened"}`)
+		default:
+			_, _ = fmt.Fprint(w, `{}`)
+		}
+	})
+	gitlab := NewGitLab(server.URL, "some-token")
+
+	pushable, err := gitlab.IsPushable(&strings.Builder{}, "gitlab.example.com/group/sub/repo1")
+	assert.NoError(t, err)
+	assert.True(t, pushable)
+
+	err = gitlab.ClosePullRequest(&strings.Builder{}, "work/group/sub/repo1", "gitlab.example.com/group/sub/repo1", "turbolift-campaign")
+	assert.NoError(t, err)
+	closed := (*requests)[len(*requests)-1]
+	assert.Equal(t, "/api/v4/projects/group%2Fsub%2Frepo1/merge_requests/3", closed.path)
+}
+
+func TestItKeepsGitLabDraftsAsDraftsWhenUpdatingTheDescription(t *testing.T) {
+	execInstance = fakeWorkingCopy()
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method + " " + r.URL.EscapedPath() {
+		case "GET /api/v4/projects/org%2Frepo1/merge_requests":
+			_, _ = fmt.Fprint(w, `[{"iid": 3, "state": "opened"}]`)
+		case "GET /api/v4/projects/org%2Frepo1/merge_requests/3":
+			_, _ = fmt.Fprint(w, `{"iid": 3, "state": "opened", "title": "Draft: old title", "target_project_id": 1}`)
+		default:
+			_, _ = fmt.Fprint(w, `{}`)
+		}
+	})
+
+	err := NewGitLab(server.URL, "some-token").UpdatePRDescription(&strings.Builder{}, "work/org/repo1", PullRequest{
+		Title:        "new title",
+		Body:         "new body",
+		UpstreamRepo: "org/repo1",
+		Labels:       []string{"dependencies"},
+	})
+	assert.NoError(t, err)
+
+	updated := (*requests)[len(*requests)-1]
+	assert.Equal(t, "PUT", updated.method)
+	assert.Equal(t, map[string]interface{}{
+		"title":       "Draft: new title",
+		"description": "new body",
+		"add_labels":  "dependencies",
+	}, updated.body)
+}
+
+func TestItChecksPushPermissionOnGitLab(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/api/v4/projects/org%2Fdeveloper":
+			_, _ = fmt.Fprint(w, `{"permissions": {"project_access": null, "group_access": {"access_level": 30}}}`)
+		default:
+			_, _ = fmt.Fprint(w, `{"permissions": {"project_access": {"access_level": 20}, "group_access": null}}`)
+		}
+	})
+	gitlab := NewGitLab(server.URL, "some-token")
+
+	pushable, err := gitlab.IsPushable(&strings.Builder{}, "org/developer")
+	assert.NoError(t, err)
+	assert.True(t, pushable)
+
+	pushable, err = gitlab.IsPushable(&strings.Builder{}, "org/reporter")
+	assert.NoError(t, err)
+	assert.False(t, pushable)
+}
+
+func TestItRoutesReposToGitLabByHost(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "some-token")
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"default_branch": "develop"}`)
+	})
+	execInstance = executor.NewAlwaysSucceedsFakeExecutor()
+
+	router := NewForgeRouter(&config.Config{Forges: map[string]config.Forge{
+		"gitlab.example.com": {Type: ForgeTypeGitLab, Url: server.URL},
+	}})
+
+	defaultBranch, err := router.GetDefaultBranchName(&strings.Builder{}, "work/org/repo1", "gitlab.example.com/org/repo1")
+	assert.NoError(t, err)
+	assert.Equal(t, "develop", defaultBranch)
+	assert.Equal(t, "/api/v4/projects/org%2Frepo1", (*requests)[0].path)
+}
+
+func TestItKeepsSeparateClientsForHostsWithTheSameForgeConfig(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "some-token")
+	router := NewForgeRouter(&config.Config{Forges: map[string]config.Forge{
+		"gitlab.example.com":       {Type: ForgeTypeGitLab},
+		"gitlab.other.example.com": {Type: ForgeTypeGitLab},
+	}})
+
+	first, err := router.forRepo(&strings.Builder{}, "gitlab.example.com/org/repo1")
+	assert.NoError(t, err)
+	second, err := router.forRepo(&strings.Builder{}, "gitlab.other.example.com/org/repo1")
+	assert.NoError(t, err)
+
+	assert.Equal(t, "https://gitlab.example.com/api/v4", first.(*GitLab).client.baseUrl)
+	assert.Equal(t, "https://gitlab.other.example.com/api/v4", second.(*GitLab).client.baseUrl)
+}
+
+func TestItRejectsADefaultSelfHostedForgeWithoutAUrl(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "some-token")
+	router := NewForgeRouter(&config.Config{Forges: map[string]config.Forge{
+		config.DefaultForge: {Type: ForgeTypeGitLab},
+	}})
+
+	_, err := router.GetDefaultBranchName(&strings.Builder{}, "work/org/repo1", "org/repo1")
+	assert.EqualError(t, err, "the default forge of type gitlab needs a url")
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+// Issues, which turbolift uses to keep a tracking issue listing the PRs of a campaign. Repos are named as in
+// repos.txt, i.e. [host/]owner/repo, and issues are identified by their number within the repo.
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type Issue struct {
+	Number int    `json:"number"`
+	Url    string `json:"url"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+func (r *RealGitHub) CreateIssue(output io.Writer, fullRepoName string, title string, body string) (*Issue, error) {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	execOutput, err := execInstance.ExecuteAndCapture(output, currentDir, "gh", "issue", "create", "--repo", fullRepoName, "--title", title, "--body", body)
+	if err != nil {
+		return nil, err
+	}
+
+	issueUrl := lastLine(execOutput)
+	number, err := strconv.Atoi(issueUrl[strings.LastIndex(issueUrl, "/")+1:])
+	if err != nil {
+		return nil, fmt.Errorf("unexpected output from gh issue create: %s", issueUrl)
+	}
+	return &Issue{Number: number, Url: issueUrl, Title: title, Body: body}, nil
+}
+
+func (r *RealGitHub) GetIssue(output io.Writer, fullRepoName string, number int) (*Issue, error) {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	execOutput, err := execInstance.ExecuteAndCapture(output, currentDir, "gh", "issue", "view", fmt.Sprint(number), "--repo", fullRepoName, "--json", "number,url,title,body")
+	if err != nil {
+		return nil, err
+	}
+
+	var issue Issue
+	if err := json.Unmarshal([]byte(execOutput), &issue); err != nil {
+		return nil, fmt.Errorf("unable to parse gh issue view output: %w", err)
+	}
+	return &issue, nil
+}
+
+func (r *RealGitHub) UpdateIssueBody(output io.Writer, fullRepoName string, number int, body string) error {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	return execInstance.Execute(output, currentDir, "gh", "issue", "edit", fmt.Sprint(number), "--repo", fullRepoName, "--body", body)
+}
+
+// restIssue is an issue as returned by the REST APIs of GitHub and Gitea
+type restIssue struct {
+	Number  int    `json:"number"`
+	HtmlUrl string `json:"html_url"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+}
+
+func (i restIssue) toIssue() *Issue {
+	return &Issue{Number: i.Number, Url: i.HtmlUrl, Title: i.Title, Body: i.Body}
+}
+
+func (r *GitHubAPI) CreateIssue(_ io.Writer, fullRepoName string, title string, body string) (*Issue, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var created restIssue
+	err := r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues", owner, name), map[string]interface{}{
+		"title": title,
+		"body":  body,
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return created.toIssue(), nil
+}
+
+func (r *GitHubAPI) GetIssue(_ io.Writer, fullRepoName string, number int) (*Issue, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var issue restIssue
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("/repos/%s/%s/issues/%d", owner, name, number), nil, &issue); err != nil {
+		return nil, err
+	}
+	return issue.toIssue(), nil
+}
+
+func (r *GitHubAPI) UpdateIssueBody(_ io.Writer, fullRepoName string, number int, body string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPatch, fmt.Sprintf("/repos/%s/%s/issues/%d", owner, name, number), map[string]interface{}{
+		"body": body,
+	}, nil)
+}
+
+// gitLabIssue is a GitLab issue, which is numbered within its project by its iid
+type gitLabIssue struct {
+	Iid         int    `json:"iid"`
+	WebUrl      string `json:"web_url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+}
+
+func (i gitLabIssue) toIssue() *Issue {
+	return &Issue{Number: i.Iid, Url: i.WebUrl, Title: i.Title, Body: i.Description}
+}
+
+func (r *GitLab) CreateIssue(_ io.Writer, fullRepoName string, title string, body string) (*Issue, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var created gitLabIssue
+	err := r.client.do(http.MethodPost, projectPath(owner, name)+"/issues", map[string]interface{}{
+		"title":       title,
+		"description": body,
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return created.toIssue(), nil
+}
+
+func (r *GitLab) GetIssue(_ io.Writer, fullRepoName string, number int) (*Issue, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var issue gitLabIssue
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/issues/%d", projectPath(owner, name), number), nil, &issue); err != nil {
+		return nil, err
+	}
+	return issue.toIssue(), nil
+}
+
+func (r *GitLab) UpdateIssueBody(_ io.Writer, fullRepoName string, number int, body string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPut, fmt.Sprintf("%s/issues/%d", projectPath(owner, name), number), map[string]interface{}{
+		"description": body,
+	}, nil)
+}
+
+// errBitbucketIssues is returned for tracking issues on Bitbucket Server, which leaves issue tracking to Jira
+var errBitbucketIssues = errors.New("issues are not supported by Bitbucket: keep the tracking issue in a repo on another forge")
+
+func (r *Bitbucket) CreateIssue(_ io.Writer, _ string, _ string, _ string) (*Issue, error) {
+	return nil, errBitbucketIssues
+}
+
+func (r *Bitbucket) GetIssue(_ io.Writer, _ string, _ int) (*Issue, error) {
+	return nil, errBitbucketIssues
+}
+
+func (r *Bitbucket) UpdateIssueBody(_ io.Writer, _ string, _ int, _ string) error {
+	return errBitbucketIssues
+}
+
+func (r *Gitea) CreateIssue(_ io.Writer, fullRepoName string, title string, body string) (*Issue, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var created restIssue
+	err := r.client.do(http.MethodPost, giteaRepoPath(owner, name)+"/issues", map[string]interface{}{
+		"title": title,
+		"body":  body,
+	}, &created)
+	if err != nil {
+		return nil, err
+	}
+	return created.toIssue(), nil
+}
+
+func (r *Gitea) GetIssue(_ io.Writer, fullRepoName string, number int) (*Issue, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var issue restIssue
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/issues/%d", giteaRepoPath(owner, name), number), nil, &issue); err != nil {
+		return nil, err
+	}
+	return issue.toIssue(), nil
+}
+
+func (r *Gitea) UpdateIssueBody(_ io.Writer, fullRepoName string, number int, body string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPatch, fmt.Sprintf("%s/issues/%d", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"body": body,
+	}, nil)
+}
+
+func (r *ForgeRouter) CreateIssue(output io.Writer, fullRepoName string, title string, body string) (*Issue, error) {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return nil, err
+	}
+	return backend.CreateIssue(output, fullRepoName, title, body)
+}
+
+func (r *ForgeRouter) GetIssue(output io.Writer, fullRepoName string, number int) (*Issue, error) {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return nil, err
+	}
+	return backend.GetIssue(output, fullRepoName, number)
+}
+
+func (r *ForgeRouter) UpdateIssueBody(output io.Writer, fullRepoName string, number int, body string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.UpdateIssueBody(output, fullRepoName, number, body)
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// prBatchSize is the number of repos looked up in each GraphQL query, which keeps queries well within GitHub's limits
+// on the number of nodes that a query may return
+const prBatchSize = 50
+
+// graphqlRepoPrs is the part of a GraphQL response giving the PRs raised from a branch in one repo
+type graphqlRepoPrs struct {
+	PullRequests struct {
+		Nodes []graphqlPr `json:"nodes"`
+	} `json:"pullRequests"`
+}
+
+// batchPrQuery builds a GraphQL query for the PRs raised from a branch in each of a number of repos. Each repo is
+// given an alias, in the same order as the repos.
+func batchPrQuery(fullRepoNames []string) string {
+	var query strings.Builder
+	query.WriteString("query($branch: String!) {\n")
+	for i, fullRepoName := range fullRepoNames {
+		owner, name := splitRepoName(fullRepoName)
+		_, _ = fmt.Fprintf(&query, "  r%d: repository(owner: %s, name: %s) {\n", i, strconv.Quote(owner), strconv.Quote(name))
+		query.WriteString("    pullRequests(headRefName: $branch, first: 10, orderBy: {field: CREATED_AT, direction: DESC}) {\n")
+		query.WriteString("      nodes {\n        ...prFields\n      }\n    }\n  }\n")
+	}
+	query.WriteString("}\n")
+	query.WriteString(prFieldsFragment)
+	return query.String()
+}
+
+// batchPrResults picks the PR to report for each repo from the response to a batchPrQuery. Repos without a PR are
+// left out.
+func batchPrResults(fullRepoNames []string, data map[string]*graphqlRepoPrs, branchName string) map[string]*PrStatus {
+	results := map[string]*PrStatus{}
+	for i, fullRepoName := range fullRepoNames {
+		repoPrs := data[fmt.Sprintf("r%d", i)]
+		if repoPrs == nil {
+			continue
+		}
+		if pr, err := latestPr(repoPrs.PullRequests.Nodes, fullRepoName, branchName); err == nil {
+			results[fullRepoName] = pr
+		}
+	}
+	return results
+}
+
+// getPRsInBatches looks up the PRs for repos in batches using lookup. When a batch fails, its repos are looked up one
+// at a time, so that one repo that cannot be found does not hide the PRs of the rest. Repos that still cannot be
+// looked up are given with their errors.
+func getPRsInBatches(output io.Writer, fullRepoNames []string, lookup func(fullRepoNames []string) (map[string]*PrStatus, error)) (map[string]*PrStatus, map[string]error) {
+	results := map[string]*PrStatus{}
+	errs := map[string]error{}
+	record := func(batch []string, found map[string]*PrStatus, err error) {
+		if err != nil {
+			_, _ = fmt.Fprintf(output, "Unable to get PR status for %s: %v\n", strings.Join(batch, ", "), err)
+			for _, repo := range batch {
+				errs[repo] = err
+			}
+			return
+		}
+		for repo, pr := range found {
+			results[repo] = pr
+		}
+	}
+
+	for start := 0; start < len(fullRepoNames); start += prBatchSize {
+		batch := fullRepoNames[start:min(start+prBatchSize, len(fullRepoNames))]
+		found, err := lookup(batch)
+		if err != nil && len(batch) > 1 {
+			for _, repo := range batch {
+				found, err := lookup([]string{repo})
+				record([]string{repo}, found, err)
+			}
+			continue
+		}
+		record(batch, found, err)
+	}
+	return results, errs
+}
+
+// getPRsOneByOne looks up the PRs for repos with GetPR, for forges that identify repos by the path of their working
+// copy alone, so that they need not have been cloned. Repos that cannot be looked up are given with their errors.
+func getPRsOneByOne(output io.Writer, backend GitHub, fullRepoNames []string, branchName string) (map[string]*PrStatus, map[string]error) {
+	results := map[string]*PrStatus{}
+	errs := map[string]error{}
+
+	for _, fullRepoName := range fullRepoNames {
+		owner, name := splitRepoName(fullRepoName)
+		pr, err := backend.GetPR(output, path.Join("work", owner, name), fullRepoName, branchName)
+		var noPrErr *NoPRFoundError
+		if errors.As(err, &noPrErr) {
+			continue
+		} else if err != nil {
+			_, _ = fmt.Fprintf(output, "Unable to get PR status for %s: %v\n", fullRepoName, err)
+			errs[fullRepoName] = err
+			continue
+		}
+		results[fullRepoName] = pr
+	}
+	return results, errs
+}
+
+func (r *RealGitHub) GetPRs(output io.Writer, fullRepoNames []string, branchName string) (map[string]*PrStatus, map[string]error, error) {
+	// gh can only talk to one host at a time
+	byHost := map[string][]string{}
+	var hosts []string
+	for _, fullRepoName := range fullRepoNames {
+		host := hostFromRepoName(fullRepoName)
+		if _, ok := byHost[host]; !ok {
+			hosts = append(hosts, host)
+		}
+		byHost[host] = append(byHost[host], fullRepoName)
+	}
+
+	results := map[string]*PrStatus{}
+	errs := map[string]error{}
+	for _, host := range hosts {
+		found, hostErrs := getPRsInBatches(output, byHost[host], func(batch []string) (map[string]*PrStatus, error) {
+			args := []string{"api", "graphql", "-f", "query=" + batchPrQuery(batch), "-f", "branch=" + branchName}
+			if host != "" {
+				args = append(args, "--hostname", host)
+			}
+			s, err := execInstance.ExecuteAndCapture(output, ".", "gh", args...)
+			if err != nil {
+				return nil, err
+			}
+
+			var response struct {
+				Data map[string]*graphqlRepoPrs `json:"data"`
+			}
+			if err := json.Unmarshal([]byte(s), &response); err != nil {
+				return nil, fmt.Errorf("unable to unmarshall the PR status output: %w", err)
+			}
+			return batchPrResults(batch, response.Data, branchName), nil
+		})
+		for repo, pr := range found {
+			results[repo] = pr
+		}
+		for repo, err := range hostErrs {
+			errs[repo] = err
+		}
+	}
+	return results, errs, nil
+}
+
+func (r *GitHubAPI) GetPRs(output io.Writer, fullRepoNames []string, branchName string) (map[string]*PrStatus, map[string]error, error) {
+	results, errs := getPRsInBatches(output, fullRepoNames, func(batch []string) (map[string]*PrStatus, error) {
+		data := map[string]*graphqlRepoPrs{}
+		if err := r.graphql(batchPrQuery(batch), map[string]interface{}{"branch": branchName}, &data); err != nil {
+			return nil, err
+		}
+		return batchPrResults(batch, data, branchName), nil
+	})
+	return results, errs, nil
+}
+
+func (r *GitLab) GetPRs(output io.Writer, fullRepoNames []string, branchName string) (map[string]*PrStatus, map[string]error, error) {
+	results, errs := getPRsOneByOne(output, r, fullRepoNames, branchName)
+	return results, errs, nil
+}
+
+func (r *Bitbucket) GetPRs(output io.Writer, fullRepoNames []string, branchName string) (map[string]*PrStatus, map[string]error, error) {
+	results, errs := getPRsOneByOne(output, r, fullRepoNames, branchName)
+	return results, errs, nil
+}
+
+func (r *Gitea) GetPRs(output io.Writer, fullRepoNames []string, branchName string) (map[string]*PrStatus, map[string]error, error) {
+	results, errs := getPRsOneByOne(output, r, fullRepoNames, branchName)
+	return results, errs, nil
+}
@@ -0,0 +1,133 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/executor"
+)
+
+func TestItQueriesManyReposInOneGraphQLQuery(t *testing.T) {
+	query := batchPrQuery([]string{"org/repo1", "github.example.com/other/repo2"})
+
+	assert.Contains(t, query, `r0: repository(owner: "org", name: "repo1")`)
+	assert.Contains(t, query, `r1: repository(owner: "other", name: "repo2")`)
+	assert.Contains(t, query, "fragment prFields on PullRequest")
+}
+
+func TestItGetsPrsForManyReposThroughGraphQL(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, `{"data": {
+			"r0": {"pullRequests": {"nodes": [
+				{"number": 2, "state": "CLOSED"},
+				{"number": 1, "state": "OPEN", "url": "https://github.com/org/repo1/pull/1"}
+			]}},
+			"r1": {"pullRequests": {"nodes": []}},
+			"r2": {"pullRequests": {"nodes": [{"number": 5, "state": "MERGED", "url": "https://github.com/org/repo3/pull/5"}]}}
+		}}`)
+	})
+
+	prs, errs, err := NewGitHubAPI(server.URL, "some-token").GetPRs(&strings.Builder{}, []string{"org/repo1", "org/repo2", "org/repo3"}, "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Empty(t, errs)
+	assert.Len(t, *requests, 1)
+	assert.Equal(t, map[string]interface{}{"branch": "turbolift-campaign"}, (*requests)[0].body["variables"])
+
+	assert.Len(t, prs, 2)
+	assert.Equal(t, 1, prs["org/repo1"].Number)
+	assert.Equal(t, "OPEN", prs["org/repo1"].State)
+	assert.Equal(t, "MERGED", prs["org/repo3"].State)
+}
+
+func TestItLooksUpReposOneAtATimeWhenABatchFails(t *testing.T) {
+	var requests *[]recordedRequest
+	var server *httptest.Server
+	server, requests = newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// the request has already been recorded, with its body
+		if strings.Contains(fmt.Sprint((*requests)[len(*requests)-1].body["query"]), "missing") {
+			_, _ = fmt.Fprint(w, `{"data": {"r0": null}, "errors": [{"message": "Could not resolve to a Repository"}]}`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `{"data": {"r0": {"pullRequests": {"nodes": [{"number": 1, "state": "OPEN"}]}}}}`)
+	})
+
+	sb := strings.Builder{}
+	prs, errs, err := NewGitHubAPI(server.URL, "some-token").GetPRs(&sb, []string{"org/repo1", "org/missing"}, "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Len(t, *requests, 3)
+	assert.Equal(t, 1, prs["org/repo1"].Number)
+	assert.NotContains(t, prs, "org/missing")
+	assert.Contains(t, errs, "org/missing")
+	assert.NotContains(t, errs, "org/repo1")
+	assert.Contains(t, sb.String(), "Unable to get PR status for org/missing")
+}
+
+func TestItReturnsTheErrorForEachRepoWhosePrCannotBeLookedUp(t *testing.T) {
+	server, _ := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = fmt.Fprint(w, `{"message": "Bad credentials"}`)
+	})
+
+	prs, errs, err := NewGitHubAPI(server.URL, "some-token").GetPRs(&strings.Builder{}, []string{"org/repo1", "org/repo2"}, "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Empty(t, prs)
+	assert.Len(t, errs, 2)
+	var apiErr *APIError
+	assert.True(t, errors.As(errs["org/repo2"], &apiErr))
+}
+
+func TestItGetsPrsForManyReposWithGhPerHost(t *testing.T) {
+	fakeExecutor := executor.NewFakeExecutor(func(workingDir string, name string, args ...string) error {
+		return nil
+	}, func(workingDir string, name string, args ...string) (string, error) {
+		return `{"data": {"r0": {"pullRequests": {"nodes": [{"number": 1, "state": "OPEN"}]}}}}`, nil
+	})
+	execInstance = fakeExecutor
+
+	prs, _, err := NewRealGitHub().GetPRs(&strings.Builder{}, []string{"org/repo1", "github.example.com/org/repo2"}, "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, prs["org/repo1"].Number)
+	assert.Equal(t, 1, prs["github.example.com/org/repo2"].Number)
+
+	fakeExecutor.AssertCalledWith(t, [][]string{
+		{".", "gh", "api", "graphql", "-f", "query=" + batchPrQuery([]string{"org/repo1"}), "-f", "branch=turbolift-campaign"},
+		{".", "gh", "api", "graphql", "-f", "query=" + batchPrQuery([]string{"github.example.com/org/repo2"}), "-f", "branch=turbolift-campaign", "--hostname", "github.example.com"},
+	})
+}
+
+func TestItGetsPrsForReposOnOtherForgesWithoutWorkingCopies(t *testing.T) {
+	server, requests := newApiServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/repos/org/repo1/pulls" {
+			_, _ = fmt.Fprint(w, `[{"number": 2, "state": "open", "head": {"ref": "turbolift-campaign"}}]`)
+			return
+		}
+		_, _ = fmt.Fprint(w, `[]`)
+	})
+
+	prs, _, err := NewGitea(server.URL, "some-token").GetPRs(&strings.Builder{}, []string{"gitea.example.com/org/repo1", "gitea.example.com/org/repo2"}, "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Len(t, prs, 1)
+	assert.Equal(t, 2, prs["gitea.example.com/org/repo1"].Number)
+	assert.Equal(t, "/api/v1/repos/org/repo2/pulls?limit=50&page=1&sort=recentupdate&state=all", (*requests)[len(*requests)-1].path)
+}
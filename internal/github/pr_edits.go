@@ -0,0 +1,435 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+// Labels, reviewers and assignees of existing PRs, which are identified by their number within a repo named as in
+// repos.txt, i.e. [host/]owner/repo. Reviewers given as org/team are teams, and all others are users.
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// splitReviewers separates the users among a list of reviewers from the teams, which are named as org/team
+func splitReviewers(reviewers []string) (users []string, teams []string) {
+	users, teams = []string{}, []string{}
+	for _, reviewer := range reviewers {
+		if strings.Contains(reviewer, "/") {
+			teams = append(teams, reviewer)
+		} else {
+			users = append(users, reviewer)
+		}
+	}
+	return users, teams
+}
+
+// teamSlugs drops the org from teams named as org/team, as the GitHub and Gitea APIs expect
+func teamSlugs(teams []string) []string {
+	slugs := []string{}
+	for _, team := range teams {
+		slugs = append(slugs, team[strings.LastIndex(team, "/")+1:])
+	}
+	return slugs
+}
+
+func (r *RealGitHub) editPR(output io.Writer, fullRepoName string, number int, flag string, values []string) error {
+	currentDir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	args := []string{"pr", "edit", fmt.Sprint(number), "--repo", fullRepoName}
+	for _, value := range values {
+		args = append(args, flag, value)
+	}
+	return execInstance.Execute(output, currentDir, "gh", args...)
+}
+
+func (r *RealGitHub) AddLabels(output io.Writer, fullRepoName string, number int, labels []string) error {
+	return r.editPR(output, fullRepoName, number, "--add-label", labels)
+}
+
+func (r *RealGitHub) RemoveLabels(output io.Writer, fullRepoName string, number int, labels []string) error {
+	return r.editPR(output, fullRepoName, number, "--remove-label", labels)
+}
+
+func (r *RealGitHub) AddReviewers(output io.Writer, fullRepoName string, number int, reviewers []string) error {
+	return r.editPR(output, fullRepoName, number, "--add-reviewer", reviewers)
+}
+
+func (r *RealGitHub) RemoveReviewers(output io.Writer, fullRepoName string, number int, reviewers []string) error {
+	return r.editPR(output, fullRepoName, number, "--remove-reviewer", reviewers)
+}
+
+func (r *RealGitHub) AddAssignees(output io.Writer, fullRepoName string, number int, assignees []string) error {
+	return r.editPR(output, fullRepoName, number, "--add-assignee", assignees)
+}
+
+func (r *RealGitHub) RemoveAssignees(output io.Writer, fullRepoName string, number int, assignees []string) error {
+	return r.editPR(output, fullRepoName, number, "--remove-assignee", assignees)
+}
+
+func (r *GitHubAPI) AddLabels(_ io.Writer, fullRepoName string, number int, labels []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues/%d/labels", owner, name, number), map[string]interface{}{
+		"labels": labels,
+	}, nil)
+}
+
+// RemoveLabels removes labels one at a time, ignoring any that the PR does not have
+func (r *GitHubAPI) RemoveLabels(_ io.Writer, fullRepoName string, number int, labels []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	for _, label := range labels {
+		err := r.client.do(http.MethodDelete, fmt.Sprintf("/repos/%s/%s/issues/%d/labels/%s", owner, name, number, url.PathEscape(label)), nil, nil)
+		var apiErr *APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *GitHubAPI) AddReviewers(_ io.Writer, fullRepoName string, number int, reviewers []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	users, teams := splitReviewers(reviewers)
+	return r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/pulls/%d/requested_reviewers", owner, name, number), map[string]interface{}{
+		"reviewers":      users,
+		"team_reviewers": teamSlugs(teams),
+	}, nil)
+}
+
+func (r *GitHubAPI) RemoveReviewers(_ io.Writer, fullRepoName string, number int, reviewers []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	users, teams := splitReviewers(reviewers)
+	return r.client.do(http.MethodDelete, fmt.Sprintf("/repos/%s/%s/pulls/%d/requested_reviewers", owner, name, number), map[string]interface{}{
+		"reviewers":      users,
+		"team_reviewers": teamSlugs(teams),
+	}, nil)
+}
+
+func (r *GitHubAPI) AddAssignees(_ io.Writer, fullRepoName string, number int, assignees []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPost, fmt.Sprintf("/repos/%s/%s/issues/%d/assignees", owner, name, number), map[string]interface{}{
+		"assignees": assignees,
+	}, nil)
+}
+
+func (r *GitHubAPI) RemoveAssignees(_ io.Writer, fullRepoName string, number int, assignees []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodDelete, fmt.Sprintf("/repos/%s/%s/issues/%d/assignees", owner, name, number), map[string]interface{}{
+		"assignees": assignees,
+	}, nil)
+}
+
+func (r *GitLab) updateMergeRequest(fullRepoName string, number int, request map[string]interface{}) error {
+	owner, name := splitRepoName(fullRepoName)
+	return r.client.do(http.MethodPut, fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, name), number), request, nil)
+}
+
+func (r *GitLab) getMergeRequest(fullRepoName string, number int) (*gitLabMergeRequest, error) {
+	owner, name := splitRepoName(fullRepoName)
+	var mergeRequest gitLabMergeRequest
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/merge_requests/%d", projectPath(owner, name), number), nil, &mergeRequest); err != nil {
+		return nil, err
+	}
+	return &mergeRequest, nil
+}
+
+func (r *GitLab) AddLabels(_ io.Writer, fullRepoName string, number int, labels []string) error {
+	return r.updateMergeRequest(fullRepoName, number, map[string]interface{}{"add_labels": strings.Join(labels, ",")})
+}
+
+func (r *GitLab) RemoveLabels(_ io.Writer, fullRepoName string, number int, labels []string) error {
+	return r.updateMergeRequest(fullRepoName, number, map[string]interface{}{"remove_labels": strings.Join(labels, ",")})
+}
+
+func (r *GitLab) AddReviewers(output io.Writer, fullRepoName string, number int, reviewers []string) error {
+	users, teams := splitReviewers(reviewers)
+	if len(teams) > 0 {
+		_, _ = fmt.Fprintln(output, "GitLab does not support team reviewers; ignoring", strings.Join(teams, ", "))
+	}
+	existing, err := r.getMergeRequest(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	ids, err := r.userIds(existing.Reviewers, users)
+	if err != nil {
+		return err
+	}
+	return r.updateMergeRequest(fullRepoName, number, map[string]interface{}{"reviewer_ids": ids})
+}
+
+func (r *GitLab) RemoveReviewers(_ io.Writer, fullRepoName string, number int, reviewers []string) error {
+	existing, err := r.getMergeRequest(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	removed := map[string]bool{}
+	for _, reviewer := range reviewers {
+		removed[reviewer] = true
+	}
+	ids := []int{}
+	for _, user := range existing.Reviewers {
+		if !removed[user.Username] {
+			ids = append(ids, user.Id)
+		}
+	}
+	return r.updateMergeRequest(fullRepoName, number, map[string]interface{}{"reviewer_ids": ids})
+}
+
+func (r *GitLab) AddAssignees(_ io.Writer, fullRepoName string, number int, assignees []string) error {
+	existing, err := r.getMergeRequest(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	ids, err := r.userIds(existing.Assignees, assignees)
+	if err != nil {
+		return err
+	}
+	return r.updateMergeRequest(fullRepoName, number, map[string]interface{}{"assignee_ids": ids})
+}
+
+func (r *GitLab) RemoveAssignees(_ io.Writer, fullRepoName string, number int, assignees []string) error {
+	existing, err := r.getMergeRequest(fullRepoName, number)
+	if err != nil {
+		return err
+	}
+	removed := map[string]bool{}
+	for _, assignee := range assignees {
+		removed[assignee] = true
+	}
+	ids := []int{}
+	for _, user := range existing.Assignees {
+		if !removed[user.Username] {
+			ids = append(ids, user.Id)
+		}
+	}
+	return r.updateMergeRequest(fullRepoName, number, map[string]interface{}{"assignee_ids": ids})
+}
+
+// errBitbucketLabelsAndAssignees is returned when editing the labels or assignees of a Bitbucket PR, which has neither
+var errBitbucketLabelsAndAssignees = errors.New("labels and assignees are not supported by Bitbucket PRs")
+
+func (r *Bitbucket) AddLabels(_ io.Writer, _ string, _ int, _ []string) error {
+	return errBitbucketLabelsAndAssignees
+}
+
+func (r *Bitbucket) RemoveLabels(_ io.Writer, _ string, _ int, _ []string) error {
+	return errBitbucketLabelsAndAssignees
+}
+
+func (r *Bitbucket) AddAssignees(_ io.Writer, _ string, _ int, _ []string) error {
+	return errBitbucketLabelsAndAssignees
+}
+
+func (r *Bitbucket) RemoveAssignees(_ io.Writer, _ string, _ int, _ []string) error {
+	return errBitbucketLabelsAndAssignees
+}
+
+// updateReviewers replaces the reviewers of a PR with those that keep returns true for, followed by the added ones
+func (r *Bitbucket) updateReviewers(fullRepoName string, number int, keep func(string) bool, added []string) error {
+	project, slug := splitRepoName(fullRepoName)
+	var existing bitbucketPullRequest
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/pull-requests/%d", repoPath(project, slug), number), nil, &existing); err != nil {
+		return err
+	}
+
+	reviewers := []bitbucketReviewer{}
+	known := map[string]bool{}
+	for _, reviewer := range existing.Reviewers {
+		if keep(reviewer.User.Name) {
+			reviewers = append(reviewers, bitbucketReviewer{User: reviewer.User})
+			known[reviewer.User.Name] = true
+		}
+	}
+	for _, name := range added {
+		if !known[name] {
+			reviewer := bitbucketReviewer{}
+			reviewer.User.Name = name
+			reviewers = append(reviewers, reviewer)
+			known[name] = true
+		}
+	}
+
+	return r.client.do(http.MethodPut, fmt.Sprintf("%s/pull-requests/%d", repoPath(project, slug), number), map[string]interface{}{
+		"version":     existing.Version,
+		"title":       existing.Title,
+		"description": existing.Description,
+		"reviewers":   reviewers,
+	}, nil)
+}
+
+func (r *Bitbucket) AddReviewers(output io.Writer, fullRepoName string, number int, reviewers []string) error {
+	users, teams := splitReviewers(reviewers)
+	if len(teams) > 0 {
+		_, _ = fmt.Fprintln(output, "Bitbucket does not support team reviewers; ignoring", strings.Join(teams, ", "))
+	}
+	return r.updateReviewers(fullRepoName, number, func(string) bool { return true }, users)
+}
+
+func (r *Bitbucket) RemoveReviewers(_ io.Writer, fullRepoName string, number int, reviewers []string) error {
+	removed := map[string]bool{}
+	for _, reviewer := range reviewers {
+		removed[reviewer] = true
+	}
+	return r.updateReviewers(fullRepoName, number, func(name string) bool { return !removed[name] }, nil)
+}
+
+func (r *Gitea) AddLabels(_ io.Writer, fullRepoName string, number int, labels []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	ids, err := r.labelIds(owner, name, labels)
+	if err != nil {
+		return err
+	}
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/issues/%d/labels", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"labels": ids,
+	}, nil)
+}
+
+func (r *Gitea) RemoveLabels(_ io.Writer, fullRepoName string, number int, labels []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	ids, err := r.labelIds(owner, name, labels)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if err := r.client.do(http.MethodDelete, fmt.Sprintf("%s/issues/%d/labels/%d", giteaRepoPath(owner, name), number, id), nil, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Gitea) AddReviewers(_ io.Writer, fullRepoName string, number int, reviewers []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	users, teams := splitReviewers(reviewers)
+	return r.client.do(http.MethodPost, fmt.Sprintf("%s/pulls/%d/requested_reviewers", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"reviewers":      users,
+		"team_reviewers": teamSlugs(teams),
+	}, nil)
+}
+
+func (r *Gitea) RemoveReviewers(_ io.Writer, fullRepoName string, number int, reviewers []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	users, teams := splitReviewers(reviewers)
+	return r.client.do(http.MethodDelete, fmt.Sprintf("%s/pulls/%d/requested_reviewers", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"reviewers":      users,
+		"team_reviewers": teamSlugs(teams),
+	}, nil)
+}
+
+// AddAssignees keeps the existing assignees of a PR, as Gitea replaces them all when assignees are given
+func (r *Gitea) AddAssignees(_ io.Writer, fullRepoName string, number int, assignees []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	var existing giteaPullRequest
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/pulls/%d", giteaRepoPath(owner, name), number), nil, &existing); err != nil {
+		return err
+	}
+
+	logins := []string{}
+	known := map[string]bool{}
+	for _, user := range existing.Assignees {
+		logins = append(logins, user.Login)
+		known[user.Login] = true
+	}
+	for _, assignee := range assignees {
+		if !known[assignee] {
+			logins = append(logins, assignee)
+			known[assignee] = true
+		}
+	}
+	return r.client.do(http.MethodPatch, fmt.Sprintf("%s/issues/%d", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"assignees": logins,
+	}, nil)
+}
+
+// RemoveAssignees keeps the other assignees of a PR, as Gitea replaces them all when assignees are given
+func (r *Gitea) RemoveAssignees(_ io.Writer, fullRepoName string, number int, assignees []string) error {
+	owner, name := splitRepoName(fullRepoName)
+	var existing giteaPullRequest
+	if err := r.client.do(http.MethodGet, fmt.Sprintf("%s/pulls/%d", giteaRepoPath(owner, name), number), nil, &existing); err != nil {
+		return err
+	}
+
+	removed := map[string]bool{}
+	for _, assignee := range assignees {
+		removed[assignee] = true
+	}
+	logins := []string{}
+	for _, user := range existing.Assignees {
+		if !removed[user.Login] {
+			logins = append(logins, user.Login)
+		}
+	}
+	return r.client.do(http.MethodPatch, fmt.Sprintf("%s/issues/%d", giteaRepoPath(owner, name), number), map[string]interface{}{
+		"assignees": logins,
+	}, nil)
+}
+
+func (r *ForgeRouter) AddLabels(output io.Writer, fullRepoName string, number int, labels []string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.AddLabels(output, fullRepoName, number, labels)
+}
+
+func (r *ForgeRouter) RemoveLabels(output io.Writer, fullRepoName string, number int, labels []string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.RemoveLabels(output, fullRepoName, number, labels)
+}
+
+func (r *ForgeRouter) AddReviewers(output io.Writer, fullRepoName string, number int, reviewers []string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.AddReviewers(output, fullRepoName, number, reviewers)
+}
+
+func (r *ForgeRouter) RemoveReviewers(output io.Writer, fullRepoName string, number int, reviewers []string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.RemoveReviewers(output, fullRepoName, number, reviewers)
+}
+
+func (r *ForgeRouter) AddAssignees(output io.Writer, fullRepoName string, number int, assignees []string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.AddAssignees(output, fullRepoName, number, assignees)
+}
+
+func (r *ForgeRouter) RemoveAssignees(output io.Writer, fullRepoName string, number int, assignees []string) error {
+	backend, err := r.forRepo(output, fullRepoName)
+	if err != nil {
+		return err
+	}
+	return backend.RemoveAssignees(output, fullRepoName, number, assignees)
+}
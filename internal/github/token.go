@@ -0,0 +1,93 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// gitHubToken finds a token for the GitHub API on a host. It is read from the named environment variable if there is
+// one, then the environment variables used by gh, and finally the configuration of gh itself.
+func gitHubToken(output io.Writer, host string, tokenEnv string) (string, error) {
+	if tokenEnv != "" {
+		if token := os.Getenv(tokenEnv); token != "" {
+			return token, nil
+		}
+		return "", fmt.Errorf("no token found in environment variable %s", tokenEnv)
+	}
+
+	envVars := []string{"GH_ENTERPRISE_TOKEN", "GITHUB_ENTERPRISE_TOKEN"}
+	if host == "github.com" {
+		envVars = []string{"GH_TOKEN", "GITHUB_TOKEN"}
+	}
+	for _, envVar := range envVars {
+		if token := os.Getenv(envVar); token != "" {
+			return token, nil
+		}
+	}
+
+	if token := ghConfigToken(host); token != "" {
+		return token, nil
+	}
+
+	// recent versions of gh keep the token in the system keyring rather than in its configuration
+	token, err := execInstance.ExecuteAndCapture(output, ".", "gh", "auth", "token", "--hostname", host)
+	if err != nil || strings.TrimSpace(token) == "" {
+		return "", fmt.Errorf("no token found for %s: set GH_TOKEN or run gh auth login", host)
+	}
+	return strings.TrimSpace(token), nil
+}
+
+// ghConfigToken reads the token for a host from gh's hosts.yml, if it is stored there
+func ghConfigToken(host string) string {
+	configDir := os.Getenv("GH_CONFIG_DIR")
+	if configDir == "" {
+		if xdgConfigHome := os.Getenv("XDG_CONFIG_HOME"); xdgConfigHome != "" {
+			configDir = filepath.Join(xdgConfigHome, "gh")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			configDir = filepath.Join(home, ".config", "gh")
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(configDir, "hosts.yml"))
+	if err != nil {
+		return ""
+	}
+	var hosts map[string]struct {
+		OauthToken string `yaml:"oauth_token"`
+	}
+	if err := yaml.Unmarshal(content, &hosts); err != nil {
+		return ""
+	}
+	return hosts[host].OauthToken
+}
+
+// envToken reads an API token from the named environment variable, or if none is named, from defaultEnv
+func envToken(tokenEnv string, defaultEnv string) (string, error) {
+	if tokenEnv == "" {
+		tokenEnv = defaultEnv
+	}
+	if token := os.Getenv(tokenEnv); token != "" {
+		return token, nil
+	}
+	return "", fmt.Errorf("no token found in environment variable %s", tokenEnv)
+}
@@ -17,7 +17,10 @@
 
 package github
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"strings"
+)
 
 type ViewerPermission struct {
 	ViewerPermission string `json:"viewerPermission"`
@@ -40,3 +43,22 @@ func userHasPushPermission(viewerPermissionOutput string) (bool, error) {
 		return false, nil
 	}
 }
+
+// lastLine returns the last non-blank line of some command output, e.g. the URL printed by `gh pr create`
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// qualifiedTeamName returns the name of a team in the form org/team that gh expects, assuming that teams that are
+// not already qualified belong to the organisation that owns the repo.
+func qualifiedTeamName(fullRepoName string, team string) string {
+	if strings.Contains(team, "/") {
+		return team
+	}
+	parts := strings.Split(fullRepoName, "/")
+	if len(parts) < 2 {
+		return team
+	}
+	return parts[len(parts)-2] + "/" + team
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package github
+
+// Helpers for the API backends, which need to inspect and set up working copies themselves rather than leaving that
+// to a forge's CLI.
+
+import (
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// splitRepoName returns the owner and name of a repo from a name of the form [host/]owner/repo. The owner keeps
+// every segment between the host and the name, so that GitLab projects in subgroups (host/group/subgroup/repo) are
+// found by their full path.
+func splitRepoName(fullRepoName string) (string, string) {
+	parts := strings.Split(fullRepoName, "/")
+	if len(parts) > 2 {
+		parts = parts[1:]
+	}
+	return splitRepoPath(strings.Join(parts, "/"))
+}
+
+// splitRepoPath returns the owner and name of a repo from its path on the host, i.e. owner/repo, where the owner may
+// itself contain slashes
+func splitRepoPath(repoPath string) (string, string) {
+	i := strings.LastIndex(repoPath, "/")
+	if i < 0 {
+		return "", repoPath
+	}
+	return repoPath[:i], repoPath[i+1:]
+}
+
+// hostFromRepoName returns the host given in a repo name of the form host/owner/repo, or "" if there is none
+func hostFromRepoName(fullRepoName string) string {
+	parts := strings.Split(fullRepoName, "/")
+	if len(parts) > 2 {
+		return parts[0]
+	}
+	return ""
+}
+
+// parseRemoteUrl returns the host and path of a git remote URL, in any of the forms
+// https://host/owner/repo.git, ssh://git@host:port/owner/repo.git or git@host:owner/repo.git
+func parseRemoteUrl(remoteUrl string) (string, string) {
+	remoteUrl = strings.TrimSuffix(strings.TrimSpace(remoteUrl), ".git")
+	if i := strings.Index(remoteUrl, "://"); i >= 0 {
+		hostAndPath := remoteUrl[i+3:]
+		host, path, _ := strings.Cut(hostAndPath, "/")
+		if at := strings.LastIndex(host, "@"); at >= 0 {
+			host = host[at+1:]
+		}
+		if colon := strings.Index(host, ":"); colon >= 0 {
+			host = host[:colon]
+		}
+		return host, path
+	}
+	host, path, _ := strings.Cut(remoteUrl, ":")
+	if at := strings.LastIndex(host, "@"); at >= 0 {
+		host = host[at+1:]
+	}
+	return host, path
+}
+
+func currentBranch(output io.Writer, workingDir string) (string, error) {
+	branch, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "rev-parse", "--abbrev-ref", "HEAD")
+	return strings.TrimSpace(branch), err
+}
+
+// originOwner returns the owner of the repo that the working copy pushes to, which differs from the upstream owner
+// when the repo has been forked
+func originOwner(output io.Writer, workingDir string) (string, error) {
+	remoteUrl, err := execInstance.ExecuteAndCapture(output, workingDir, "git", "remote", "get-url", "origin")
+	if err != nil {
+		return "", err
+	}
+	_, path := parseRemoteUrl(remoteUrl)
+	owner, _ := splitRepoPath(path)
+	return owner, nil
+}
+
+// cloneRepo clones a repo into workingDir/name. If upstreamUrl is given, it is added as the upstream remote, as it
+// is when gh clones a fork.
+func cloneRepo(output io.Writer, workingDir string, cloneUrl string, name string, upstreamUrl string) error {
+	if err := execInstance.Execute(output, workingDir, "git", "clone", cloneUrl, name); err != nil {
+		return err
+	}
+	if upstreamUrl == "" {
+		return nil
+	}
+	repoDir := filepath.Join(workingDir, name)
+	if err := execInstance.Execute(output, repoDir, "git", "remote", "add", "upstream", upstreamUrl); err != nil {
+		return err
+	}
+	return execInstance.Execute(output, repoDir, "git", "fetch", "upstream")
+}
@@ -30,6 +30,7 @@ type Activity struct {
 	name    string
 	logs    []string
 	spinner *spinner.Spinner
+	group   *ActivityGroup
 	writer  io.Writer
 	verbose bool
 }
@@ -51,30 +52,36 @@ func (a *Activity) emitLogs(colourTransform func(...interface{}) string) {
 	}
 }
 
-func (a *Activity) EndWithSuccess() {
-	a.spinner.FinalMSG = fmt.Sprintf("%s %s", colors.Pass("  OK  "), a.name)
+// end displays the final message for the Activity, followed by its buffered logs if logColour is not nil.
+func (a *Activity) end(message string, logColour func(...interface{}) string) {
+	if a.group != nil {
+		a.group.end(a, message, logColour)
+		return
+	}
+
+	a.spinner.FinalMSG = message
 	a.spinner.Stop()
 	_, _ = fmt.Fprintln(a.writer)
 
+	if logColour != nil {
+		a.emitLogs(logColour)
+	}
+}
+
+func (a *Activity) EndWithSuccess() {
+	var logColour func(...interface{}) string
 	if a.verbose {
-		a.emitLogs(colors.White)
+		logColour = colors.White
 	}
+	a.end(fmt.Sprintf("%s %s", colors.Pass("  OK  "), a.name), logColour)
 }
 
 func (a *Activity) EndWithSuccessAndEmitLogs() {
-	a.spinner.FinalMSG = fmt.Sprintf("%s %s", colors.Pass("  OK  "), a.name)
-	a.spinner.Stop()
-	_, _ = fmt.Fprintln(a.writer)
-
-	a.emitLogs(colors.White)
+	a.end(fmt.Sprintf("%s %s", colors.Pass("  OK  "), a.name), colors.White)
 }
 
 func (a *Activity) EndWithWarning(message interface{}) {
-	a.spinner.FinalMSG = fmt.Sprintf(colors.Warn(" WARN ")+colors.Yellow(" %s: %s"), a.name, message)
-	a.spinner.Stop()
-	_, _ = fmt.Fprintln(a.writer)
-
-	a.emitLogs(colors.Yellow)
+	a.end(fmt.Sprintf(colors.Warn(" WARN ")+colors.Yellow(" %s: %s"), a.name, message), colors.Yellow)
 }
 
 func (a *Activity) EndWithWarningf(format string, args ...interface{}) {
@@ -82,11 +89,7 @@ func (a *Activity) EndWithWarningf(format string, args ...interface{}) {
 }
 
 func (a *Activity) EndWithFailure(message interface{}) {
-	a.spinner.FinalMSG = fmt.Sprintf(colors.Fail(" FAIL ")+colors.Red(" %s: %s"), a.name, message)
-	a.spinner.Stop()
-	_, _ = fmt.Fprintln(a.writer)
-
-	a.emitLogs(colors.Red)
+	a.end(fmt.Sprintf(colors.Fail(" FAIL ")+colors.Red(" %s: %s"), a.name, message), colors.Red)
 }
 
 func (a *Activity) EndWithFailuref(format string, args ...interface{}) {
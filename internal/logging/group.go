@@ -0,0 +1,163 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/briandowns/spinner"
+	"github.com/mattn/go-isatty"
+
+	"github.com/skyscanner/turbolift/internal/colors"
+)
+
+// ActivityGroup displays any number of concurrently running Activities.
+// Each running Activity is shown on its own line below the output of those that have already completed, so that
+// their progress indicators do not overwrite one another. When the output is not a terminal, only the final state of
+// each Activity is written.
+type ActivityGroup struct {
+	mu      sync.Mutex
+	writer  io.Writer
+	verbose bool
+	running []*Activity
+	drawn   int
+	frame   int
+	animate bool
+	stop    chan struct{}
+	stopped chan struct{}
+}
+
+// StartActivityGroup creates and starts an *ActivityGroup.
+// No other logging should be performed using this Logger until the group has been ended.
+func (log *Logger) StartActivityGroup() *ActivityGroup {
+	g := &ActivityGroup{
+		writer:  log.writer,
+		verbose: log.verbose,
+		animate: isTerminal(log.writer),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if g.animate {
+		_, _ = fmt.Fprint(g.writer, "\033[?25l") // hide the cursor while redrawing
+		go g.redrawPeriodically()
+	} else {
+		close(g.stopped)
+	}
+
+	return g
+}
+
+// StartActivity creates an *Activity that is displayed as part of this group.
+// Unlike Logger.StartActivity, it is safe to have many of these active at once, from different goroutines.
+func (g *ActivityGroup) StartActivity(format string, args ...interface{}) *Activity {
+	a := &Activity{
+		name:    fmt.Sprintf(format, args...),
+		logs:    []string{},
+		group:   g,
+		writer:  g.writer,
+		verbose: g.verbose,
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.running = append(g.running, a)
+	g.erase()
+	g.redraw()
+
+	return a
+}
+
+// End stops the group's progress display. All Activities in the group should have been ended beforehand.
+func (g *ActivityGroup) End() {
+	if g.animate {
+		close(g.stop)
+	}
+	<-g.stopped
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.erase()
+	if g.animate {
+		_, _ = fmt.Fprint(g.writer, "\033[?25h")
+	}
+}
+
+func (g *ActivityGroup) end(a *Activity, message string, logColour func(...interface{}) string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for i, running := range g.running {
+		if running == a {
+			g.running = append(g.running[:i], g.running[i+1:]...)
+			break
+		}
+	}
+
+	g.erase()
+	_, _ = fmt.Fprintln(g.writer, message)
+	if logColour != nil {
+		a.emitLogs(logColour)
+	}
+	g.redraw()
+}
+
+func (g *ActivityGroup) redrawPeriodically() {
+	defer close(g.stopped)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			g.mu.Lock()
+			g.frame++
+			g.erase()
+			g.redraw()
+			g.mu.Unlock()
+		}
+	}
+}
+
+// erase removes the lines showing running activities. Caller must hold g.mu.
+func (g *ActivityGroup) erase() {
+	for ; g.drawn > 0; g.drawn-- {
+		_, _ = fmt.Fprint(g.writer, "\033[1A\033[2K")
+	}
+}
+
+// redraw writes one line per running activity. Caller must hold g.mu and have erased any previous lines.
+func (g *ActivityGroup) redraw() {
+	if !g.animate {
+		return
+	}
+	chars := spinner.CharSets[11]
+	for _, a := range g.running {
+		_, _ = fmt.Fprintf(g.writer, "%s  %s\n", colors.Cyan(chars[g.frame%len(chars)]), a.name)
+	}
+	g.drawn = len(g.running)
+}
+
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	return ok && isatty.IsTerminal(f.Fd())
+}
@@ -0,0 +1,44 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package logging
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// linesOnScreen counts the lines left on screen by output that moves the cursor up a line to erase it
+func linesOnScreen(output string) int {
+	return strings.Count(output, "\n") - strings.Count(output, "\033[1A")
+}
+
+func TestItShowsEachRunningActivityOnceWhenAnimated(t *testing.T) {
+	out := &bytes.Buffer{}
+	g := &ActivityGroup{writer: out, animate: true}
+
+	first := g.StartActivity("first")
+	g.StartActivity("second")
+	g.StartActivity("third")
+	assert.Equal(t, 3, linesOnScreen(out.String()))
+
+	first.EndWithSuccess()
+	// the ended activity is written above the two that are still running
+	assert.Equal(t, 3, linesOnScreen(out.String()))
+	assert.Equal(t, 2, g.drawn)
+}
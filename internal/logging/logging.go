@@ -41,6 +41,23 @@ func NewLogger(c *cobra.Command) *Logger {
 	}
 }
 
+// NewStderrLogger creates a Logger associated with a particular *cobra.Command instance, which delivers logs to the
+// command's stderr writer. This leaves stdout free for output that is to be read by other programs.
+func NewStderrLogger(c *cobra.Command) *Logger {
+	return &Logger{
+		writer:  c.ErrOrStderr(),
+		verbose: flags.Verbose,
+	}
+}
+
+// NewWriterLogger creates a Logger that delivers logs to w
+func NewWriterLogger(w io.Writer) *Logger {
+	return &Logger{
+		writer:  w,
+		verbose: flags.Verbose,
+	}
+}
+
 func (log *Logger) Printf(s string, args ...interface{}) {
 	_, _ = fmt.Fprintf(log.writer, s, args...)
 	_, _ = fmt.Fprintln(log.writer)
@@ -85,6 +102,11 @@ func (log *Logger) StartActivity(format string, args ...interface{}) *Activity {
 	}
 }
 
+// IsTerminal reports whether logs are delivered to a terminal, rather than to a file or pipe
+func (log *Logger) IsTerminal() bool {
+	return isTerminal(log.writer)
+}
+
 func (log *Logger) Writer() io.Writer {
 	return log.writer
 }
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package state
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// DefaultHistoryFilename is where the snapshots of a campaign's PRs are kept, one JSON object per line
+const DefaultHistoryFilename = ".turbolift_history.jsonl"
+
+// Snapshot records the state of the PRs of every repo in a campaign at a point in time
+type Snapshot struct {
+	At    time.Time             `json:"at"`
+	Repos map[string]PrSnapshot `json:"repos"`
+}
+
+// PrSnapshot is the state of a single repo's PR. State is NO_PR if no PR could be found for the repo. The times are
+// left out when they are not known.
+type PrSnapshot struct {
+	State          string     `json:"state"`
+	Number         int        `json:"number,omitempty"`
+	Url            string     `json:"url,omitempty"`
+	ReviewDecision string     `json:"reviewDecision,omitempty"`
+	Checks         string     `json:"checks,omitempty"`
+	CreatedAt      *time.Time `json:"createdAt,omitempty"`
+	MergedAt       *time.Time `json:"mergedAt,omitempty"`
+	ClosedAt       *time.Time `json:"closedAt,omitempty"`
+	FirstReviewAt  *time.Time `json:"firstReviewAt,omitempty"`
+	// Reactions counts the reactions to the PR by their content, e.g. THUMBS_UP
+	Reactions map[string]int `json:"reactions,omitempty"`
+}
+
+// OptionalTime returns a pointer to t, or nil if t is zero, for use in a PrSnapshot
+func OptionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
+
+// AppendSnapshot adds a snapshot to the end of the history file, creating the file if need be
+func AppendSnapshot(filename string, snapshot Snapshot) error {
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(filename, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return fmt.Errorf("unable to write history file %s: %w", filename, err)
+	}
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("unable to write history file %s: %w", filename, err)
+	}
+	return file.Close()
+}
+
+// RecordSnapshot adds a snapshot to the end of the history file like AppendSnapshot, first carrying over from the
+// latest snapshot any repos that it leaves out, so that a snapshot of only some of a campaign's repos, such as one
+// taken with a smaller repos file, does not drop the rest of the campaign from the history
+func RecordSnapshot(filename string, snapshot Snapshot) error {
+	history, err := LoadHistory(filename)
+	if err != nil {
+		return err
+	}
+	if len(history) > 0 {
+		for repo, pr := range history[len(history)-1].Repos {
+			if _, ok := snapshot.Repos[repo]; !ok {
+				snapshot.Repos[repo] = pr
+			}
+		}
+	}
+	return AppendSnapshot(filename, snapshot)
+}
+
+// LoadHistory reads all the snapshots in the history file, oldest first. A missing file is not an error: it results
+// in an empty history.
+func LoadHistory(filename string) ([]Snapshot, error) {
+	file, err := os.Open(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read history file %s: %w", filename, err)
+	}
+	defer func() {
+		_ = file.Close()
+	}()
+
+	var history []Snapshot
+	scanner := bufio.NewScanner(file)
+	// a snapshot of a large campaign is a long line
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var snapshot Snapshot
+		if err := json.Unmarshal(scanner.Bytes(), &snapshot); err != nil {
+			return nil, fmt.Errorf("unable to parse line %d of history file %s: %w", line, filename, err)
+		}
+		history = append(history, snapshot)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read history file %s: %w", filename, err)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package state
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItLoadsAnEmptyHistoryWhenNoFileExists(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	history, err := LoadHistory(DefaultHistoryFilename)
+	assert.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func TestItAppendsSnapshotsToTheHistory(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	first := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+	err := AppendSnapshot(DefaultHistoryFilename, Snapshot{At: first, Repos: map[string]PrSnapshot{
+		"org/repo1": {State: "OPEN", Number: 1, CreatedAt: OptionalTime(first)},
+		"org/repo2": {State: "NO_PR"},
+	}})
+	assert.NoError(t, err)
+	err = AppendSnapshot(DefaultHistoryFilename, Snapshot{At: second, Repos: map[string]PrSnapshot{
+		"org/repo1": {State: "MERGED", Number: 1, CreatedAt: OptionalTime(first), MergedAt: OptionalTime(second)},
+	}})
+	assert.NoError(t, err)
+
+	history, err := LoadHistory(DefaultHistoryFilename)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, first, history[0].At)
+	assert.Equal(t, "NO_PR", history[0].Repos["org/repo2"].State)
+	assert.Nil(t, history[0].Repos["org/repo1"].MergedAt)
+	assert.Equal(t, "MERGED", history[1].Repos["org/repo1"].State)
+	assert.Equal(t, second, *history[1].Repos["org/repo1"].MergedAt)
+}
+
+func TestItCarriesOverReposLeftOutOfASnapshot(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	first := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	second := first.Add(24 * time.Hour)
+	err := RecordSnapshot(DefaultHistoryFilename, Snapshot{At: first, Repos: map[string]PrSnapshot{
+		"org/repo1": {State: "OPEN", Number: 1},
+		"org/repo2": {State: "OPEN", Number: 2},
+	}})
+	assert.NoError(t, err)
+	err = RecordSnapshot(DefaultHistoryFilename, Snapshot{At: second, Repos: map[string]PrSnapshot{
+		"org/repo1": {State: "MERGED", Number: 1},
+	}})
+	assert.NoError(t, err)
+
+	history, err := LoadHistory(DefaultHistoryFilename)
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, map[string]PrSnapshot{
+		"org/repo1": {State: "MERGED", Number: 1},
+		"org/repo2": {State: "OPEN", Number: 2},
+	}, history[1].Repos)
+}
+
+func TestItRejectsACorruptHistoryFile(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	_ = os.WriteFile(DefaultHistoryFilename, []byte("{\"at\": \"2024-03-01T09:00:00Z\"}\n{not json\n"), 0o644)
+
+	_, err := LoadHistory(DefaultHistoryFilename)
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to parse line 2 of history file")
+}
@@ -0,0 +1,202 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package state records where each repository of a campaign sits in the turbolift lifecycle, so that commands can
+// pick up where a previous run left off and other tools can inspect the progress of a campaign.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultFilename = ".turbolift_state.json"
+
+type RepoState struct {
+	Fork          bool   `json:"fork"`
+	DefaultBranch string `json:"defaultBranch,omitempty"`
+	LastCommitSHA string `json:"lastCommitSha,omitempty"`
+	PushedSHA     string `json:"pushedSha,omitempty"`
+	PrNumber      int    `json:"prNumber,omitempty"`
+	PrUrl         string `json:"prUrl,omitempty"`
+	PrState       string `json:"prState,omitempty"`
+	// AppliedLabels, AppliedReviewers and AppliedAssignees are those that were last applied to the PR from the front
+	// matter of the PR description, so that any that are later dropped from it can be removed from the PR.
+	// AppliedReviewers names teams as org/team.
+	AppliedLabels    []string  `json:"appliedLabels,omitempty"`
+	AppliedReviewers []string  `json:"appliedReviewers,omitempty"`
+	AppliedAssignees []string  `json:"appliedAssignees,omitempty"`
+	LastForeach      *Foreach  `json:"lastForeach,omitempty"`
+	UpdatedAt        time.Time `json:"updatedAt"`
+}
+
+// Foreach describes the most recent execution of `turbolift foreach` against a repo
+type Foreach struct {
+	Command   string    `json:"command"`
+	Succeeded bool      `json:"succeeded"`
+	At        time.Time `json:"at"`
+}
+
+// HasPR reports whether a PR is known to have been raised for the repo that is open or has been merged, i.e. one that
+// should not be raised again. PRs that were closed without being merged are not counted.
+func (r RepoState) HasPR() bool {
+	return r.PrUrl != "" && (r.PrState == "OPEN" || r.PrState == "MERGED")
+}
+
+// UpstreamRemote is the name of the git remote that tracks the repo that PRs are raised against
+func (r RepoState) UpstreamRemote() string {
+	if r.Fork {
+		return "upstream"
+	}
+	return "origin"
+}
+
+type State struct {
+	mu       sync.Mutex
+	filename string
+
+	Campaign      string                `json:"campaign"`
+	Repos         map[string]*RepoState `json:"repos"`
+	TrackingIssue *TrackingIssue        `json:"trackingIssue,omitempty"`
+}
+
+// TrackingIssue identifies the issue that lists the PRs of the campaign, which turbolift keeps up to date
+type TrackingIssue struct {
+	Repo   string `json:"repo"`
+	Number int    `json:"number"`
+	Url    string `json:"url"`
+}
+
+// Load reads the state file with the given name. A missing file is not an error: it results in an empty State that
+// will be written to the file when first updated.
+func Load(filename string, campaignName string) (*State, error) {
+	s := &State{
+		filename: filename,
+		Campaign: campaignName,
+		Repos:    map[string]*RepoState{},
+	}
+
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("unable to read state file %s: %w", filename, err)
+	}
+
+	if err := json.Unmarshal(content, s); err != nil {
+		return nil, fmt.Errorf("unable to parse state file %s: %w", filename, err)
+	}
+	if s.Repos == nil {
+		s.Repos = map[string]*RepoState{}
+	}
+	s.Campaign = campaignName
+
+	return s, nil
+}
+
+// Get returns a copy of the recorded state of a repo, which is empty if nothing has been recorded for it yet.
+func (s *State) Get(fullRepoName string) RepoState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if r, ok := s.Repos[fullRepoName]; ok {
+		return *r
+	}
+	return RepoState{}
+}
+
+// RepoNames lists the repos that anything has been recorded for, in alphabetical order
+func (s *State) RepoNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.Repos))
+	for name := range s.Repos {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Update applies changes to the recorded state of a repo, and persists the whole state to disk.
+// It is safe to call from several goroutines at once.
+func (s *State) Update(fullRepoName string, update func(*RepoState)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	r, ok := s.Repos[fullRepoName]
+	if !ok {
+		r = &RepoState{}
+		s.Repos[fullRepoName] = r
+	}
+	update(r)
+	r.UpdatedAt = time.Now().UTC()
+
+	return s.save()
+}
+
+// GetTrackingIssue returns a copy of the campaign's tracking issue, or nil if it does not have one.
+func (s *State) GetTrackingIssue() *TrackingIssue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.TrackingIssue == nil {
+		return nil
+	}
+	issue := *s.TrackingIssue
+	return &issue
+}
+
+// SetTrackingIssue records the campaign's tracking issue, and persists the whole state to disk.
+func (s *State) SetTrackingIssue(issue TrackingIssue) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.TrackingIssue = &issue
+	return s.save()
+}
+
+// save writes the state to a temporary file, then renames it over the state file so that readers never see a
+// partially written file. Caller must hold s.mu.
+func (s *State) save() error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.filename), filepath.Base(s.filename)+".*")
+	if err != nil {
+		return fmt.Errorf("unable to write state file %s: %w", s.filename, err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(append(content, '\n')); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("unable to write state file %s: %w", s.filename, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("unable to write state file %s: %w", s.filename, err)
+	}
+
+	return os.Rename(tmp.Name(), s.filename)
+}
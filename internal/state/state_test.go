@@ -0,0 +1,101 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package state
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItLoadsAnEmptyStateWhenNoFileExists(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	s, err := Load(DefaultFilename, "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, "turbolift-campaign", s.Campaign)
+	assert.Empty(t, s.Repos)
+	assert.Equal(t, RepoState{}, s.Get("org/repo1"))
+
+	_, err = os.Stat(DefaultFilename)
+	assert.True(t, os.IsNotExist(err), "Loading should not create the state file")
+}
+
+func TestItPersistsUpdates(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	s, err := Load(DefaultFilename, "turbolift-campaign")
+	assert.NoError(t, err)
+
+	err = s.Update("org/repo1", func(r *RepoState) {
+		r.Fork = true
+		r.DefaultBranch = "main"
+	})
+	assert.NoError(t, err)
+	err = s.Update("org/repo1", func(r *RepoState) {
+		r.PrUrl = "https://github.com/org/repo1/pull/1"
+		r.PrState = "OPEN"
+	})
+	assert.NoError(t, err)
+
+	reloaded, err := Load(DefaultFilename, "turbolift-campaign")
+	assert.NoError(t, err)
+	repoState := reloaded.Get("org/repo1")
+	assert.True(t, repoState.Fork)
+	assert.Equal(t, "main", repoState.DefaultBranch)
+	assert.Equal(t, "https://github.com/org/repo1/pull/1", repoState.PrUrl)
+	assert.False(t, repoState.UpdatedAt.IsZero())
+	assert.Equal(t, RepoState{}, reloaded.Get("org/repo2"))
+
+	content, err := os.ReadFile(DefaultFilename)
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"campaign": "turbolift-campaign"`)
+	assert.Contains(t, string(content), `"org/repo1"`)
+}
+
+func TestItRejectsACorruptStateFile(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+	_ = os.WriteFile(DefaultFilename, []byte("{not json"), 0o644)
+
+	_, err := Load(DefaultFilename, "turbolift-campaign")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "unable to parse state file")
+}
+
+func TestHasPR(t *testing.T) {
+	assert.False(t, RepoState{}.HasPR())
+	assert.True(t, RepoState{PrUrl: "url", PrState: "OPEN"}.HasPR())
+	assert.True(t, RepoState{PrUrl: "url", PrState: "MERGED"}.HasPR())
+	assert.False(t, RepoState{PrUrl: "url", PrState: "CLOSED"}.HasPR())
+}
+
+func TestItPersistsTheTrackingIssue(t *testing.T) {
+	testsupport.CreateAndEnterTempDirectory()
+
+	s, err := Load(DefaultFilename, "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Nil(t, s.GetTrackingIssue())
+
+	err = s.SetTrackingIssue(TrackingIssue{Repo: "org/tracking", Number: 12, Url: "https://github.com/org/tracking/issues/12"})
+	assert.NoError(t, err)
+
+	reloaded, err := Load(DefaultFilename, "turbolift-campaign")
+	assert.NoError(t, err)
+	assert.Equal(t, &TrackingIssue{Repo: "org/tracking", Number: 12, Url: "https://github.com/org/tracking/issues/12"}, reloaded.GetTrackingIssue())
+}
@@ -0,0 +1,180 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+// Package tracking keeps a campaign's tracking issue, which holds a checklist of every PR raised by the campaign.
+// Items are ticked as their PRs are merged and struck through when they are closed.
+package tracking
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/state"
+)
+
+// The checklist sits between these markers, so that anything else written in the issue is left alone when it is
+// brought up to date
+const (
+	startMarker = "<!-- turbolift:tracking:start -->"
+	endMarker   = "<!-- turbolift:tracking:end -->"
+)
+
+// ParseIssueRef splits a reference to a tracking issue into the repo that holds it and the issue number. References
+// are either a repo, [host/]owner/repo, in which to create an issue, or an existing issue, [host/]owner/repo#number.
+// The number is 0 if none was given.
+func ParseIssueRef(ref string) (string, int, error) {
+	repo, number, hasNumber := strings.Cut(strings.TrimSpace(ref), "#")
+	if parts := strings.Split(repo, "/"); len(parts) < 2 || len(parts) > 3 {
+		return "", 0, fmt.Errorf("invalid tracking issue %s: use [host/]owner/repo or [host/]owner/repo#number", ref)
+	}
+	if !hasNumber {
+		return repo, 0, nil
+	}
+	n, err := strconv.Atoi(number)
+	if err != nil || n <= 0 {
+		return "", 0, fmt.Errorf("invalid tracking issue %s: use [host/]owner/repo or [host/]owner/repo#number", ref)
+	}
+	return repo, n, nil
+}
+
+// Open returns the campaign's tracking issue given a reference as accepted by ParseIssueRef, and records it in the
+// campaign state. An issue already recorded for the campaign in the same repo is reused rather than creating another.
+// created reports whether a new issue was created.
+func Open(output io.Writer, gh github.GitHub, dir *campaign.Campaign, ref string) (issue *state.TrackingIssue, created bool, err error) {
+	repo, number, err := ParseIssueRef(ref)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if number == 0 {
+		if existing := dir.State.GetTrackingIssue(); existing != nil && existing.Repo == repo {
+			return existing, false, nil
+		}
+	}
+
+	var found *github.Issue
+	if number == 0 {
+		found, err = gh.CreateIssue(output, repo, issueTitle(dir), issueBody(dir))
+		created = true
+	} else {
+		found, err = gh.GetIssue(output, repo, number)
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	issue = &state.TrackingIssue{Repo: repo, Number: found.Number, Url: found.Url}
+	if err := dir.State.SetTrackingIssue(*issue); err != nil {
+		return nil, false, err
+	}
+	return issue, created, nil
+}
+
+// Sync brings the checklist in the campaign's tracking issue up to date with the PRs recorded in the campaign state.
+// The issue is only edited if its checklist has changed, which is reported by updated.
+func Sync(output io.Writer, gh github.GitHub, dir *campaign.Campaign) (updated bool, err error) {
+	issue := dir.State.GetTrackingIssue()
+	if issue == nil {
+		return false, fmt.Errorf("campaign %s has no tracking issue: create one with turbolift create-prs --tracking-issue", dir.Name)
+	}
+
+	current, err := gh.GetIssue(output, issue.Repo, issue.Number)
+	if err != nil {
+		return false, err
+	}
+	body := ReplaceChecklist(current.Body, Checklist(dir))
+	if body == current.Body {
+		return false, nil
+	}
+	if err := gh.UpdateIssueBody(output, issue.Repo, issue.Number, body); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// Checklist lists the PRs raised for every repo recorded in the campaign state, so that running a command against a
+// subset of the repos with --repos does not drop the others. Repos in the repos file come first, in its order,
+// followed by any others in alphabetical order.
+func Checklist(dir *campaign.Campaign) string {
+	var repoNames []string
+	listed := map[string]bool{}
+	for _, repo := range dir.Repos {
+		repoNames = append(repoNames, repo.FullRepoName)
+		listed[repo.FullRepoName] = true
+	}
+	for _, name := range dir.State.RepoNames() {
+		if !listed[name] {
+			repoNames = append(repoNames, name)
+		}
+	}
+
+	var items []string
+	merged := 0
+	for _, repoName := range repoNames {
+		repoState := dir.State.Get(repoName)
+		if repoState.PrUrl == "" {
+			continue
+		}
+		item := repoName + " " + repoState.PrUrl
+		switch repoState.PrState {
+		case "MERGED":
+			items = append(items, "- [x] "+item)
+			merged++
+		case "CLOSED":
+			items = append(items, "- [ ] ~~"+item+"~~ (closed)")
+		default:
+			items = append(items, "- [ ] "+item)
+		}
+	}
+
+	if len(items) == 0 {
+		return "No PRs have been raised yet."
+	}
+	return fmt.Sprintf("%d of %d PRs merged.\n\n%s", merged, len(items), strings.Join(items, "\n"))
+}
+
+// ReplaceChecklist puts a checklist between the markers in the body of an issue, or at the end of the body if the
+// markers have been removed
+func ReplaceChecklist(body string, checklist string) string {
+	section := startMarker + "\n" + checklist + "\n" + endMarker
+
+	start := strings.Index(body, startMarker)
+	end := strings.Index(body, endMarker)
+	if start < 0 || end < start {
+		if strings.TrimSpace(body) == "" {
+			return section
+		}
+		return strings.TrimRight(body, "\n") + "\n\n" + section
+	}
+	return body[:start] + section + body[end+len(endMarker):]
+}
+
+// issueTitle follows the PR title, unless it is a template that is rendered differently for each repo, in which case
+// the campaign name stands in for it
+func issueTitle(dir *campaign.Campaign) string {
+	if dir.PrTitle == "" || (dir.PrOptions.Template && strings.Contains(dir.PrTitle, "{{")) {
+		return "Tracking: " + dir.Name
+	}
+	return "Tracking: " + dir.PrTitle
+}
+
+func issueBody(dir *campaign.Campaign) string {
+	intro := fmt.Sprintf("This issue tracks the PRs raised by the turbolift campaign `%s`. The list below is kept up to date by turbolift.", dir.Name)
+	return ReplaceChecklist(intro, Checklist(dir))
+}
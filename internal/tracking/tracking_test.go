@@ -0,0 +1,149 @@
+/*
+ * Copyright 2021 Skyscanner Limited.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ * https://www.apache.org/licenses/LICENSE-2.0
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ *
+ */
+
+package tracking
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/skyscanner/turbolift/internal/campaign"
+	"github.com/skyscanner/turbolift/internal/github"
+	"github.com/skyscanner/turbolift/internal/state"
+	"github.com/skyscanner/turbolift/internal/testsupport"
+)
+
+func TestItParsesTrackingIssueReferences(t *testing.T) {
+	repo, number, err := ParseIssueRef("org/tracking")
+	assert.NoError(t, err)
+	assert.Equal(t, "org/tracking", repo)
+	assert.Equal(t, 0, number)
+
+	repo, number, err = ParseIssueRef("github.example.com/org/tracking#12")
+	assert.NoError(t, err)
+	assert.Equal(t, "github.example.com/org/tracking", repo)
+	assert.Equal(t, 12, number)
+
+	for _, invalid := range []string{"tracking", "org/tracking#", "org/tracking#abc", "a/b/c/d"} {
+		_, _, err = ParseIssueRef(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestItListsPrsByState(t *testing.T) {
+	dir := openCampaign(t, "org/repo1", "org/repo2", "org/repo3", "org/repo4")
+	recordPr(t, dir, "org/repo1", "MERGED")
+	recordPr(t, dir, "org/repo2", "OPEN")
+	recordPr(t, dir, "org/repo3", "CLOSED")
+
+	assert.Equal(t, "1 of 3 PRs merged.\n\n"+
+		"- [x] org/repo1 https://github.com/org/repo1/pull/1\n"+
+		"- [ ] org/repo2 https://github.com/org/repo2/pull/1\n"+
+		"- [ ] ~~org/repo3 https://github.com/org/repo3/pull/1~~ (closed)", Checklist(dir))
+}
+
+func TestItKeepsPrsOfReposMissingFromTheReposFile(t *testing.T) {
+	dir := openCampaign(t, "org/repo2")
+	recordPr(t, dir, "org/repo3", "OPEN")
+	recordPr(t, dir, "org/repo1", "MERGED")
+	recordPr(t, dir, "org/repo2", "OPEN")
+
+	assert.Equal(t, "1 of 3 PRs merged.\n\n"+
+		"- [ ] org/repo2 https://github.com/org/repo2/pull/1\n"+
+		"- [x] org/repo1 https://github.com/org/repo1/pull/1\n"+
+		"- [ ] org/repo3 https://github.com/org/repo3/pull/1", Checklist(dir))
+}
+
+func TestItReplacesOnlyTheChecklistInAnIssue(t *testing.T) {
+	body := "Notes before\n\n" + startMarker + "\nold list\n" + endMarker + "\n\nNotes after"
+	assert.Equal(t, "Notes before\n\n"+startMarker+"\nnew list\n"+endMarker+"\n\nNotes after", ReplaceChecklist(body, "new list"))
+
+	assert.Equal(t, "Hand-written\n\n"+startMarker+"\nnew list\n"+endMarker, ReplaceChecklist("Hand-written\n", "new list"))
+	assert.Equal(t, startMarker+"\nnew list\n"+endMarker, ReplaceChecklist("", "new list"))
+}
+
+func TestItCreatesATrackingIssueOnlyOnce(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	dir := openCampaign(t, "org/repo1")
+
+	issue, created, err := Open(&strings.Builder{}, fakeGitHub, dir, "org/tracking")
+	assert.NoError(t, err)
+	assert.True(t, created)
+	assert.Equal(t, &state.TrackingIssue{Repo: "org/tracking", Number: 1, Url: "https://github.com/org/tracking/issues/1"}, issue)
+
+	issue, created, err = Open(&strings.Builder{}, fakeGitHub, dir, "org/tracking")
+	assert.NoError(t, err)
+	assert.False(t, created)
+	assert.Equal(t, 1, issue.Number)
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"create_issue", "org/tracking", "Tracking: PR title", "This issue tracks the PRs raised by the turbolift campaign `" + dir.Name + "`. " +
+			"The list below is kept up to date by turbolift.\n\n" + startMarker + "\nNo PRs have been raised yet.\n" + endMarker},
+	})
+}
+
+func TestItTitlesTheIssueAfterTheCampaignWhenThePrTitleIsATemplate(t *testing.T) {
+	dir := &campaign.Campaign{Name: "bump-go", PrTitle: "Bump Go in {{.Repo.RepoName}}", PrOptions: campaign.PrOptions{Template: true}}
+	assert.Equal(t, "Tracking: bump-go", issueTitle(dir))
+
+	dir.PrTitle = "Bump Go"
+	assert.Equal(t, "Tracking: Bump Go", issueTitle(dir))
+
+	dir.PrTitle = "Bump Go in {{.Repo.RepoName}}"
+	dir.PrOptions.Template = false
+	assert.Equal(t, "Tracking: Bump Go in {{.Repo.RepoName}}", issueTitle(dir))
+}
+
+func TestItOnlyEditsTheTrackingIssueWhenItsChecklistChanges(t *testing.T) {
+	fakeGitHub := github.NewAlwaysSucceedsFakeGitHub()
+	fakeGitHub.SetIssueBody("org/tracking", 5, "Hand-written notes")
+	dir := openCampaign(t, "org/repo1")
+	recordPr(t, dir, "org/repo1", "OPEN")
+
+	_, created, err := Open(&strings.Builder{}, fakeGitHub, dir, "org/tracking#5")
+	assert.NoError(t, err)
+	assert.False(t, created)
+
+	updated, err := Sync(&strings.Builder{}, fakeGitHub, dir)
+	assert.NoError(t, err)
+	assert.True(t, updated)
+
+	updated, err = Sync(&strings.Builder{}, fakeGitHub, dir)
+	assert.NoError(t, err)
+	assert.False(t, updated)
+
+	fakeGitHub.AssertCalledWith(t, [][]string{
+		{"get_issue", "org/tracking", "5"},
+		{"get_issue", "org/tracking", "5"},
+		{"update_issue_body", "org/tracking", "5", "Hand-written notes\n\n" + startMarker + "\n0 of 1 PRs merged.\n\n- [ ] org/repo1 https://github.com/org/repo1/pull/1\n" + endMarker},
+		{"get_issue", "org/tracking", "5"},
+	})
+}
+
+func openCampaign(t *testing.T, repos ...string) *campaign.Campaign {
+	testsupport.PrepareTempCampaign(false, repos...)
+	dir, err := campaign.OpenCampaign(campaign.NewCampaignOptions())
+	assert.NoError(t, err)
+	return dir
+}
+
+func recordPr(t *testing.T, dir *campaign.Campaign, repo string, prState string) {
+	assert.NoError(t, dir.State.Update(repo, func(r *state.RepoState) {
+		r.PrUrl = "https://github.com/" + repo + "/pull/1"
+		r.PrState = prState
+	}))
+}